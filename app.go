@@ -1,29 +1,43 @@
 package main
 
 import (
+	"flag"
+	"github.com/sirupsen/logrus"
 	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot/simulator"
 	"github.com/zhouziqunzzq/MiraiGo-DD/config"
 	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
+	"io"
 	"os"
 	"os/signal"
 
 	// register modules
-	// not sorted alphabetically as intended
+	// 启动顺序由 ModuleInfo 中的 Dependencies 及 Priority 决定，与 import 顺序无关
 	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/auto_reconnect"
-	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/logging"
-	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
 	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/bili"
 	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/daredemo_suki"
-	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/naive_chatbot"
 	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/diary"
+	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/logging"
+	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/naive_chatbot"
+	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
 )
 
+var consoleMode = flag.Bool("console", false, "离线模式：不登录 QQ，从标准输入读取模拟消息并在终端输出 Bot 的回复")
+
 func init() {
 	utils.WriteLogToFS()
 	config.Init()
 }
 
 func main() {
+	flag.Parse()
+	if *consoleMode {
+		// 日志仍会写入 ./logs，终端中仅显示消息
+		logrus.SetOutput(io.Discard)
+		simulator.RunConsole(os.Stdin, os.Stdout)
+		return
+	}
+
 	// Generate random device.json if necessary
 	bot.GenRandomDevice()
 
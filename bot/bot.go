@@ -10,11 +10,11 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
 	qrcodeTerminal "github.com/Baozisoftware/qrcode-terminal-go"
 	"github.com/Mrs4s/MiraiGo/client"
+	"github.com/Mrs4s/MiraiGo/message"
 	"github.com/sirupsen/logrus"
 	"github.com/tuotoo/qrcode"
 	"github.com/zhouziqunzzq/MiraiGo-DD/config"
@@ -25,7 +25,20 @@ import (
 type Bot struct {
 	*client.QQClient
 
-	start bool
+	// Bot 层的事件句柄，覆盖 QQClient 中的同名字段
+	// Module 应通过这些句柄订阅事件，以便在停用或重载时取消订阅
+	GroupMessageEvent          EventHandle[*message.GroupMessage]
+	PrivateMessageEvent        EventHandle[*message.PrivateMessage]
+	TempMessageEvent           EventHandle[*client.TempMessageEvent]
+	GroupMessageRecalledEvent  EventHandle[*client.GroupMessageRecalledEvent]
+	FriendMessageRecalledEvent EventHandle[*client.FriendMessageRecalledEvent]
+	GroupMuteEvent             EventHandle[*client.GroupMuteEvent]
+	DisconnectedEvent          EventHandle[*client.ClientDisconnectedEvent]
+
+	// client 离线模式下替代 QQClient 的客户端实现
+	client Client
+	sender *Sender
+	start  bool
 }
 
 // Instance Bot 实例
@@ -47,14 +60,21 @@ type InitOption struct {
 	DeviceJSONContent []byte //cannot be nil if using option init
 }
 
-func InitWithOption(option InitOption) error {
-	Instance = &Bot{
-		QQClient: client.NewClient(
-			option.Account,
-			option.Password,
-		),
-		start: false,
+// newBot 使用 qqClient 创建 Bot 并转发其事件
+func newBot(qqClient *client.QQClient) *Bot {
+	b := &Bot{
+		QQClient: qqClient,
+		start:    false,
 	}
+	b.bridgeEvents()
+	return b
+}
+
+func InitWithOption(option InitOption) error {
+	Instance = newBot(client.NewClient(
+		option.Account,
+		option.Password,
+	))
 	err := client.SystemDeviceInfo.ReadJson(option.DeviceJSONContent)
 	if err != nil {
 		return errors.Errorf("failed to apply device.json with err:%s", err)
@@ -77,10 +97,7 @@ func InitWithDeviceJSONContent(deviceJSONContent []byte) {
 
 // InitBot 使用 account password 进行初始化账号
 func InitBot(account int64, password string) {
-	Instance = &Bot{
-		client.NewClient(account, password),
-		false,
-	}
+	Instance = newBot(client.NewClient(account, password))
 }
 
 // UseDevice 使用 device 进行初始化设备信息
@@ -104,6 +121,10 @@ func GenRandomDevice() {
 
 // SaveToken 会话缓存
 func SaveToken() {
+	if Instance.QQClient == nil {
+		logger.Warn("no QQ client in offline mode, skipping saving token")
+		return
+	}
 	AccountToken := Instance.GenToken()
 	_ = os.WriteFile("session.token", AccountToken, 0o644)
 }
@@ -118,13 +139,16 @@ const (
 
 // Login 登录
 func Login() error {
+	if Instance.QQClient == nil {
+		return errors.New("unable to login in offline mode")
+	}
 	var tokenData []byte = nil
 	// 存在token缓存的情况快速恢复会话
 	if exist, _ := utils.FileExist("./session.token"); exist {
 		logger.Infof("检测到会话缓存, 尝试快速恢复登录")
 		token, err := os.ReadFile("./session.token")
 		if err != nil {
-			return errors.Errorf("failed to read token from file with err:%w", err)
+			return fmt.Errorf("failed to read token from file with err:%w", err)
 		}
 		tokenData = token
 	}
@@ -144,6 +168,9 @@ type LoginOption struct {
 }
 
 func LoginWithOption(option LoginOption) error {
+	if Instance.QQClient == nil {
+		return errors.New("unable to login in offline mode")
+	}
 	if option.Token != nil {
 		err := func() error {
 			logger.Infof("检测到会话缓存, 尝试快速恢复登录")
@@ -286,6 +313,7 @@ func loginResponseProcessor(res *client.LoginResponse) error {
 			Instance.Disconnect()
 			Instance.Release()
 			Instance.QQClient = client.NewClientEmpty()
+			Instance.bridgeEvents()
 			return QrcodeLogin()
 		case client.NeedCaptcha:
 			logger.Warnf("登录需要验证码.")
@@ -346,6 +374,10 @@ func loginResponseProcessor(res *client.LoginResponse) error {
 
 // RefreshList 刷新联系人
 func RefreshList() {
+	if Instance.QQClient == nil {
+		logger.Warn("no QQ client in offline mode, skipping reloading lists")
+		return
+	}
 	logger.Info("start reload friends list")
 	err := Instance.ReloadFriendList()
 	if err != nil {
@@ -362,6 +394,8 @@ func RefreshList() {
 
 // StartService 启动服务
 // 根据 Module 生命周期 此过程应在Login前调用
+// 各 Module 按照依赖关系及优先级依次执行各阶段的生命周期
+// 存在循环依赖时 panic
 // 请勿重复调用
 func StartService() {
 	if Instance.start {
@@ -370,38 +404,69 @@ func StartService() {
 
 	Instance.start = true
 
+	sorted, err := sortModules()
+	if err != nil {
+		logger.WithError(err).Panic("unable to resolve module dependencies")
+	}
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	moduleOrder = sorted
+	logger.Infof("module order: %v", moduleOrder)
+
+	Instance.sender = newSender(loadSenderConfig())
+	Instance.sender.start()
+
 	logger.Infof("initializing modules ...")
-	for _, mi := range modules {
+	initialized := make([]ModuleInfo, 0, len(moduleOrder))
+	for _, mi := range moduleOrder {
 		mi.Instance.Init()
+		if isInitialized(mi) {
+			initialized = append(initialized, mi)
+		} else {
+			logger.Warnf("module %s is disabled or failed to initialize, it stays stopped", mi.ID)
+			releaseModule(mi)
+		}
 	}
-	for _, mi := range modules {
+	for _, mi := range initialized {
 		mi.Instance.PostInit()
 	}
 	logger.Info("all modules initialized")
 
 	logger.Info("registering modules serve functions ...")
-	for _, mi := range modules {
+	for _, mi := range initialized {
 		mi.Instance.Serve(Instance)
 	}
 	logger.Info("all modules serve functions registered")
 
 	logger.Info("starting modules tasks ...")
-	for _, mi := range modules {
+	for _, mi := range initialized {
 		go mi.Instance.Start(Instance)
+		moduleRunning[mi.ID] = true
 	}
 	logger.Info("tasks running")
 }
 
 // Stop 停止所有服务
+// 按照启动顺序的逆序依次停止各 Module
 // 调用此函数并不会使Bot离线
 func Stop() {
 	logger.Warn("stopping ...")
-	wg := sync.WaitGroup{}
-	for _, mi := range modules {
-		wg.Add(1)
-		mi.Instance.Stop(Instance, &wg)
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	for i := len(moduleOrder) - 1; i >= 0; i-- {
+		mi := moduleOrder[i]
+		if !moduleRunning[mi.ID] {
+			continue
+		}
+		stopModule(mi)
+	}
+	if Instance.sender != nil {
+		Instance.sender.stop()
 	}
-	wg.Wait()
 	logger.Info("stopped")
+	modulesMu.Lock()
 	modules = make(map[string]ModuleInfo)
+	modulesMu.Unlock()
+	moduleOrder = nil
+	moduleRunning = make(map[ModuleID]bool)
 }
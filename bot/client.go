@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"io"
+
+	"github.com/Mrs4s/MiraiGo/client"
+	"github.com/Mrs4s/MiraiGo/message"
+)
+
+// Client Module 所使用的 QQ 客户端操作
+// 在线时由 *Bot 本身实现，离线模式及测试中可替换为其他实现
+type Client interface {
+	SendGroupMessage(groupCode int64, m *message.SendingMessage) *message.GroupMessage
+	SendPrivateMessage(target int64, m *message.SendingMessage) *message.PrivateMessage
+	SendGroupTempMessage(groupCode, target int64, m *message.SendingMessage) *message.TempMessage
+	UploadGroupImage(groupCode int64, img io.ReadSeeker, thread ...int) (*message.GroupImageElement, error)
+	FindGroup(code int64) *client.GroupInfo
+	IsOnline() bool
+	// BotUin Bot 自身的 QQ 号
+	BotUin() int64
+}
+
+// IsOnline Bot 是否在线
+func (b *Bot) IsOnline() bool {
+	if b.QQClient == nil {
+		return b.client != nil && b.client.IsOnline()
+	}
+	return b.Online.Load()
+}
+
+// BotUin Bot 自身的 QQ 号
+func (b *Bot) BotUin() int64 {
+	if b.QQClient == nil {
+		if b.client != nil {
+			return b.client.BotUin()
+		}
+		return 0
+	}
+	return b.Uin
+}
+
+// Client 获取 Module 应使用的 QQ 客户端
+func (b *Bot) Client() Client {
+	if b.client != nil {
+		return b.client
+	}
+	return b
+}
+
+// InitOffline 使用 c 初始化一个不登录 QQ 的 Bot
+// 所有事件均需通过 Bot 的事件句柄手动分发
+// 此时 QQClient 为 nil，Module 应通过 Client() 访问客户端
+func InitOffline(c Client) {
+	Instance = &Bot{
+		client: c,
+		start:  false,
+	}
+}
@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"runtime/debug"
+	"sync"
+
+	"github.com/Mrs4s/MiraiGo/client"
+	"github.com/Mrs4s/MiraiGo/message"
+)
+
+// EventHandle Bot 层的事件句柄
+// 与 MiraiGo 的 client.EventHandle 不同，订阅时需提供订阅者的 ModuleID，
+// 以便在 Module 被停用或重载时取消其全部订阅
+type EventHandle[T any] struct {
+	mu          sync.RWMutex
+	subscribers []eventSubscriber[T]
+}
+
+type eventSubscriber[T any] struct {
+	owner   ModuleID
+	handler func(Client, T)
+}
+
+// Subscribe 以 owner 的身份订阅事件
+func (h *EventHandle[T]) Subscribe(owner ModuleID, handler func(Client, T)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers = append(h.subscribers, eventSubscriber[T]{
+		owner:   owner,
+		handler: handler,
+	})
+}
+
+// Unsubscribe 取消 owner 的全部订阅
+func (h *EventHandle[T]) Unsubscribe(owner ModuleID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	kept := make([]eventSubscriber[T], 0, len(h.subscribers))
+	for _, s := range h.subscribers {
+		if s.owner != owner {
+			kept = append(kept, s)
+		}
+	}
+	h.subscribers = kept
+}
+
+// Dispatch 将事件分发给所有订阅者
+// 单个订阅者 panic 不会影响其他订阅者
+func (h *EventHandle[T]) Dispatch(c Client, event T) {
+	h.mu.RLock()
+	subscribers := h.subscribers
+	h.mu.RUnlock()
+
+	for _, s := range subscribers {
+		func() {
+			defer func() {
+				if pan := recover(); pan != nil {
+					logger.Errorf("event handler of module %s panicked: %v\n%s", s.owner, pan, debug.Stack())
+				}
+			}()
+			s.handler(c, event)
+		}()
+	}
+}
+
+// unsubscribeAll 取消 owner 在 Bot 所有事件上的订阅
+func (b *Bot) unsubscribeAll(owner ModuleID) {
+	b.GroupMessageEvent.Unsubscribe(owner)
+	b.PrivateMessageEvent.Unsubscribe(owner)
+	b.TempMessageEvent.Unsubscribe(owner)
+	b.GroupMessageRecalledEvent.Unsubscribe(owner)
+	b.FriendMessageRecalledEvent.Unsubscribe(owner)
+	b.GroupMuteEvent.Unsubscribe(owner)
+	b.DisconnectedEvent.Unsubscribe(owner)
+}
+
+// bridgeEvents 将底层 QQClient 的事件转发至 Bot 层的事件句柄
+// 每个 QQClient 实例只应调用一次
+func (b *Bot) bridgeEvents() {
+	c := b.QQClient
+	c.GroupMessageEvent.Subscribe(func(_ *client.QQClient, e *message.GroupMessage) {
+		b.GroupMessageEvent.Dispatch(b, e)
+	})
+	c.PrivateMessageEvent.Subscribe(func(_ *client.QQClient, e *message.PrivateMessage) {
+		b.PrivateMessageEvent.Dispatch(b, e)
+	})
+	c.TempMessageEvent.Subscribe(func(_ *client.QQClient, e *client.TempMessageEvent) {
+		b.TempMessageEvent.Dispatch(b, e)
+	})
+	c.GroupMessageRecalledEvent.Subscribe(func(_ *client.QQClient, e *client.GroupMessageRecalledEvent) {
+		b.GroupMessageRecalledEvent.Dispatch(b, e)
+	})
+	c.FriendMessageRecalledEvent.Subscribe(func(_ *client.QQClient, e *client.FriendMessageRecalledEvent) {
+		b.FriendMessageRecalledEvent.Dispatch(b, e)
+	})
+	c.GroupMuteEvent.Subscribe(func(_ *client.QQClient, e *client.GroupMuteEvent) {
+		b.GroupMuteEvent.Dispatch(b, e)
+	})
+	c.DisconnectedEvent.Subscribe(func(_ *client.QQClient, e *client.ClientDisconnectedEvent) {
+		b.DisconnectedEvent.Dispatch(b, e)
+	})
+}
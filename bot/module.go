@@ -39,6 +39,21 @@ type Module interface {
 	Stop(bot *Bot, wg *sync.WaitGroup)
 }
 
+// Enabler Module 可选实现的接口
+// Init 后 IsEnabled 返回 false 表示 Module 被全局配置停用或初始化失败，
+// 此时不再执行其余的生命周期，Module 保持停止状态
+type Enabler interface {
+	IsEnabled() bool
+}
+
+// isInitialized Module 的 Init 是否成功，未实现 Enabler 的 Module 总是视为成功
+func isInitialized(mi ModuleInfo) bool {
+	if e, ok := mi.Instance.(Enabler); ok {
+		return e.IsEnabled()
+	}
+	return true
+}
+
 // RegisterModule - 向全局添加 Module
 func RegisterModule(instance Module) {
 	mod := instance.MiraiGoModule()
@@ -76,4 +91,7 @@ func GetModule(name string) (ModuleInfo, error) {
 var (
 	modules   = make(map[string]ModuleInfo)
 	modulesMu sync.RWMutex
+
+	// moduleOrder StartService 确定的 Module 启动顺序
+	moduleOrder []ModuleInfo
 )
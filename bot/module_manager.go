@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/config"
+)
+
+// InternalNamespace 内部 Module 的 Namespace
+// 内部 Module 不支持运行时启停
+const InternalNamespace = "internal"
+
+// ModuleStatus 模块运行状态
+type ModuleStatus struct {
+	Info    ModuleInfo
+	Running bool
+}
+
+var (
+	// lifecycleMu 保护运行时对 Module 生命周期的操作
+	lifecycleMu   sync.Mutex
+	moduleRunning = make(map[ModuleID]bool) // lifecycleMu protected
+)
+
+// ListModules 按启动顺序列出所有 Module 及其运行状态
+func ListModules() []ModuleStatus {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+
+	rst := make([]ModuleStatus, 0, len(moduleOrder))
+	for _, mi := range moduleOrder {
+		rst = append(rst, ModuleStatus{
+			Info:    mi,
+			Running: moduleRunning[mi.ID],
+		})
+	}
+	return rst
+}
+
+// EnableModule 启用 Module 并完成其完整的生命周期
+// 启用状态会覆盖全局配置中的 modules.<name>.is_enabled，直至程序重启
+func EnableModule(name string) error {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+
+	mi, err := getManagedModule(name)
+	if err != nil {
+		return err
+	}
+	if moduleRunning[mi.ID] {
+		return fmt.Errorf("module %s is already running", name)
+	}
+
+	config.GlobalConfig.Set(isEnabledKey(mi.ID), true)
+	return startModule(mi)
+}
+
+// DisableModule 停止 Module 并取消其全部事件订阅，Bot 保持在线
+// 停用状态会覆盖全局配置中的 modules.<name>.is_enabled，直至程序重启
+func DisableModule(name string) error {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+
+	mi, err := getManagedModule(name)
+	if err != nil {
+		return err
+	}
+	if !moduleRunning[mi.ID] {
+		return fmt.Errorf("module %s is not running", name)
+	}
+
+	warnRunningDependents(mi)
+	stopModule(mi)
+	config.GlobalConfig.Set(isEnabledKey(mi.ID), false)
+	return nil
+}
+
+// ReloadModule 重新读取全局配置后重启 Module，Bot 保持在线
+func ReloadModule(name string) error {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+
+	mi, err := getManagedModule(name)
+	if err != nil {
+		return err
+	}
+
+	if err = config.Reload(); err != nil {
+		return fmt.Errorf("unable to reload global config: %v", err)
+	}
+	if moduleRunning[mi.ID] {
+		stopModule(mi)
+	}
+	return startModule(mi)
+}
+
+// getManagedModule 获取一个支持运行时启停的 Module
+// 调用方需持有 lifecycleMu
+func getManagedModule(name string) (ModuleInfo, error) {
+	if Instance == nil || !Instance.start {
+		return ModuleInfo{}, fmt.Errorf("service not started")
+	}
+	mi, err := GetModule(name)
+	if err != nil {
+		return ModuleInfo{}, err
+	}
+	if mi.ID.Namespace() == InternalNamespace {
+		return ModuleInfo{}, fmt.Errorf("internal module %s cannot be managed at runtime", name)
+	}
+	return mi, nil
+}
+
+// startModule 执行 Module 的 Init, PostInit, Serve 及 Start
+// Init 失败或 Module 被全局配置停用时，Module 保持停止状态并返回错误
+// 调用方需持有 lifecycleMu
+func startModule(mi ModuleInfo) error {
+	logger.Infof("starting module %s ...", mi.ID)
+	mi.Instance.Init()
+	if !isInitialized(mi) {
+		releaseModule(mi)
+		return fmt.Errorf("module %s is disabled or failed to initialize", mi.ID)
+	}
+	mi.Instance.PostInit()
+	mi.Instance.Serve(Instance)
+	go mi.Instance.Start(Instance)
+	moduleRunning[mi.ID] = true
+	logger.Infof("module %s started", mi.ID)
+	return nil
+}
+
+// stopModule 取消 Module 的事件订阅并执行其 Stop
+// 调用方需持有 lifecycleMu
+func stopModule(mi ModuleInfo) {
+	logger.Infof("stopping module %s ...", mi.ID)
+	releaseModule(mi)
+	moduleRunning[mi.ID] = false
+	logger.Infof("module %s stopped", mi.ID)
+}
+
+// releaseModule 取消 Module 的事件订阅并执行其 Stop 以释放资源
+// Init 失败时 Module 可能已开始监听配置文件等，同样需要释放
+func releaseModule(mi ModuleInfo) {
+	Instance.unsubscribeAll(mi.ID)
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	mi.Instance.Stop(Instance, &wg)
+	wg.Wait()
+}
+
+// warnRunningDependents 提示仍在运行且依赖 mi 的 Module
+// 调用方需持有 lifecycleMu
+func warnRunningDependents(mi ModuleInfo) {
+	for _, other := range moduleOrder {
+		if !moduleRunning[other.ID] {
+			continue
+		}
+		for _, dep := range other.Dependencies {
+			if dep == mi.ID {
+				logger.Warnf("module %s depends on %s which is being stopped", other.ID, mi.ID)
+			}
+		}
+	}
+}
+
+func isEnabledKey(id ModuleID) string {
+	return "modules." + string(id) + ".is_enabled"
+}
+
+// ReloadModuleAsync 在新协程中重载 Module
+// 适用于在 Module 自身的协程（如配置文件监听）中触发重载，避免 Stop 等待自身退出造成死锁
+func ReloadModuleAsync(name string) {
+	go func() {
+		if err := ReloadModule(name); err != nil {
+			logger.WithError(err).Errorf("failed to reload module %s", name)
+		}
+	}()
+}
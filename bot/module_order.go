@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sortModules 根据依赖关系及优先级对所有已注册的 Module 进行拓扑排序
+// 存在未注册的依赖或循环依赖时返回 error
+func sortModules() ([]ModuleInfo, error) {
+	modulesMu.RLock()
+	defer modulesMu.RUnlock()
+
+	// in-degree of each module, and reverse edges (dependency -> dependents)
+	inDegree := make(map[ModuleID]int, len(modules))
+	dependents := make(map[ModuleID][]ModuleID, len(modules))
+	for _, mi := range modules {
+		inDegree[mi.ID] = len(mi.Dependencies)
+		for _, dep := range mi.Dependencies {
+			if _, ok := modules[string(dep)]; !ok {
+				return nil, fmt.Errorf("module %s depends on unregistered module %s", mi.ID, dep)
+			}
+			if dep == mi.ID {
+				return nil, fmt.Errorf("module %s depends on itself", mi.ID)
+			}
+			dependents[dep] = append(dependents[dep], mi.ID)
+		}
+	}
+
+	ready := make([]ModuleInfo, 0, len(modules))
+	for id, d := range inDegree {
+		if d == 0 {
+			ready = append(ready, modules[string(id)])
+		}
+	}
+
+	sorted := make([]ModuleInfo, 0, len(modules))
+	for len(ready) > 0 {
+		// pick the ready module with the highest priority
+		sort.Slice(ready, func(i, j int) bool {
+			if ready[i].Priority != ready[j].Priority {
+				return ready[i].Priority > ready[j].Priority
+			}
+			return ready[i].ID < ready[j].ID
+		})
+		mi := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, mi)
+
+		for _, id := range dependents[mi.ID] {
+			inDegree[id]--
+			if inDegree[id] == 0 {
+				ready = append(ready, modules[string(id)])
+			}
+		}
+	}
+
+	if len(sorted) != len(modules) {
+		return nil, fmt.Errorf("circular module dependency detected: %s", findDependencyCycle(inDegree))
+	}
+	return sorted, nil
+}
+
+// findDependencyCycle 在拓扑排序剩余的 Module 中找出一条循环依赖路径
+// 调用方需持有 modulesMu
+func findDependencyCycle(inDegree map[ModuleID]int) string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[ModuleID]int)
+	stack := make([]ModuleID, 0)
+
+	var cycle []ModuleID
+	var visit func(id ModuleID) bool
+	visit = func(id ModuleID) bool {
+		state[id] = visiting
+		stack = append(stack, id)
+		for _, dep := range modules[string(id)].Dependencies {
+			switch state[dep] {
+			case visiting:
+				// found a back edge, cut the cycle out of the stack
+				for i, s := range stack {
+					if s == dep {
+						cycle = append(append(cycle, stack[i:]...), dep)
+						return true
+					}
+				}
+			case unvisited:
+				if visit(dep) {
+					return true
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = visited
+		return false
+	}
+
+	// only modules left with in-degree > 0 can be part of a cycle
+	ids := make([]ModuleID, 0)
+	for id, d := range inDegree {
+		if d > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if state[id] == unvisited && visit(id) {
+			break
+		}
+	}
+
+	parts := make([]string, 0, len(cycle))
+	for _, id := range cycle {
+		parts = append(parts, string(id))
+	}
+	return strings.Join(parts, " -> ")
+}
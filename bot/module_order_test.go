@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+// withModules 将已注册的 Module 临时替换为 infos，测试结束后恢复
+func withModules(t *testing.T, infos ...ModuleInfo) {
+	t.Helper()
+	modulesMu.Lock()
+	saved := modules
+	modules = make(map[string]ModuleInfo, len(infos))
+	for _, mi := range infos {
+		modules[string(mi.ID)] = mi
+	}
+	modulesMu.Unlock()
+	t.Cleanup(func() {
+		modulesMu.Lock()
+		modules = saved
+		modulesMu.Unlock()
+	})
+}
+
+func deps(ids ...ModuleID) []ModuleID {
+	return ids
+}
+
+func TestSortModules(t *testing.T) {
+	tests := []struct {
+		name    string
+		infos   []ModuleInfo
+		want    []ModuleID
+		wantErr string
+	}{
+		{
+			name: "no dependency sorted by id",
+			infos: []ModuleInfo{
+				{ID: "c"}, {ID: "a"}, {ID: "b"},
+			},
+			want: []ModuleID{"a", "b", "c"},
+		},
+		{
+			name: "priority first",
+			infos: []ModuleInfo{
+				{ID: "a"}, {ID: "logging", Priority: 100}, {ID: "b", Priority: -1},
+			},
+			want: []ModuleID{"logging", "a", "b"},
+		},
+		{
+			name: "dependencies before dependents",
+			infos: []ModuleInfo{
+				{ID: "bili", Dependencies: deps("shell")},
+				{ID: "diary", Dependencies: deps("shell")},
+				{ID: "shell"},
+				{ID: "app", Dependencies: deps("bili", "diary")},
+			},
+			want: []ModuleID{"shell", "bili", "diary", "app"},
+		},
+		{
+			name: "priority never overrides dependencies",
+			infos: []ModuleInfo{
+				{ID: "a", Priority: 100, Dependencies: deps("b")},
+				{ID: "b"},
+				{ID: "c", Priority: 50},
+			},
+			want: []ModuleID{"c", "b", "a"},
+		},
+		{
+			name: "priority among ready modules",
+			infos: []ModuleInfo{
+				{ID: "base"},
+				{ID: "x", Dependencies: deps("base")},
+				{ID: "y", Priority: 10, Dependencies: deps("base")},
+				{ID: "z", Priority: 5},
+			},
+			want: []ModuleID{"z", "base", "y", "x"},
+		},
+		{
+			name:    "missing dependency",
+			infos:   []ModuleInfo{{ID: "bili", Dependencies: deps("shell")}},
+			wantErr: "module bili depends on unregistered module shell",
+		},
+		{
+			name:    "self dependency",
+			infos:   []ModuleInfo{{ID: "a", Dependencies: deps("a")}},
+			wantErr: "module a depends on itself",
+		},
+		{
+			name: "cycle",
+			infos: []ModuleInfo{
+				{ID: "a", Dependencies: deps("b")},
+				{ID: "b", Dependencies: deps("c")},
+				{ID: "c", Dependencies: deps("a")},
+				{ID: "d"},
+			},
+			wantErr: "circular module dependency detected: a -> b -> c -> a",
+		},
+		{
+			name: "cycle behind a dependent",
+			infos: []ModuleInfo{
+				{ID: "a", Dependencies: deps("b")},
+				{ID: "b", Dependencies: deps("c")},
+				{ID: "c", Dependencies: deps("b")},
+			},
+			wantErr: "circular module dependency detected: b -> c -> b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withModules(t, tt.infos...)
+			sorted, err := sortModules()
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(sorted))
+			for _, mi := range sorted {
+				got = append(got, string(mi.ID))
+			}
+			want := make([]string, 0, len(tt.want))
+			for _, id := range tt.want {
+				want = append(want, string(id))
+			}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("expected order %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestFindDependencyCycle(t *testing.T) {
+	withModules(t,
+		ModuleInfo{ID: "a", Dependencies: deps("b")},
+		ModuleInfo{ID: "b", Dependencies: deps("c", "d")},
+		ModuleInfo{ID: "c"},
+		ModuleInfo{ID: "d", Dependencies: deps("b")},
+	)
+
+	tests := []struct {
+		name     string
+		inDegree map[ModuleID]int
+		want     string
+	}{
+		{"cycle reached from a dependent", map[ModuleID]int{"a": 1, "b": 1, "d": 1}, "b -> d -> b"},
+		{"modules done are skipped", map[ModuleID]int{"a": 0, "b": 1, "c": 0, "d": 1}, "b -> d -> b"},
+		{"no cycle", map[ModuleID]int{"a": 0, "c": 0}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findDependencyCycle(tt.inDegree); got != tt.want {
+				t.Fatalf("expected cycle %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
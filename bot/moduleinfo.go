@@ -8,6 +8,16 @@ type ModuleInfo struct {
 
 	// Instance 返回 Module
 	Instance Module
+
+	// Dependencies 依赖的其他 Module
+	// StartService 保证被依赖的 Module 先于本 Module 完成各阶段的生命周期
+	// 并在 Stop 时晚于本 Module 停止
+	Dependencies []ModuleID
+
+	// Priority 优先级
+	// 在依赖关系允许的前提下，Priority 越大的 Module 越先启动
+	// 相同 Priority 的 Module 按 ID 排序
+	Priority int
 }
 
 func (mi ModuleInfo) String() string {
@@ -0,0 +1,453 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mrs4s/MiraiGo/message"
+	"github.com/zhouziqunzzq/MiraiGo-DD/config"
+)
+
+// Priority 发送优先级
+// 高优先级的消息总是先于低优先级的消息发送
+type Priority int
+
+const (
+	// PriorityHigh 管理命令的回复等
+	PriorityHigh Priority = iota
+	// PriorityNormal 普通命令的回复、聊天等
+	PriorityNormal
+	// PriorityLow 开播提醒、弹幕中继等广播
+	PriorityLow
+
+	numPriorities = 3
+)
+
+// SenderConfig 消息发送队列配置
+// 对应全局配置中的 bot.sender
+type SenderConfig struct {
+	GlobalRate     float64       // 全局每秒发送的消息数
+	GlobalBurst    int           // 全局允许的突发消息数
+	TargetRate     float64       // 每个群（或私聊对象）每秒发送的消息数
+	TargetBurst    int           // 每个群（或私聊对象）允许的突发消息数
+	QueueSize      int           // 每个优先级的队列长度，队列满时新消息被丢弃
+	MaxRetries     int           // 发送失败后的最大重试次数
+	RetryBaseDelay time.Duration // 首次重试前的等待时间，此后每次翻倍
+}
+
+func loadSenderConfig() SenderConfig {
+	c := SenderConfig{
+		GlobalRate:     5,
+		GlobalBurst:    10,
+		TargetRate:     1,
+		TargetBurst:    5,
+		QueueSize:      100,
+		MaxRetries:     3,
+		RetryBaseDelay: 2 * time.Second,
+	}
+	if config.GlobalConfig == nil {
+		return c
+	}
+	g := config.GlobalConfig
+	if g.IsSet("bot.sender.global_rate") {
+		c.GlobalRate = g.GetFloat64("bot.sender.global_rate")
+	}
+	if g.IsSet("bot.sender.global_burst") {
+		c.GlobalBurst = g.GetInt("bot.sender.global_burst")
+	}
+	if g.IsSet("bot.sender.target_rate") {
+		c.TargetRate = g.GetFloat64("bot.sender.target_rate")
+	}
+	if g.IsSet("bot.sender.target_burst") {
+		c.TargetBurst = g.GetInt("bot.sender.target_burst")
+	}
+	if g.IsSet("bot.sender.queue_size") {
+		c.QueueSize = g.GetInt("bot.sender.queue_size")
+	}
+	if g.IsSet("bot.sender.max_retries") {
+		c.MaxRetries = g.GetInt("bot.sender.max_retries")
+	}
+	if g.IsSet("bot.sender.retry_base_delay") {
+		c.RetryBaseDelay = g.GetDuration("bot.sender.retry_base_delay")
+	}
+	return c
+}
+
+// SenderStats 消息发送统计
+type SenderStats struct {
+	Sent    uint64 // 发送成功的消息数
+	Retried uint64 // 重试次数
+	Failed  uint64 // 重试耗尽后仍发送失败的消息数
+	Dropped uint64 // 因队列已满被丢弃的消息数
+	Queued  [numPriorities]int
+}
+
+// ======== token bucket ========
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+}
+
+// wait 距离下一个令牌可用所需的时间，0 表示当前可用
+func (tb *tokenBucket) wait(now time.Time) time.Duration {
+	tb.refill(now)
+	if tb.tokens >= 1 {
+		return 0
+	}
+	if tb.rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+func (tb *tokenBucket) take() {
+	tb.tokens--
+}
+
+// ======== sender ========
+
+type outgoingKind int
+
+const (
+	outgoingGroup outgoingKind = iota
+	outgoingPrivate
+	outgoingTemp
+)
+
+type targetKey struct {
+	kind outgoingKind
+	id   int64
+}
+
+func (k targetKey) String() string {
+	switch k.kind {
+	case outgoingGroup:
+		return fmt.Sprintf("group %d", k.id)
+	case outgoingPrivate:
+		return fmt.Sprintf("user %d", k.id)
+	default:
+		return fmt.Sprintf("temp session with user %d", k.id)
+	}
+}
+
+type outgoingMsg struct {
+	kind      outgoingKind
+	groupCode int64
+	target    int64
+	msg       *message.SendingMessage
+	priority  Priority
+	attempts  int
+	notBefore time.Time
+}
+
+func (o *outgoingMsg) key() targetKey {
+	if o.kind == outgoingGroup {
+		return targetKey{kind: o.kind, id: o.groupCode}
+	}
+	return targetKey{kind: o.kind, id: o.target}
+}
+
+// Sender 统一的消息发送队列
+// 按优先级排队，使用全局及每个目标各自的令牌桶限流，发送失败时以指数退避重试
+type Sender struct {
+	config SenderConfig
+
+	mu            sync.Mutex
+	lanes         [numPriorities][]*outgoingMsg // mu protected
+	globalBucket  *tokenBucket                  // mu protected
+	targetBuckets map[targetKey]*tokenBucket    // mu protected
+	stopped       bool                          // mu protected, no message is accepted once stopped
+
+	wake chan struct{}
+	quit chan struct{}
+	wg   sync.WaitGroup
+
+	sent, retried, failed, dropped uint64
+}
+
+func newSender(c SenderConfig) *Sender {
+	return &Sender{
+		config:        c,
+		globalBucket:  newTokenBucket(c.GlobalRate, c.GlobalBurst),
+		targetBuckets: make(map[targetKey]*tokenBucket),
+		wake:          make(chan struct{}, 1),
+		quit:          make(chan struct{}),
+	}
+}
+
+// SendGroupMessage 将群消息加入发送队列
+// 队列已满或已停止时丢弃并返回 false
+func (s *Sender) SendGroupMessage(groupCode int64, m *message.SendingMessage, p Priority) bool {
+	return s.enqueue(&outgoingMsg{kind: outgoingGroup, groupCode: groupCode, msg: m}, p)
+}
+
+// SendPrivateMessage 将私聊消息加入发送队列
+// 队列已满或已停止时丢弃并返回 false
+func (s *Sender) SendPrivateMessage(target int64, m *message.SendingMessage, p Priority) bool {
+	return s.enqueue(&outgoingMsg{kind: outgoingPrivate, target: target, msg: m}, p)
+}
+
+// SendGroupTempMessage 将群临时会话消息加入发送队列
+// 队列已满或已停止时丢弃并返回 false
+func (s *Sender) SendGroupTempMessage(groupCode, target int64, m *message.SendingMessage, p Priority) bool {
+	return s.enqueue(&outgoingMsg{kind: outgoingTemp, groupCode: groupCode, target: target, msg: m}, p)
+}
+
+// Stats 获取发送统计
+func (s *Sender) Stats() SenderStats {
+	st := SenderStats{
+		Sent:    atomic.LoadUint64(&s.sent),
+		Retried: atomic.LoadUint64(&s.retried),
+		Failed:  atomic.LoadUint64(&s.failed),
+		Dropped: atomic.LoadUint64(&s.dropped),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.lanes {
+		st.Queued[i] = len(s.lanes[i])
+	}
+	return st
+}
+
+func (s *Sender) enqueue(o *outgoingMsg, p Priority) bool {
+	if p < PriorityHigh || p >= numPriorities {
+		p = PriorityNormal
+	}
+	o.priority = p
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		atomic.AddUint64(&s.dropped, 1)
+		logger.Warn("sender already stopped, dropping message")
+		return false
+	}
+	if len(s.lanes[p]) >= s.config.QueueSize {
+		s.mu.Unlock()
+		atomic.AddUint64(&s.dropped, 1)
+		logger.Warnf("sender queue of priority %d is full, dropping message", p)
+		return false
+	}
+	s.lanes[p] = append(s.lanes[p], o)
+	s.mu.Unlock()
+
+	s.notify()
+	return true
+}
+
+func (s *Sender) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next 取出下一条可以发送的消息
+// 无可发送的消息时返回 nil 及需等待的时间
+func (s *Sender) next(now time.Time) (*outgoingMsg, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := time.Duration(math.MaxInt64)
+	if w := s.globalBucket.wait(now); w > 0 {
+		// nothing can be sent before the global bucket refills
+		for _, lane := range s.lanes {
+			if len(lane) > 0 {
+				return nil, w
+			}
+		}
+		return nil, wait
+	}
+
+	// Note: a message waiting to be retried holds back the later ones to the same target
+	// in its lane and lower ones, so that messages to a target are sent in order
+	blocked := make(map[targetKey]bool)
+	for p := range s.lanes {
+		for i, o := range s.lanes[p] {
+			if blocked[o.key()] {
+				continue
+			}
+			if o.notBefore.After(now) {
+				wait = minDuration(wait, o.notBefore.Sub(now))
+				blocked[o.key()] = true
+				continue
+			}
+			tb, ok := s.targetBuckets[o.key()]
+			if !ok {
+				tb = newTokenBucket(s.config.TargetRate, s.config.TargetBurst)
+				s.targetBuckets[o.key()] = tb
+			}
+			if w := tb.wait(now); w > 0 {
+				wait = minDuration(wait, w)
+				continue
+			}
+
+			tb.take()
+			s.globalBucket.take()
+			s.lanes[p] = append(s.lanes[p][:i:i], s.lanes[p][i+1:]...)
+			return o, 0
+		}
+	}
+	return nil, wait
+}
+
+func (s *Sender) run() {
+	defer s.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		o, wait := s.next(time.Now())
+		if o != nil {
+			s.deliver(o)
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *Sender) deliver(o *outgoingMsg) {
+	c := Instance.Client()
+	ok := false
+	switch o.kind {
+	case outgoingGroup:
+		ok = c.SendGroupMessage(o.groupCode, o.msg) != nil
+	case outgoingPrivate:
+		ok = c.SendPrivateMessage(o.target, o.msg) != nil
+	case outgoingTemp:
+		ok = c.SendGroupTempMessage(o.groupCode, o.target, o.msg) != nil
+	}
+	if ok {
+		atomic.AddUint64(&s.sent, 1)
+		return
+	}
+
+	o.attempts++
+	if o.attempts > s.config.MaxRetries {
+		atomic.AddUint64(&s.failed, 1)
+		logger.Errorf("failed to send message to %s after %d attempts", o.key(), o.attempts)
+		return
+	}
+	atomic.AddUint64(&s.retried, 1)
+	o.notBefore = time.Now().Add(s.config.RetryBaseDelay << (o.attempts - 1))
+	logger.Warnf("failed to send message to %s, retrying (%d/%d)", o.key(), o.attempts, s.config.MaxRetries)
+
+	// retry at the head of its own lane, newer messages to the same target wait for it
+	s.mu.Lock()
+	s.lanes[o.priority] = append([]*outgoingMsg{o}, s.lanes[o.priority]...)
+	s.mu.Unlock()
+}
+
+func (s *Sender) start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// stop 停止发送，队列中剩余的消息及此后加入的消息将被丢弃
+func (s *Sender) stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	s.mu.Unlock()
+
+	close(s.quit)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remaining := 0
+	for p := range s.lanes {
+		remaining += len(s.lanes[p])
+		s.lanes[p] = nil
+	}
+	if remaining > 0 {
+		atomic.AddUint64(&s.dropped, uint64(remaining))
+		logger.Warnf("sender stopped with %d messages unsent", remaining)
+	}
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ======== package level helpers ========
+
+// Sender 获取 Bot 的消息发送队列
+func (b *Bot) Sender() *Sender {
+	return b.sender
+}
+
+// globalSender 获取全局 Bot 的发送队列，Bot 未启动时返回 nil
+func globalSender() *Sender {
+	if Instance == nil || Instance.sender == nil {
+		logger.Warn("bot not started yet, dropping message")
+		return nil
+	}
+	return Instance.sender
+}
+
+// SendGroupMessage 通过全局 Bot 的发送队列发送群消息
+// Bot 未启动时丢弃并返回 false
+func SendGroupMessage(groupCode int64, m *message.SendingMessage, p Priority) bool {
+	if s := globalSender(); s != nil {
+		return s.SendGroupMessage(groupCode, m, p)
+	}
+	return false
+}
+
+// SendPrivateMessage 通过全局 Bot 的发送队列发送私聊消息
+// Bot 未启动时丢弃并返回 false
+func SendPrivateMessage(target int64, m *message.SendingMessage, p Priority) bool {
+	if s := globalSender(); s != nil {
+		return s.SendPrivateMessage(target, m, p)
+	}
+	return false
+}
+
+// SendGroupTempMessage 通过全局 Bot 的发送队列发送群临时会话消息
+// Bot 未启动时丢弃并返回 false
+func SendGroupTempMessage(groupCode, target int64, m *message.SendingMessage, p Priority) bool {
+	if s := globalSender(); s != nil {
+		return s.SendGroupTempMessage(groupCode, target, m, p)
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mrs4s/MiraiGo/client"
+	"github.com/Mrs4s/MiraiGo/message"
+)
+
+// flakyClient 第一次发送失败，此后按顺序记录发送的消息文本
+type flakyClient struct {
+	mu     sync.Mutex
+	failed bool
+	sent   []string
+}
+
+func (c *flakyClient) send(m *message.SendingMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.failed {
+		c.failed = true
+		return false
+	}
+	c.sent = append(c.sent, m.Elements[0].(*message.TextElement).Content)
+	return true
+}
+
+func (c *flakyClient) SendGroupMessage(groupCode int64, m *message.SendingMessage) *message.GroupMessage {
+	if !c.send(m) {
+		return nil
+	}
+	return &message.GroupMessage{GroupCode: groupCode}
+}
+
+func (c *flakyClient) SendPrivateMessage(target int64, m *message.SendingMessage) *message.PrivateMessage {
+	if !c.send(m) {
+		return nil
+	}
+	return &message.PrivateMessage{Target: target}
+}
+
+func (c *flakyClient) SendGroupTempMessage(groupCode, _ int64, m *message.SendingMessage) *message.TempMessage {
+	if !c.send(m) {
+		return nil
+	}
+	return &message.TempMessage{GroupCode: groupCode}
+}
+
+func (c *flakyClient) UploadGroupImage(int64, io.ReadSeeker, ...int) (*message.GroupImageElement, error) {
+	return &message.GroupImageElement{}, nil
+}
+
+func (c *flakyClient) FindGroup(int64) *client.GroupInfo { return nil }
+func (c *flakyClient) IsOnline() bool                    { return true }
+func (c *flakyClient) BotUin() int64                     { return 0 }
+
+func (c *flakyClient) Sent() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.sent...)
+}
+
+func TestSenderRetryKeepsOrderPerTarget(t *testing.T) {
+	c := &flakyClient{}
+	old := Instance
+	Instance = &Bot{client: c}
+	defer func() { Instance = old }()
+
+	s := newSender(SenderConfig{
+		GlobalRate:     1000,
+		GlobalBurst:    1000,
+		TargetRate:     1000,
+		TargetBurst:    1000,
+		QueueSize:      10,
+		MaxRetries:     3,
+		RetryBaseDelay: 50 * time.Millisecond,
+	})
+	s.start()
+	defer s.stop()
+
+	for _, text := range []string{"1", "2", "3"} {
+		s.SendGroupMessage(1, message.NewSendingMessage().Append(message.NewText(text)), PriorityLow)
+	}
+	// another target is not held back by the retry
+	s.SendGroupMessage(2, message.NewSendingMessage().Append(message.NewText("other")), PriorityLow)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(c.Sent()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sent := c.Sent()
+	want := []string{"other", "1", "2", "3"}
+	if len(sent) != len(want) {
+		t.Fatalf("expected %v, got %v", want, sent)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, sent)
+		}
+	}
+}
+
+func TestSenderRejectsAfterStop(t *testing.T) {
+	c := &flakyClient{}
+	old := Instance
+	Instance = &Bot{client: c}
+	defer func() { Instance = old }()
+
+	s := newSender(SenderConfig{QueueSize: 10, GlobalRate: 1000, GlobalBurst: 1000, TargetRate: 1000, TargetBurst: 1000})
+	s.start()
+	s.stop()
+	// stopping again is harmless
+	s.stop()
+
+	msg := message.NewSendingMessage().Append(message.NewText("late"))
+	if s.SendGroupMessage(1, msg, PriorityHigh) {
+		t.Fatal("expected a group message to be rejected after stopping")
+	}
+	if s.SendPrivateMessage(1, msg, PriorityNormal) {
+		t.Fatal("expected a private message to be rejected after stopping")
+	}
+	if s.SendGroupTempMessage(1, 2, msg, PriorityLow) {
+		t.Fatal("expected a temp message to be rejected after stopping")
+	}
+	st := s.Stats()
+	if st.Dropped != 3 {
+		t.Fatalf("expected 3 dropped messages, got %d", st.Dropped)
+	}
+	for p, n := range st.Queued {
+		if n != 0 {
+			t.Fatalf("expected nothing queued, got %d of priority %d", n, p)
+		}
+	}
+}
+
+func TestSendWithoutSender(t *testing.T) {
+	old := Instance
+	defer func() { Instance = old }()
+
+	msg := message.NewSendingMessage().Append(message.NewText("early"))
+	for _, b := range []*Bot{nil, {}} {
+		Instance = b
+		if SendGroupMessage(1, msg, PriorityNormal) {
+			t.Fatal("expected SendGroupMessage to fail without a sender")
+		}
+		if SendPrivateMessage(1, msg, PriorityNormal) {
+			t.Fatal("expected SendPrivateMessage to fail without a sender")
+		}
+		if SendGroupTempMessage(1, 2, msg, PriorityNormal) {
+			t.Fatal("expected SendGroupTempMessage to fail without a sender")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package simulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultConsoleGroupCode int64 = 100000
+	DefaultConsoleUserUin   int64 = 100001
+
+	consoleHelpInfo = "用法：\n" +
+		"  :group <群号>   切换至群聊\n" +
+		"  :temp <群号>    切换至群临时会话\n" +
+		"  :private        切换至私聊\n" +
+		"  :user <QQ号>    切换发送者\n" +
+		"  :help           显示帮助信息\n" +
+		"  :quit           退出\n" +
+		"其余输入将以当前发送者的身份发送至当前会话"
+)
+
+type consoleSession struct {
+	kind      MessageKind
+	groupCode int64
+	userUin   int64
+}
+
+func (s *consoleSession) prompt() string {
+	switch s.kind {
+	case GroupMsg:
+		return fmt.Sprintf("[group %d / user %d]> ", s.groupCode, s.userUin)
+	case TempMsg:
+		return fmt.Sprintf("[temp %d / user %d]> ", s.groupCode, s.userUin)
+	default:
+		return fmt.Sprintf("[private / user %d]> ", s.userUin)
+	}
+}
+
+// RunConsole 以离线模式启动所有 Module，并从 in 中逐行读取模拟消息
+// Bot 发出的消息输出至 out，读取到 EOF 或 :quit 时停止所有 Module 并返回
+// 需在调用前初始化全局配置
+func RunConsole(in io.Reader, out io.Writer) {
+	var outMu sync.Mutex
+	printf := func(format string, a ...interface{}) {
+		outMu.Lock()
+		defer outMu.Unlock()
+		_, _ = fmt.Fprintf(out, format, a...)
+	}
+
+	// Note: set before starting so that messages sent by modules on starting are printed as well
+	c := NewFakeClient(DefaultSelfUin)
+	c.SetOnSend(func(msg *SentMessage) {
+		printf("\n<< %s\n", msg)
+	})
+	h := StartWithClient(c)
+	defer h.Close()
+
+	session := &consoleSession{
+		kind:      GroupMsg,
+		groupCode: DefaultConsoleGroupCode,
+		userUin:   DefaultConsoleUserUin,
+	}
+	printf("%s\n", consoleHelpInfo)
+
+	scanner := bufio.NewScanner(in)
+	for {
+		printf("%s", session.prompt())
+		if !scanner.Scan() {
+			printf("\n")
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		if !strings.HasPrefix(line, ":") {
+			switch session.kind {
+			case GroupMsg:
+				h.InjectGroupMessage(session.groupCode, session.userUin, line)
+			case TempMsg:
+				h.InjectTempMessage(session.groupCode, session.userUin, line)
+			default:
+				h.InjectPrivateMessage(session.userUin, line)
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case ":quit":
+			return
+		case ":help":
+			printf("%s\n", consoleHelpInfo)
+		case ":private":
+			session.kind = PrivateMsg
+		case ":group", ":temp", ":user":
+			if len(fields) != 2 {
+				printf("参数错误，用法：%s <号码>\n", fields[0])
+				continue
+			}
+			n, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				printf("无效的号码：%s\n", fields[1])
+				continue
+			}
+			switch fields[0] {
+			case ":group":
+				session.kind, session.groupCode = GroupMsg, n
+			case ":temp":
+				session.kind, session.groupCode = TempMsg, n
+			case ":user":
+				session.userUin = n
+			}
+		default:
+			printf("未知指令 %s，输入 :help 查看帮助\n", fields[0])
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mrs4s/MiraiGo/client"
+	"github.com/Mrs4s/MiraiGo/message"
+)
+
+// MessageKind 发出消息的类型
+type MessageKind int
+
+const (
+	GroupMsg MessageKind = iota
+	PrivateMsg
+	TempMsg
+)
+
+func (k MessageKind) String() string {
+	switch k {
+	case GroupMsg:
+		return "group"
+	case PrivateMsg:
+		return "private"
+	case TempMsg:
+		return "temp"
+	default:
+		return "unknown"
+	}
+}
+
+// SentMessage 一条由 Bot 发出的消息
+type SentMessage struct {
+	Kind      MessageKind
+	GroupCode int64 // GroupMsg, TempMsg
+	Target    int64 // PrivateMsg, TempMsg
+	Message   *message.SendingMessage
+	Time      time.Time
+}
+
+// Text 消息的文本表示，非文本元素以占位符表示
+func (m *SentMessage) Text() string {
+	sb := strings.Builder{}
+	for _, elem := range m.Message.Elements {
+		switch e := elem.(type) {
+		case *message.TextElement:
+			sb.WriteString(e.Content)
+		case *message.GroupImageElement:
+			sb.WriteString(fmt.Sprintf("[图片 %d bytes]", e.Size))
+		case *message.AtElement:
+			if e.Target == 0 {
+				sb.WriteString("@全体成员")
+			} else {
+				sb.WriteString(fmt.Sprintf("@%d", e.Target))
+			}
+		default:
+			sb.WriteString(fmt.Sprintf("[%T]", elem))
+		}
+	}
+	return sb.String()
+}
+
+func (m *SentMessage) String() string {
+	switch m.Kind {
+	case GroupMsg:
+		return fmt.Sprintf("[group %d] %s", m.GroupCode, m.Text())
+	case PrivateMsg:
+		return fmt.Sprintf("[private %d] %s", m.Target, m.Text())
+	default:
+		return fmt.Sprintf("[temp %d/%d] %s", m.GroupCode, m.Target, m.Text())
+	}
+}
+
+// FakeClient 不连接 QQ 服务器的 bot.Client 实现
+// 记录所有发出的消息，供测试断言或在终端中展示
+type FakeClient struct {
+	// SelfUin Bot 自身的 QQ 号
+	SelfUin int64
+
+	mu     sync.Mutex
+	onSend func(msg *SentMessage)
+	sent   []*SentMessage
+	groups map[int64]*client.GroupInfo
+	online bool
+	notify chan struct{}
+}
+
+func NewFakeClient(selfUin int64) *FakeClient {
+	return &FakeClient{
+		SelfUin: selfUin,
+		sent:    make([]*SentMessage, 0),
+		groups:  make(map[int64]*client.GroupInfo),
+		online:  true,
+		notify:  make(chan struct{}),
+	}
+}
+
+// AddGroup 添加一个群及其成员权限，供 FindGroup 查询
+func (c *FakeClient) AddGroup(code int64, name string, members map[int64]client.MemberPermission) *client.GroupInfo {
+	g := &client.GroupInfo{
+		Uin:     code,
+		Code:    code,
+		Name:    name,
+		Members: make([]*client.GroupMemberInfo, 0, len(members)),
+	}
+	for uin, perm := range members {
+		g.Members = append(g.Members, &client.GroupMemberInfo{
+			Group:      g,
+			Uin:        uin,
+			Permission: perm,
+		})
+	}
+	// GroupInfo.FindMember does a binary search on Uin
+	sort.Slice(g.Members, func(i, j int) bool {
+		return g.Members[i].Uin < g.Members[j].Uin
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.groups[code] = g
+	return g
+}
+
+// SetOnSend 设置每发出一条消息后调用的函数，可为 nil
+// 应在启动 Module 前设置，否则启动过程中发出的消息不会经过 fn
+func (c *FakeClient) SetOnSend(fn func(msg *SentMessage)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onSend = fn
+}
+
+// SetOnline 设置 IsOnline 的返回值
+func (c *FakeClient) SetOnline(online bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.online = online
+}
+
+// Sent 返回目前为止发出的所有消息
+func (c *FakeClient) Sent() []*SentMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rst := make([]*SentMessage, len(c.sent))
+	copy(rst, c.sent)
+	return rst
+}
+
+// Reset 清空已记录的消息
+func (c *FakeClient) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = make([]*SentMessage, 0)
+}
+
+// WaitForMessages 等待直至共记录了至少 n 条消息或超时
+func (c *FakeClient) WaitForMessages(n int, timeout time.Duration) ([]*SentMessage, error) {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		if len(c.sent) >= n {
+			rst := make([]*SentMessage, len(c.sent))
+			copy(rst, c.sent)
+			c.mu.Unlock()
+			return rst, nil
+		}
+		notify := c.notify
+		got := len(c.sent)
+		c.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return c.Sent(), fmt.Errorf("timeout waiting for %d messages, got %d", n, got)
+		}
+	}
+}
+
+func (c *FakeClient) record(msg *SentMessage) {
+	msg.Time = time.Now()
+	c.mu.Lock()
+	c.sent = append(c.sent, msg)
+	// wake up all waiters
+	close(c.notify)
+	c.notify = make(chan struct{})
+	onSend := c.onSend
+	c.mu.Unlock()
+
+	if onSend != nil {
+		onSend(msg)
+	}
+}
+
+func (c *FakeClient) SendGroupMessage(groupCode int64, m *message.SendingMessage) *message.GroupMessage {
+	c.record(&SentMessage{Kind: GroupMsg, GroupCode: groupCode, Message: m})
+	return &message.GroupMessage{
+		GroupCode: groupCode,
+		Sender:    &message.Sender{Uin: c.SelfUin},
+		Time:      int32(time.Now().Unix()),
+		Elements:  m.Elements,
+	}
+}
+
+func (c *FakeClient) SendPrivateMessage(target int64, m *message.SendingMessage) *message.PrivateMessage {
+	c.record(&SentMessage{Kind: PrivateMsg, Target: target, Message: m})
+	return &message.PrivateMessage{
+		Self:     c.SelfUin,
+		Target:   target,
+		Time:     int32(time.Now().Unix()),
+		Sender:   &message.Sender{Uin: c.SelfUin},
+		Elements: m.Elements,
+	}
+}
+
+func (c *FakeClient) SendGroupTempMessage(groupCode, target int64, m *message.SendingMessage) *message.TempMessage {
+	c.record(&SentMessage{Kind: TempMsg, GroupCode: groupCode, Target: target, Message: m})
+	return &message.TempMessage{
+		GroupCode: groupCode,
+		Self:      c.SelfUin,
+		Sender:    &message.Sender{Uin: c.SelfUin},
+		Elements:  m.Elements,
+	}
+}
+
+func (c *FakeClient) UploadGroupImage(groupCode int64, img io.ReadSeeker, _ ...int) (*message.GroupImageElement, error) {
+	b, err := io.ReadAll(img)
+	if err != nil {
+		return nil, err
+	}
+	return &message.GroupImageElement{
+		Size: int32(len(b)),
+	}, nil
+}
+
+func (c *FakeClient) FindGroup(code int64) *client.GroupInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.groups[code]
+}
+
+func (c *FakeClient) BotUin() int64 {
+	return c.SelfUin
+}
+
+func (c *FakeClient) IsOnline() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.online
+}
@@ -0,0 +1,115 @@
+package simulator
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/Mrs4s/MiraiGo/client"
+	"github.com/Mrs4s/MiraiGo/message"
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+	"github.com/zhouziqunzzq/MiraiGo-DD/config"
+)
+
+// DefaultSelfUin 模拟 Bot 的 QQ 号
+const DefaultSelfUin int64 = 10000
+
+// Harness 离线运行所有已注册 Module 的模拟环境
+// 可向 Module 注入模拟的消息事件，并通过 Client 获取 Bot 发出的消息
+type Harness struct {
+	Client *FakeClient
+	Bot    *bot.Bot
+
+	msgSeq int32
+}
+
+// NewHarness 使用 yaml 格式的全局配置 appConfig 启动所有已注册的 Module
+// 全局配置的格式与 application.yaml 相同，可省略 bot 部分
+func NewHarness(appConfig []byte) (*Harness, error) {
+	if err := config.InitWithContent(appConfig); err != nil {
+		return nil, err
+	}
+	return Start(), nil
+}
+
+// Start 使用已初始化的全局配置启动所有已注册的 Module
+func Start() *Harness {
+	return StartWithClient(NewFakeClient(DefaultSelfUin))
+}
+
+// StartWithClient 与 Start 相同，但使用预先设置好的 c，例如已通过 SetOnSend 设置回调
+func StartWithClient(c *FakeClient) *Harness {
+	bot.InitOffline(c)
+	bot.StartService()
+
+	return &Harness{
+		Client: c,
+		Bot:    bot.Instance,
+	}
+}
+
+// Close 停止所有 Module
+func (h *Harness) Close() {
+	bot.Stop()
+}
+
+func (h *Harness) nextMsgId() int32 {
+	return atomic.AddInt32(&h.msgSeq, 1)
+}
+
+// InjectGroupMessage 模拟群 groupCode 中的 senderUin 发送了一条文本消息
+func (h *Harness) InjectGroupMessage(groupCode, senderUin int64, text string) *message.GroupMessage {
+	return h.InjectGroupMessageElements(groupCode, senderUin, message.NewText(text))
+}
+
+// InjectGroupMessageElements 模拟群 groupCode 中的 senderUin 发送了一条由 elems 组成的消息
+func (h *Harness) InjectGroupMessageElements(groupCode, senderUin int64, elems ...message.IMessageElement) *message.GroupMessage {
+	msg := &message.GroupMessage{
+		Id:         h.nextMsgId(),
+		InternalId: h.nextMsgId(),
+		GroupCode:  groupCode,
+		Sender:     &message.Sender{Uin: senderUin},
+		Time:       int32(time.Now().Unix()),
+		Elements:   elems,
+	}
+	if g := h.Client.FindGroup(groupCode); g != nil {
+		msg.GroupName = g.Name
+	}
+	h.Bot.GroupMessageEvent.Dispatch(h.Client, msg)
+	return msg
+}
+
+// InjectPrivateMessage 模拟 senderUin 向 Bot 发送了一条私聊文本消息
+func (h *Harness) InjectPrivateMessage(senderUin int64, text string) *message.PrivateMessage {
+	msg := &message.PrivateMessage{
+		Id:         h.nextMsgId(),
+		InternalId: h.nextMsgId(),
+		Self:       h.Client.SelfUin,
+		Target:     h.Client.SelfUin,
+		Time:       int32(time.Now().Unix()),
+		Sender:     &message.Sender{Uin: senderUin, IsFriend: true},
+		Elements:   []message.IMessageElement{message.NewText(text)},
+	}
+	h.Bot.PrivateMessageEvent.Dispatch(h.Client, msg)
+	return msg
+}
+
+// InjectTempMessage 模拟群 groupCode 中的 senderUin 通过临时会话向 Bot 发送了一条文本消息
+func (h *Harness) InjectTempMessage(groupCode, senderUin int64, text string) *message.TempMessage {
+	msg := &message.TempMessage{
+		Id:        h.nextMsgId(),
+		GroupCode: groupCode,
+		Self:      h.Client.SelfUin,
+		Sender:    &message.Sender{Uin: senderUin},
+		Elements:  []message.IMessageElement{message.NewText(text)},
+	}
+	if g := h.Client.FindGroup(groupCode); g != nil {
+		msg.GroupName = g.Name
+	}
+	h.Bot.TempMessageEvent.Dispatch(h.Client, &client.TempMessageEvent{Message: msg})
+	return msg
+}
+
+// WaitForMessages 等待直至 Bot 共发出了至少 n 条消息或超时
+func (h *Harness) WaitForMessages(n int, timeout time.Duration) ([]*SentMessage, error) {
+	return h.Client.WaitForMessages(n, timeout)
+}
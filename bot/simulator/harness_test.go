@@ -0,0 +1,280 @@
+package simulator_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mrs4s/MiraiGo/client"
+	"github.com/Mrs4s/MiraiGo/message"
+	"github.com/sirupsen/logrus"
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot/simulator"
+	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/daredemo_suki"
+	_ "github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
+)
+
+const (
+	testGroupCode int64 = 200000
+	testUserUin   int64 = 200001
+	testAdminUin  int64 = 200009
+	waitTimeout         = 3 * time.Second
+)
+
+// h is shared by all tests since modules are registered only once per process
+var h *simulator.Harness
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(io.Discard)
+
+	dir, err := os.MkdirTemp("", "simulator_test")
+	if err != nil {
+		panic(err)
+	}
+	h, err = newTestHarness(dir)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		panic(err)
+	}
+
+	code := m.Run()
+	h.Close()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newTestHarness(dir string) (*simulator.Harness, error) {
+	imgPath := filepath.Join(dir, "dd_img")
+	if err := os.Mkdir(imgPath, 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(imgPath, "dd.png"), []byte("fake png"), 0o644); err != nil {
+		return nil, err
+	}
+
+	shellConfig := fmt.Sprintf(
+		"admin_id_list: [ %d ]\nperm_store_path: %s\naudit_log_path: ''\naliases: { 乒: ping, 乓: \"help ping\" }\n"+
+			"cmd_prefixes: [ /, ！ ]\nmention_trigger: true\n",
+		testAdminUin, filepath.Join(dir, "shell_perm.json"),
+	)
+	ddConfig := fmt.Sprintf(
+		"enabled_groups: [ %d ]\nimg_path: %s\nkeywords: [ \"单推\" ]\n",
+		testGroupCode, imgPath,
+	)
+	if err := os.WriteFile(filepath.Join(dir, "shell.yaml"), []byte(shellConfig), 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "dd.yaml"), []byte(ddConfig), 0o644); err != nil {
+		return nil, err
+	}
+
+	appConfig := fmt.Sprintf(`
+bot:
+  sender:
+    global_rate: 1000
+    global_burst: 1000
+    target_rate: 1000
+    target_burst: 1000
+modules:
+  shell:
+    is_enabled: true
+    config_path: %s
+  daredemo_suki:
+    is_enabled: true
+    config_path: %s
+`, filepath.Join(dir, "shell.yaml"), filepath.Join(dir, "dd.yaml"))
+	return simulator.NewHarness([]byte(appConfig))
+}
+
+// waitForNext 等待在已有消息之后 Bot 发出的下一条消息
+func waitForNext(t *testing.T, inject func()) *simulator.SentMessage {
+	t.Helper()
+	n := len(h.Client.Sent())
+	inject()
+	sent, err := h.WaitForMessages(n+1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sent[n]
+}
+
+func TestPingInGroup(t *testing.T) {
+	msg := waitForNext(t, func() {
+		h.InjectGroupMessage(testGroupCode, testUserUin, "/ping")
+	})
+	if msg.Kind != simulator.GroupMsg || msg.GroupCode != testGroupCode {
+		t.Fatalf("expected a reply in group %d, got %s", testGroupCode, msg)
+	}
+	if !strings.Contains(msg.Text(), "pong") {
+		t.Fatalf("expected pong, got %q", msg.Text())
+	}
+}
+
+func TestSukiKeyword(t *testing.T) {
+	msg := waitForNext(t, func() {
+		h.InjectGroupMessage(testGroupCode, testUserUin, "今天也要单推")
+	})
+	if msg.Kind != simulator.GroupMsg || msg.GroupCode != testGroupCode {
+		t.Fatalf("expected a meme in group %d, got %s", testGroupCode, msg)
+	}
+	if !strings.Contains(msg.Text(), "[图片") {
+		t.Fatalf("expected an image, got %q", msg.Text())
+	}
+}
+
+func TestSukiIgnoresOtherGroups(t *testing.T) {
+	expectNoReply(t, func() {
+		h.InjectGroupMessage(testGroupCode+1, testUserUin, "单推")
+	})
+}
+
+func TestShellCmdInPrivateChat(t *testing.T) {
+	msg := waitForNext(t, func() {
+		h.InjectPrivateMessage(testUserUin, "/ping")
+	})
+	if msg.Kind != simulator.PrivateMsg || msg.Target != testUserUin {
+		t.Fatalf("expected a private reply to %d, got %s", testUserUin, msg)
+	}
+	if !strings.Contains(msg.Text(), "pong") {
+		t.Fatalf("expected pong, got %q", msg.Text())
+	}
+}
+
+func TestGroupOwnerCannotActAcrossGroups(t *testing.T) {
+	gid := testGroupCode + 2
+	h.Client.AddGroup(gid, "owner test", map[int64]client.MemberPermission{
+		testUserUin: client.Owner,
+	})
+
+	msg := waitForNext(t, func() {
+		h.InjectGroupMessage(gid, testUserUin, "/module ls")
+	})
+	if !strings.Contains(msg.Text(), "权限不足") {
+		t.Fatalf("expected /module to be denied to a group owner, got %q", msg.Text())
+	}
+
+	msg = waitForNext(t, func() {
+		h.InjectGroupMessage(gid, testUserUin, fmt.Sprintf("/perm grant %d superadmin", testUserUin+1))
+	})
+	if !strings.Contains(msg.Text(), "参数错误") {
+		t.Fatalf("expected superadmin to be ungrantable, got %q", msg.Text())
+	}
+}
+
+func TestGroupFlagRejectedInGroupChat(t *testing.T) {
+	msg := waitForNext(t, func() {
+		h.InjectGroupMessage(testGroupCode, testUserUin, fmt.Sprintf("/ping --group=%d", testGroupCode+1))
+	})
+	if msg.GroupCode != testGroupCode || !strings.Contains(msg.Text(), "--group") {
+		t.Fatalf("expected --group to be rejected in group %d, got %s", testGroupCode, msg)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		want string
+	}{
+		{"cmd list", "/help", "ping - 检查 Bot 是否在线"},
+		{"builtin alias", "/帮助 ping", "检查 Bot 是否在线"},
+		{"configured alias", "/help 乒", "检查 Bot 是否在线"},
+		{"hidden cmd", "/help module", "没有找到命令 module"},
+		{"hidden sub cmd", "/help ls sender", "没有找到命令 ls sender"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := waitForNext(t, func() {
+				h.InjectGroupMessage(testGroupCode, testUserUin, tt.cmd)
+			})
+			if !strings.Contains(msg.Text(), tt.want) {
+				t.Fatalf("expected %q in the reply to %s, got %q", tt.want, tt.cmd, msg.Text())
+			}
+		})
+	}
+}
+
+// expectNoReply 检查注入消息后 Bot 没有回复
+func expectNoReply(t *testing.T, inject func()) {
+	t.Helper()
+	n := len(h.Client.Sent())
+	inject()
+	if sent, err := h.WaitForMessages(n+1, 200*time.Millisecond); err == nil {
+		t.Fatalf("expected no reply, got %s", sent[n])
+	}
+}
+
+func TestCmdTriggers(t *testing.T) {
+	tests := []struct {
+		name  string
+		elems []message.IMessageElement
+		want  string
+	}{
+		{"alias", []message.IMessageElement{message.NewText("/乒")}, "pong"},
+		{"alias with args", []message.IMessageElement{message.NewText("/乓")}, "检查 Bot 是否在线"},
+		{"second prefix", []message.IMessageElement{message.NewText("！ping")}, "pong"},
+		{"second prefix with alias", []message.IMessageElement{message.NewText("！乒")}, "pong"},
+		{"mention without prefix", []message.IMessageElement{
+			message.NewAt(h.Client.SelfUin), message.NewText(" ping"),
+		}, "pong"},
+		{"mention with prefix", []message.IMessageElement{
+			message.NewAt(h.Client.SelfUin), message.NewText(" /ping"),
+		}, "pong"},
+		{"mention with alias", []message.IMessageElement{
+			message.NewAt(h.Client.SelfUin), message.NewText("乒"),
+		}, "pong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := waitForNext(t, func() {
+				h.InjectGroupMessageElements(testGroupCode, testUserUin, tt.elems...)
+			})
+			if msg.GroupCode != testGroupCode || !strings.Contains(msg.Text(), tt.want) {
+				t.Fatalf("expected %q in group %d, got %s", tt.want, testGroupCode, msg)
+			}
+		})
+	}
+}
+
+func TestNotCmdTriggers(t *testing.T) {
+	tests := []struct {
+		name  string
+		elems []message.IMessageElement
+	}{
+		{"no prefix", []message.IMessageElement{message.NewText("ping")}},
+		{"unknown prefix", []message.IMessageElement{message.NewText("#ping")}},
+		{"mention of someone else", []message.IMessageElement{
+			message.NewAt(testUserUin + 1), message.NewText(" ping"),
+		}},
+		{"mention after text", []message.IMessageElement{
+			message.NewText("hi "), message.NewAt(h.Client.SelfUin), message.NewText(" ping"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectNoReply(t, func() {
+				h.InjectGroupMessageElements(testGroupCode, testUserUin, tt.elems...)
+			})
+		})
+	}
+}
+
+func TestShellCannotBeDisabled(t *testing.T) {
+	msg := waitForNext(t, func() {
+		h.InjectPrivateMessage(testAdminUin, "/module disable shell")
+	})
+	if !strings.Contains(msg.Text(), "不能停用") {
+		t.Fatalf("expected disabling shell to be rejected, got %q", msg.Text())
+	}
+
+	// shell keeps serving cmds
+	msg = waitForNext(t, func() {
+		h.InjectPrivateMessage(testAdminUin, "/ping")
+	})
+	if !strings.Contains(msg.Text(), "pong") {
+		t.Fatalf("expected pong, got %q", msg.Text())
+	}
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"bytes"
+
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -27,3 +29,22 @@ func Init() {
 		logrus.WithField("config", "GlobalConfig").WithError(err).Panicf("unable to read global config")
 	}
 }
+
+// InitWithContent 使用 yaml 格式的 content 初始化全局配置
+// 适用于离线模式及测试
+func InitWithContent(content []byte) error {
+	GlobalConfig = &Config{
+		viper.New(),
+	}
+	GlobalConfig.SetConfigType("yaml")
+	return GlobalConfig.ReadConfig(bytes.NewReader(content))
+}
+
+// Reload 重新读取全局配置文件
+// 全局配置并非读取自文件时不做任何操作
+func Reload() error {
+	if GlobalConfig.ConfigFileUsed() == "" {
+		return nil
+	}
+	return GlobalConfig.ReadInConfig()
+}
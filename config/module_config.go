@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// EnvPrefix 环境变量覆盖配置项时使用的前缀
+	// 例如 MIRAIGO_DD_BILI_POLLING_INTERVAL=30 覆盖 bili 模块配置中的 polling_interval
+	EnvPrefix = "MIRAIGO_DD_"
+
+	// reloadDebounce 配置文件变更后等待的时间，避免编辑器多次写入触发多次重载
+	reloadDebounce = 500 * time.Millisecond
+)
+
+// Defaulter 可设置默认值的模块配置
+// SetDefaults 在解析配置文件之前调用
+type Defaulter interface {
+	SetDefaults()
+}
+
+// Validator 可校验的模块配置
+// Validate 在解析配置文件及应用环境变量覆盖之后调用
+type Validator interface {
+	Validate() error
+}
+
+// ModuleConfig 模块配置加载器
+// 配置文件路径由全局配置 modules.<name>.config_path 指定
+type ModuleConfig[T any] struct {
+	moduleName string
+	path       string
+	logger     *logrus.Entry
+
+	watcher *fsnotify.Watcher
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewModuleConfig 创建模块配置加载器
+// 全局配置中未指定 config_path 时使用 defaultPath
+func NewModuleConfig[T any](moduleName, defaultPath string) *ModuleConfig[T] {
+	path := GlobalConfig.GetString("modules." + moduleName + ".config_path")
+	if path == "" {
+		path = defaultPath
+	}
+	return &ModuleConfig[T]{
+		moduleName: moduleName,
+		path:       path,
+		logger:     logrus.WithField("config", moduleName),
+	}
+}
+
+// Path 配置文件路径
+func (c *ModuleConfig[T]) Path() string {
+	return c.path
+}
+
+// Load 读取配置文件
+// 依次设置默认值、解析 yaml、应用环境变量覆盖并进行校验
+// 文件不存在或校验失败时返回 error
+func (c *ModuleConfig[T]) Load() (*T, error) {
+	c.logger.Debugf("reading config from %s", c.path)
+	cb, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s: %v", c.path, err)
+	}
+
+	cfg := new(T)
+	if d, ok := any(cfg).(Defaulter); ok {
+		d.SetDefaults()
+	}
+	if err = yaml.Unmarshal(cb, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %v", c.path, err)
+	}
+	if err = c.applyEnvOverrides(cfg); err != nil {
+		return nil, err
+	}
+	if v, ok := any(cfg).(Validator); ok {
+		if err = v.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid config in %s: %v", c.path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// applyEnvOverrides 使用环境变量覆盖配置中的顶层字段
+// 环境变量名为 EnvPrefix + 模块名 + "_" + 字段的 yaml 名，均为大写
+// 环境变量的值按 yaml 解析，因此也支持列表与字典，例如 "[1, 2]"
+func (c *ModuleConfig[T]) applyEnvOverrides(cfg *T) error {
+	v := reflect.ValueOf(cfg).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+
+		envKey := strings.ToUpper(EnvPrefix + c.moduleName + "_" + key)
+		envValue, ok := os.LookupEnv(envKey)
+		if !ok {
+			continue
+		}
+		// unmarshal into a fresh value so that lists and maps are replaced instead of merged
+		fv := reflect.New(field.Type)
+		if err := yaml.Unmarshal([]byte(envValue), fv.Interface()); err != nil {
+			return fmt.Errorf("invalid value for %s: %v", envKey, err)
+		}
+		v.Field(i).Set(fv.Elem())
+		c.logger.Infof("config %s overridden by environment variable %s", key, envKey)
+	}
+	return nil
+}
+
+// Watch 监听配置文件变更
+// 文件变更后重新加载配置，仅当新配置通过校验时调用 onChange
+// onChange 在监听协程中调用，请勿在其中阻塞或调用 Close
+func (c *ModuleConfig[T]) Watch(onChange func(newConfig *T)) error {
+	if c.watcher != nil {
+		return fmt.Errorf("config %s is already being watched", c.path)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// watch the directory instead of the file since editors may replace the file on saving
+	if err = watcher.Add(filepath.Dir(c.path)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	c.watcher = watcher
+	c.quit = make(chan struct{})
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchLoop(onChange)
+	}()
+	c.logger.Infof("watching config file %s", c.path)
+	return nil
+}
+
+func (c *ModuleConfig[T]) watchLoop(onChange func(newConfig *T)) {
+	target := filepath.Clean(c.path)
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case e, ok := <-c.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(e.Name) != target {
+				continue
+			}
+			if e.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce.Reset(reloadDebounce)
+			}
+		case err, ok := <-c.watcher.Errors:
+			if !ok {
+				return
+			}
+			c.logger.WithError(err).Warn("error while watching config file")
+		case <-debounce.C:
+			newConfig, err := c.Load()
+			if err != nil {
+				c.logger.WithError(err).Error("config file changed but failed to reload, keeping the old one")
+				continue
+			}
+			c.logger.Info("config file changed")
+			onChange(newConfig)
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// Close 停止监听配置文件
+func (c *ModuleConfig[T]) Close() {
+	if c.watcher == nil {
+		return
+	}
+	close(c.quit)
+	c.wg.Wait()
+	_ = c.watcher.Close()
+	c.watcher = nil
+}
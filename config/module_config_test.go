@@ -0,0 +1,232 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testModuleName = "testmod"
+
+type testConfig struct {
+	Interval int     `yaml:"interval"`
+	Name     string  `yaml:"name,omitempty"`
+	Groups   []int64 `yaml:"groups"`
+	Ignored  string  `yaml:"-"`
+}
+
+func (c *testConfig) SetDefaults() {
+	c.Interval = 60
+	c.Name = "default"
+	c.Groups = []int64{1}
+}
+
+func (c *testConfig) Validate() error {
+	if c.Interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	return nil
+}
+
+// newTestModuleConfig 在临时目录中写入配置文件，并通过全局配置指定其路径
+func newTestModuleConfig(t *testing.T, content string) *ModuleConfig[testConfig] {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "testmod.yaml")
+	writeFile(t, path, content)
+
+	saved := GlobalConfig
+	t.Cleanup(func() { GlobalConfig = saved })
+	if err := InitWithContent([]byte("modules:\n  testmod:\n    config_path: " + path + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewModuleConfig[testConfig](testModuleName, "./not_used.yaml")
+	if c.Path() != path {
+		t.Fatalf("expected config path %s, got %s", path, c.Path())
+	}
+	return c
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewModuleConfigDefaultPath(t *testing.T) {
+	saved := GlobalConfig
+	t.Cleanup(func() { GlobalConfig = saved })
+	if err := InitWithContent([]byte("modules: {}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if c := NewModuleConfig[testConfig](testModuleName, "./testmod.yaml"); c.Path() != "./testmod.yaml" {
+		t.Fatalf("expected the default path, got %s", c.Path())
+	}
+}
+
+func TestModuleConfigLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		want    testConfig
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			yaml: "",
+			want: testConfig{Interval: 60, Name: "default", Groups: []int64{1}},
+		},
+		{
+			name: "yaml over defaults",
+			yaml: "interval: 30\ngroups: [ 2, 3 ]\n",
+			want: testConfig{Interval: 30, Name: "default", Groups: []int64{2, 3}},
+		},
+		{
+			name: "env over yaml",
+			yaml: "interval: 30\nname: yaml\ngroups: [ 2, 3 ]\n",
+			env: map[string]string{
+				"MIRAIGO_DD_TESTMOD_INTERVAL": "10",
+				"MIRAIGO_DD_TESTMOD_GROUPS":   "[4]",
+			},
+			// lists from env replace instead of merging
+			want: testConfig{Interval: 10, Name: "yaml", Groups: []int64{4}},
+		},
+		{
+			name: "env over defaults",
+			yaml: "",
+			env:  map[string]string{"MIRAIGO_DD_TESTMOD_NAME": "env"},
+			want: testConfig{Interval: 60, Name: "env", Groups: []int64{1}},
+		},
+		{
+			name: "fields without a yaml name are not overridden",
+			yaml: "",
+			env:  map[string]string{"MIRAIGO_DD_TESTMOD_IGNORED": "env"},
+			want: testConfig{Interval: 60, Name: "default", Groups: []int64{1}},
+		},
+		{
+			name:    "validated after env",
+			yaml:    "interval: 30\n",
+			env:     map[string]string{"MIRAIGO_DD_TESTMOD_INTERVAL": "0"},
+			wantErr: "interval must be positive",
+		},
+		{
+			name:    "validated after yaml",
+			yaml:    "interval: -1\n",
+			wantErr: "interval must be positive",
+		},
+		{
+			name:    "invalid env",
+			yaml:    "",
+			env:     map[string]string{"MIRAIGO_DD_TESTMOD_INTERVAL": "abc"},
+			wantErr: "invalid value for MIRAIGO_DD_TESTMOD_INTERVAL",
+		},
+		{
+			name:    "invalid yaml",
+			yaml:    "interval: [",
+			wantErr: "unable to parse config file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestModuleConfig(t, tt.yaml)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := c.Load()
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*cfg, tt.want) {
+				t.Fatalf("expected %+v, got %+v", tt.want, *cfg)
+			}
+		})
+	}
+}
+
+func TestModuleConfigLoadMissingFile(t *testing.T) {
+	c := newTestModuleConfig(t, "")
+	if err := os.Remove(c.Path()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Load(); err == nil || !strings.Contains(err.Error(), "unable to read config file") {
+		t.Fatalf("expected a read error, got %v", err)
+	}
+}
+
+func TestModuleConfigWatch(t *testing.T) {
+	c := newTestModuleConfig(t, "interval: 30\n")
+	changes := make(chan *testConfig, 10)
+	if err := c.Watch(func(newConfig *testConfig) { changes <- newConfig }); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	if err := c.Watch(func(*testConfig) {}); err == nil {
+		t.Fatal("expected watching twice to fail")
+	}
+
+	expectChange := func(interval int) {
+		t.Helper()
+		select {
+		case cfg := <-changes:
+			if cfg.Interval != interval {
+				t.Fatalf("expected interval %d, got %d", interval, cfg.Interval)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for config change")
+		}
+	}
+	expectNoChange := func() {
+		t.Helper()
+		select {
+		case cfg := <-changes:
+			t.Fatalf("expected no config change, got %+v", cfg)
+		case <-time.After(2 * reloadDebounce):
+		}
+	}
+
+	// consecutive writes are debounced into one change
+	writeFile(t, c.Path(), "interval: 10\n")
+	writeFile(t, c.Path(), "interval: 20\n")
+	expectChange(20)
+	expectNoChange()
+
+	// env overrides apply on reloading as well
+	t.Setenv("MIRAIGO_DD_TESTMOD_INTERVAL", "5")
+	writeFile(t, c.Path(), "interval: 15\n")
+	expectChange(5)
+
+	// an invalid config is never delivered
+	t.Setenv("MIRAIGO_DD_TESTMOD_INTERVAL", "0")
+	writeFile(t, c.Path(), "interval: 15\n")
+	expectNoChange()
+
+	// other files in the directory are ignored
+	writeFile(t, filepath.Join(filepath.Dir(c.Path()), "other.yaml"), "interval: 1\n")
+	expectNoChange()
+
+	// nothing is delivered after closing, and closing again is harmless
+	c.Close()
+	c.Close()
+	t.Setenv("MIRAIGO_DD_TESTMOD_INTERVAL", "7")
+	writeFile(t, c.Path(), "interval: 15\n")
+	expectNoChange()
+
+	// it can be watched again after closing
+	if err := c.Watch(func(newConfig *testConfig) { changes <- newConfig }); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, c.Path(), "interval: 15\n")
+	expectChange(7)
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
 )
 
+const ModuleName = "internal.auto_reconnect"
+
 func init() {
 	instance = &autoReconnect{}
 	bot.RegisterModule(instance)
@@ -21,7 +23,7 @@ var logger = utils.GetModuleLogger("internal.autoReconnect")
 
 func (m *autoReconnect) MiraiGoModule() bot.ModuleInfo {
 	return bot.ModuleInfo{
-		ID:       "internal.auto_reconnect",
+		ID:       ModuleName,
 		Instance: instance,
 	}
 }
@@ -41,7 +43,7 @@ func (m *autoReconnect) Stop(b *bot.Bot, wg *sync.WaitGroup) {
 }
 
 func registerAutoReconnect(b *bot.Bot) {
-	b.DisconnectedEvent.Subscribe(func(qqClient *client.QQClient, event *client.ClientDisconnectedEvent) {
+	b.DisconnectedEvent.Subscribe(ModuleName, func(_ bot.Client, event *client.ClientDisconnectedEvent) {
 		// try to reconnect
 		cnt := 0
 		for cnt < 10 {
@@ -58,7 +60,7 @@ func registerAutoReconnect(b *bot.Bot) {
 		}
 
 		// terminate if reconnection failed
-		if !b.Online.Load() {
+		if !b.Client().IsOnline() {
 			logger.Error("failed to restore from disconnection, exiting")
 			_ = syscall.Kill(syscall.Getpid(), syscall.SIGINT)
 		}
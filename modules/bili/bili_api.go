@@ -1,5 +1,11 @@
 package bili
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
 // These are APIs exposed to other modules.
 // They should only be called after initialization of all modules.
 
@@ -34,3 +40,115 @@ func GetSubscriptionByGroupId(gid int64) []UserInfo {
 	}
 	return infoList
 }
+
+// Subscribe 为群 gid 订阅 bilibili 用户 uid 的开播提醒，并持久化
+// 返回 false 表示此前已订阅
+func Subscribe(gid, uid int64) (bool, error) {
+	if instance == nil || !instance.isEnabled {
+		return false, errors.New("bili module is not enabled")
+	}
+
+	instance.subscriptionRwMu.Lock()
+	if contains(instance.groupIdToBiliUidList[gid], uid) {
+		instance.subscriptionRwMu.Unlock()
+		return false, nil
+	}
+	if err := instance.subscriptionStore.record(gid, uid, true); err != nil {
+		instance.subscriptionRwMu.Unlock()
+		return false, err
+	}
+	isNew := instance.addSubscription(gid, uid)
+	instance.subscriptionRwMu.Unlock()
+	logger.Infof("group %d subscribed bilibili user %d", gid, uid)
+
+	if isNew {
+		// poll right away instead of waiting for the next round
+		go instance.pollBiliUser(uid)
+	}
+	return true, nil
+}
+
+// Unsubscribe 为群 gid 取消订阅 bilibili 用户 uid，并持久化
+// 返回 false 表示此前未订阅
+func Unsubscribe(gid, uid int64) (bool, error) {
+	if instance == nil || !instance.isEnabled {
+		return false, errors.New("bili module is not enabled")
+	}
+
+	instance.subscriptionRwMu.Lock()
+	if !contains(instance.groupIdToBiliUidList[gid], uid) {
+		instance.subscriptionRwMu.Unlock()
+		return false, nil
+	}
+	if err := instance.subscriptionStore.record(gid, uid, false); err != nil {
+		instance.subscriptionRwMu.Unlock()
+		return false, err
+	}
+	isGone := instance.removeSubscription(gid, uid)
+	instance.subscriptionRwMu.Unlock()
+	logger.Infof("group %d unsubscribed bilibili user %d", gid, uid)
+
+	if isGone {
+		// nobody cares about this user anymore
+		instance.infoBufRwMu.Lock()
+		delete(instance.biliUserInfoBuf, uid)
+		delete(instance.biliLiveSince, uid)
+		instance.infoBufRwMu.Unlock()
+		instance.dynamicStore.forget(uid)
+		instance.liveSessions.finish(uid)
+
+		// Note: queued after any pending start of the fetcher, so it's never left running
+		instance.stopLiveMsgFetcherForBiliUser(uid)
+	}
+	return true, nil
+}
+
+// NotifyTypesOf 获取群 gid 开启的提醒类型
+func NotifyTypesOf(gid int64) []NotifyType {
+	if instance == nil {
+		return nil
+	}
+	return instance.notifyTypesOf(gid)
+}
+
+// SetNotify 为群 gid 开启或关闭某类提醒，并持久化
+func SetNotify(gid int64, t NotifyType, enabled bool) error {
+	if instance == nil || !instance.isEnabled {
+		return errors.New("bili module is not enabled")
+	}
+	if !t.isValid() {
+		return fmt.Errorf("invalid notify type %s", t)
+	}
+
+	l := make([]NotifyType, 0, len(notifyTypes))
+	for _, nt := range notifyTypes {
+		if (nt == t && enabled) || (nt != t && instance.isNotifyEnabled(gid, nt)) {
+			l = append(l, nt)
+		}
+	}
+	return instance.subscriptionStore.setNotifyTypes(gid, l)
+}
+
+// GetFetcherStatusByGroupId 获取群 gid 订阅的主播中正在接收弹幕的直播间的状态，按 UID 排序
+func GetFetcherStatusByGroupId(gid int64) []FetcherStatus {
+	if instance == nil {
+		return nil
+	}
+
+	instance.subscriptionRwMu.RLock()
+	bidList := append([]int64{}, instance.groupIdToBiliUidList[gid]...)
+	instance.subscriptionRwMu.RUnlock()
+
+	instance.fetcherRwMu.RLock()
+	defer instance.fetcherRwMu.RUnlock()
+	statusList := make([]FetcherStatus, 0)
+	for _, bid := range bidList {
+		if fetcher, ok := instance.biliUidToMsgFetcher[bid]; ok {
+			statusList = append(statusList, fetcher.Status())
+		}
+	}
+	sort.Slice(statusList, func(i, j int) bool {
+		return statusList[i].Bid < statusList[j].Bid
+	})
+	return statusList
+}
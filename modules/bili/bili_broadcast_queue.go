@@ -0,0 +1,46 @@
+package bili
+
+import "sync"
+
+// broadcastQueue 按主播 UID 串行执行广播任务，不同主播之间并发执行
+// 保证同一主播的提醒（如开播与下播）按事件顺序发出，即使其中某些需要先下载封面
+type broadcastQueue struct {
+	mu      sync.Mutex
+	pending map[int64][]func() // UID -> tasks waiting for the running one, mu protected
+}
+
+func newBroadcastQueue() *broadcastQueue {
+	return &broadcastQueue{
+		pending: make(map[int64][]func()),
+	}
+}
+
+// run 将 task 加入 uid 的队列，在此前加入的任务完成后执行
+// 不会阻塞，每个有任务的 UID 占用一个协程，队列清空后退出
+func (q *broadcastQueue) run(uid int64, task func()) {
+	q.mu.Lock()
+	if tasks, busy := q.pending[uid]; busy {
+		q.pending[uid] = append(tasks, task)
+		q.mu.Unlock()
+		return
+	}
+	// an empty entry marks the worker of uid as running
+	q.pending[uid] = nil
+	q.mu.Unlock()
+
+	go func() {
+		for {
+			task()
+
+			q.mu.Lock()
+			tasks := q.pending[uid]
+			if len(tasks) == 0 {
+				delete(q.pending, uid)
+				q.mu.Unlock()
+				return
+			}
+			task, q.pending[uid] = tasks[0], tasks[1:]
+			q.mu.Unlock()
+		}
+	}()
+}
@@ -0,0 +1,53 @@
+package bili
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBroadcastQueueKeepsOrderPerUid(t *testing.T) {
+	q := newBroadcastQueue()
+	var mu sync.Mutex
+	got := make(map[int64][]string)
+	wg := sync.WaitGroup{}
+	push := func(uid int64, name string, delay time.Duration) {
+		wg.Add(1)
+		q.run(uid, func() {
+			defer wg.Done()
+			time.Sleep(delay)
+			mu.Lock()
+			got[uid] = append(got[uid], name)
+			mu.Unlock()
+		})
+	}
+
+	// the slow start-live msg of 1 must not be overtaken by its stop-live msg,
+	// nor block the msgs of 2
+	push(1, "start", 100*time.Millisecond)
+	push(2, "start", 0)
+	push(1, "stop", 0)
+	push(2, "stop", 0)
+	wg.Wait()
+
+	want := map[int64][]string{1: {"start", "stop"}, 2: {"start", "stop"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// workers exit shortly after their last task is done
+	deadline := time.Now().Add(time.Second)
+	for {
+		q.mu.Lock()
+		n := len(q.pending)
+		q.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected all workers to exit, %d still running", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,196 @@
+package bili
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
+)
+
+// registerCommands 注册本模块的 shell 命令
+func (m *bili) registerCommands() {
+	err := shell.RegisterSubCommand(ModuleName, "ls", &shell.Command{
+		Name:        "bili",
+		Description: "显示本群订阅的主播",
+		Handler:     handleLsBili,
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed to register commands")
+	}
+
+	uidSpec := &shell.CmdSpec{Args: []shell.ArgSpec{{Name: "UID", Type: shell.ArgInt}}}
+	err = shell.RegisterCommand(ModuleName, &shell.Command{
+		Name:         "bili",
+		Description:  "管理本群订阅的主播",
+		RequiredRole: shell.RoleAdmin,
+		SubCmds: []*shell.Command{
+			{
+				Name:        "sub",
+				Aliases:     []string{"订阅"},
+				Description: "订阅主播的开播提醒",
+				Examples:    []string{"bili sub 233"},
+				Spec:        uidSpec,
+				Handler:     handleBiliSub,
+			},
+			{
+				Name:        "unsub",
+				Aliases:     []string{"取消订阅"},
+				Description: "取消订阅主播",
+				Spec:        uidSpec,
+				Handler:     handleBiliUnsub,
+			},
+			{
+				Name:        "notify",
+				Aliases:     []string{"提醒"},
+				Description: "查看或设置本群开启的动态与视频提醒",
+				Examples:    []string{"bili notify", "bili notify video on"},
+				Spec: &shell.CmdSpec{Args: []shell.ArgSpec{
+					{Name: "类型", Optional: true, Choices: notifyTypeNames()},
+					{Name: "开关", Optional: true, Choices: []string{"on", "off"}},
+				}},
+				Handler: handleBiliNotify,
+			},
+			{
+				Name:        "fetchers",
+				Aliases:     []string{"弹幕"},
+				Description: "查看本群订阅的主播的弹幕接收状态",
+				Handler:     handleBiliFetchers,
+			},
+		},
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed to register commands")
+	}
+}
+
+func handleBiliSub(ctx *shell.CmdContext) {
+	if !ctx.RequireGroup() {
+		return
+	}
+	uid := ctx.ParsedCmd.IntArg(0)
+	if uid <= 0 {
+		ctx.Reply("UID 应为正整数")
+		return
+	}
+	ok, err := Subscribe(ctx.GroupId, uid)
+	switch {
+	case err != nil:
+		logger.WithError(err).Errorf("failed to subscribe bilibili user %d for group %d", uid, ctx.GroupId)
+		ctx.Reply("订阅失败，未知错误")
+	case !ok:
+		ctx.Reply(fmt.Sprintf("本群已订阅 UID: %d", uid))
+	default:
+		ctx.Reply(fmt.Sprintf("已订阅 UID: %d，主播信息将稍后拉取", uid))
+	}
+}
+
+func handleBiliUnsub(ctx *shell.CmdContext) {
+	if !ctx.RequireGroup() {
+		return
+	}
+	uid := ctx.ParsedCmd.IntArg(0)
+	ok, err := Unsubscribe(ctx.GroupId, uid)
+	switch {
+	case err != nil:
+		logger.WithError(err).Errorf("failed to unsubscribe bilibili user %d for group %d", uid, ctx.GroupId)
+		ctx.Reply("取消订阅失败，未知错误")
+	case !ok:
+		ctx.Reply(fmt.Sprintf("本群未订阅 UID: %d", uid))
+	default:
+		ctx.Reply(fmt.Sprintf("已取消订阅 UID: %d", uid))
+	}
+}
+
+func handleLsBili(ctx *shell.CmdContext) {
+	if !ctx.RequireGroup() {
+		return
+	}
+	userInfoList := GetSubscriptionByGroupId(ctx.GroupId)
+	if userInfoList == nil || len(userInfoList) == 0 {
+		ctx.Reply("暂无订阅的主播")
+	} else {
+		sb := strings.Builder{}
+		sb.WriteString("当前订阅的主播信息如下：\n")
+		for _, userInfo := range userInfoList {
+			if len(userInfo.Name) == 0 {
+				sb.WriteString(fmt.Sprintf("UID: %d", userInfo.Mid))
+			} else {
+				sb.WriteString(fmt.Sprintf("UID: %d - %s - ", userInfo.Mid, userInfo.Name))
+				if userInfo.LiveRoom.LiveStatus == Streaming {
+					sb.WriteString("已开播")
+				} else {
+					sb.WriteString("未开播")
+				}
+			}
+			sb.WriteRune('\n')
+		}
+		sb.WriteString("（注：信息拉取存在延时，未显示主播昵称表明尚未拉取，请稍后重试）")
+		ctx.Reply(sb.String())
+	}
+}
+
+func notifyTypeNames() []string {
+	names := make([]string, 0, len(notifyTypes))
+	for _, t := range notifyTypes {
+		names = append(names, string(t))
+	}
+	return names
+}
+
+func handleBiliNotify(ctx *shell.CmdContext) {
+	if !ctx.RequireGroup() {
+		return
+	}
+	switch len(ctx.ParsedCmd.Args) {
+	case 0:
+		sb := strings.Builder{}
+		sb.WriteString("本群的提醒设置如下：\n开播 - 开启")
+		for _, t := range notifyTypes {
+			sb.WriteString(fmt.Sprintf("\n%s（%s） - ", t.Display(), t))
+			if instance.isNotifyEnabled(ctx.GroupId, t) {
+				sb.WriteString("开启")
+			} else {
+				sb.WriteString("关闭")
+			}
+		}
+		ctx.Reply(sb.String())
+	case 1:
+		ctx.Reply("请指定 on 或 off")
+	default:
+		t, enabled := NotifyType(ctx.ParsedCmd.Arg(0)), ctx.ParsedCmd.Arg(1) == "on"
+		if err := SetNotify(ctx.GroupId, t, enabled); err != nil {
+			logger.WithError(err).Errorf("failed to set notify %s for group %d", t, ctx.GroupId)
+			ctx.Reply("设置失败，未知错误")
+		} else if enabled {
+			ctx.Reply(fmt.Sprintf("已开启%s提醒", t.Display()))
+		} else {
+			ctx.Reply(fmt.Sprintf("已关闭%s提醒", t.Display()))
+		}
+	}
+}
+
+func handleBiliFetchers(ctx *shell.CmdContext) {
+	if !ctx.RequireGroup() {
+		return
+	}
+	statusList := GetFetcherStatusByGroupId(ctx.GroupId)
+	if len(statusList) == 0 {
+		ctx.Reply("本群订阅的主播当前均未在接收弹幕")
+		return
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("弹幕接收状态如下：")
+	for _, s := range statusList {
+		sb.WriteString(fmt.Sprintf("\nUID: %d - %s - 房间 %d - %s", s.Bid, s.Name, s.RoomID, s.State.Display()))
+		if s.Reconnects > 0 {
+			sb.WriteString(fmt.Sprintf("（已重连 %d 次）", s.Reconnects))
+		}
+		if s.LastMsgTime.IsZero() {
+			sb.WriteString(" - 尚未收到消息")
+		} else {
+			sb.WriteString(fmt.Sprintf(" - 最近消息：%s", s.LastMsgTime.Format("2006-01-02 15:04:05")))
+		}
+	}
+	ctx.Reply(sb.String())
+}
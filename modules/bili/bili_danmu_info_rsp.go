@@ -0,0 +1,19 @@
+package bili
+
+type DanmuInfoRsp struct {
+	Code    int
+	Message string
+	Data    DanmuInfo
+}
+
+type DanmuInfo struct {
+	Token    string
+	HostList []DanmuHost `json:"host_list"`
+}
+
+type DanmuHost struct {
+	Host    string
+	Port    int
+	WssPort int `json:"wss_port"`
+	WsPort  int `json:"ws_port"`
+}
@@ -0,0 +1,235 @@
+package bili
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Mrs4s/MiraiGo/message"
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+)
+
+// maxDanmuBatchSize 一条合并消息中最多的弹幕数，达到后立即发送
+const maxDanmuBatchSize = 20
+
+// DanmuRelayRule 弹幕中继规则，各条件同时满足时转发
+type DanmuRelayRule struct {
+	// Streamers 生效的主播 UID，为空时对群订阅的所有主播生效
+	Streamers []int64 `yaml:"streamers"`
+	// Keywords 与 Regex 任一匹配即可，均为空时不限制内容
+	Keywords []string `yaml:"keywords"`
+	Regex    []string `yaml:"regex"`
+	// AllowUids 与 AllowNames 不为空时，仅转发其中的用户的弹幕
+	AllowUids  []int64  `yaml:"allow_uids"`
+	AllowNames []string `yaml:"allow_names"`
+	// DenyUids 与 DenyNames 中的用户的弹幕不转发
+	DenyUids  []int64  `yaml:"deny_uids"`
+	DenyNames []string `yaml:"deny_names"`
+	// MinMedalLevel 发送人佩戴的该主播的粉丝勋章的最低等级
+	MinMedalLevel int `yaml:"min_medal_level"`
+	// MinLength 弹幕的最短长度（字数）
+	MinLength int `yaml:"min_length"`
+}
+
+// danmuRelayRule 编译后的弹幕中继规则
+type danmuRelayRule struct {
+	*DanmuRelayRule
+	regex []*regexp.Regexp
+}
+
+// parseDanmuRelayRules 编译各群的弹幕中继规则
+func parseDanmuRelayRules(rules map[int64][]DanmuRelayRule) (map[int64][]*danmuRelayRule, error) {
+	rst := make(map[int64][]*danmuRelayRule)
+	for gid, l := range rules {
+		for i := range l {
+			r := &danmuRelayRule{DanmuRelayRule: &l[i]}
+			for _, expr := range r.Regex {
+				re, err := regexp.Compile(expr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid danmu relay regex %s for group %d: %v", expr, gid, err)
+				}
+				r.regex = append(r.regex, re)
+			}
+			rst[gid] = append(rst[gid], r)
+		}
+	}
+	return rst, nil
+}
+
+// match 弹幕是否满足规则
+func (r *danmuRelayRule) match(d *DanmuEventData) bool {
+	streamer := d.StreamerUserInfo
+	if len(r.Streamers) > 0 && !contains(r.Streamers, int64(streamer.Mid)) {
+		return false
+	}
+	if contains(r.DenyUids, d.FromUid) || containsString(r.DenyNames, d.FromUserName) {
+		return false
+	}
+	if (len(r.AllowUids) > 0 || len(r.AllowNames) > 0) &&
+		!contains(r.AllowUids, d.FromUid) && !containsString(r.AllowNames, d.FromUserName) {
+		return false
+	}
+	if r.MinMedalLevel > 0 &&
+		(d.MedalRoomId != int64(streamer.LiveRoom.RoomId) || d.MedalLevel < r.MinMedalLevel) {
+		return false
+	}
+	if utf8.RuneCountInString(d.Content) < r.MinLength {
+		return false
+	}
+
+	if len(r.Keywords) == 0 && len(r.regex) == 0 {
+		return true
+	}
+	for _, w := range r.Keywords {
+		if strings.Contains(d.Content, w) {
+			return true
+		}
+	}
+	for _, re := range r.regex {
+		if re.MatchString(d.Content) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(l []string, v string) bool {
+	for _, x := range l {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRelayDanmu 弹幕是否需要转发到群 gid，没有配置规则的群使用 danmu_forward_keywords 作为关键词
+func (m *bili) shouldRelayDanmu(gid int64, d *DanmuEventData) bool {
+	rules, ok := m.danmuRelayRules[gid]
+	if !ok {
+		// fallback to the global keywords
+		for _, w := range m.config.DanmuForwardKeywords {
+			if strings.Contains(d.Content, w) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, r := range rules {
+		if r.match(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// relayDanmu 将弹幕转发到规则匹配的群
+func (m *bili) relayDanmu(d *DanmuEventData) {
+	for _, gid := range m.groupsToNotify(int64(d.StreamerUserInfo.Mid), "") {
+		if m.shouldRelayDanmu(gid, d) {
+			m.danmuBatcher.add(gid, d)
+		}
+	}
+}
+
+// danmuBatchKey 同一个群中同一个主播的弹幕合并为一条消息
+type danmuBatchKey struct {
+	groupId int64
+	bid     int64
+}
+
+// danmuBatch 一批待转发的弹幕
+type danmuBatch struct {
+	items []*DanmuEventData
+}
+
+// danmuBatcher 将一段时间内转发到同一个群的弹幕合并为一条消息，避免刷屏
+type danmuBatcher struct {
+	window  time.Duration
+	pending map[danmuBatchKey]*danmuBatch // mu protected
+	mu      sync.Mutex
+}
+
+func newDanmuBatcher(window time.Duration) *danmuBatcher {
+	return &danmuBatcher{
+		window:  window,
+		pending: make(map[danmuBatchKey]*danmuBatch),
+	}
+}
+
+// add 添加一条待转发的弹幕，window 为 0 时立即发送
+func (b *danmuBatcher) add(gid int64, d *DanmuEventData) {
+	if b.window <= 0 {
+		sendDanmuBatch(gid, []*DanmuEventData{d})
+		return
+	}
+
+	key := danmuBatchKey{groupId: gid, bid: int64(d.StreamerUserInfo.Mid)}
+	b.mu.Lock()
+	batch, ok := b.pending[key]
+	if !ok {
+		batch = &danmuBatch{}
+		b.pending[key] = batch
+	}
+	batch.items = append(batch.items, d)
+	full := len(batch.items) >= maxDanmuBatchSize
+	b.mu.Unlock()
+
+	if full {
+		b.flush(key, batch)
+	} else if !ok {
+		// the first danmu of a batch starts the window
+		time.AfterFunc(b.window, func() { b.flush(key, batch) })
+	}
+}
+
+// flush 发送 batch，已经发送过时不做任何事
+func (b *danmuBatcher) flush(key danmuBatchKey, batch *danmuBatch) {
+	b.mu.Lock()
+	if b.pending[key] != batch {
+		// flushed early since it's full
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, key)
+	b.mu.Unlock()
+
+	sendDanmuBatch(key.groupId, batch.items)
+}
+
+// flushAll 立即发送所有待转发的弹幕
+func (b *danmuBatcher) flushAll() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[danmuBatchKey]*danmuBatch)
+	b.mu.Unlock()
+
+	for key, batch := range pending {
+		sendDanmuBatch(key.groupId, batch.items)
+	}
+}
+
+// sendDanmuBatch 将同一个主播的弹幕作为一条消息发送到群 gid
+func sendDanmuBatch(gid int64, l []*DanmuEventData) {
+	userInfo := l[len(l)-1].StreamerUserInfo
+	var text string
+	if len(l) == 1 {
+		text = fmt.Sprintf(
+			"【弹幕中继】\n主播：%s\n直播间标题：%s\n发送人：%s\n内容：%s",
+			userInfo.Name, userInfo.LiveRoom.Title, l[0].FromUserName, l[0].Content,
+		)
+	} else {
+		sb := strings.Builder{}
+		sb.WriteString(fmt.Sprintf("【弹幕中继】\n主播：%s\n直播间标题：%s", userInfo.Name, userInfo.LiveRoom.Title))
+		for _, d := range l {
+			sb.WriteString(fmt.Sprintf("\n%s：%s", d.FromUserName, d.Content))
+		}
+		text = sb.String()
+	}
+
+	msg := message.NewSendingMessage()
+	msg.Append(message.NewText(text))
+	bot.SendGroupMessage(gid, msg, bot.PriorityLow)
+}
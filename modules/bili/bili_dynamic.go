@@ -0,0 +1,347 @@
+package bili
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mrs4s/MiraiGo/message"
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
+)
+
+// NotifyType 需要各群单独开启的提醒类型，开播提醒默认开启，无需在此列出
+type NotifyType string
+
+const (
+	// NotifyDynamic 新动态
+	NotifyDynamic NotifyType = "dynamic"
+	// NotifyVideo 新投稿的视频
+	NotifyVideo NotifyType = "video"
+	// NotifyRoomChange 直播中修改标题或封面
+	NotifyRoomChange NotifyType = "room"
+	// NotifySuperChat 直播间的醒目留言
+	NotifySuperChat NotifyType = "superchat"
+	// NotifyGuard 直播间有人上舰
+	NotifyGuard NotifyType = "guard"
+	// NotifySummary 下播后的直播总结
+	NotifySummary NotifyType = "summary"
+)
+
+var notifyTypes = []NotifyType{NotifyDynamic, NotifyVideo, NotifyRoomChange, NotifySuperChat, NotifyGuard, NotifySummary}
+
+func (t NotifyType) isValid() bool {
+	for _, valid := range notifyTypes {
+		if t == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Display 提醒类型的中文名
+func (t NotifyType) Display() string {
+	switch t {
+	case NotifyDynamic:
+		return "动态"
+	case NotifyVideo:
+		return "视频"
+	case NotifyRoomChange:
+		return "直播间变更"
+	case NotifySuperChat:
+		return "醒目留言"
+	case NotifyGuard:
+		return "上舰"
+	case NotifySummary:
+		return "直播总结"
+	default:
+		return string(t)
+	}
+}
+
+// Dynamic 一条新动态或新投稿的视频
+type Dynamic struct {
+	Id         string
+	Type       NotifyType
+	AuthorId   int64
+	AuthorName string
+	// Title 视频标题，动态没有标题
+	Title string
+	Text  string
+	// Cover 视频封面或动态的第一张图片，可能为空
+	Cover   string
+	Url     string
+	PubTime time.Time
+}
+
+// newDynamic 从 API 返回的动态解析出需要提醒的内容
+// 直播推荐等不需要提醒的动态返回 nil
+func newDynamic(item *DynamicItem) *Dynamic {
+	if item.Type == DynamicTypeLiveRcmd {
+		// already announced as start live
+		return nil
+	}
+
+	author, content := item.Modules.ModuleAuthor, item.Modules.ModuleDynamic
+	d := &Dynamic{
+		Id:         item.IdStr,
+		Type:       NotifyDynamic,
+		AuthorId:   author.Mid,
+		AuthorName: author.Name,
+		Url:        "https://t.bilibili.com/" + item.IdStr,
+		PubTime:    time.Unix(author.PubTs, 0),
+	}
+	if content.Desc != nil {
+		d.Text = content.Desc.Text
+	}
+
+	major := content.Major
+	switch {
+	case major == nil:
+	case item.Type == DynamicTypeVideo && major.Archive != nil:
+		d.Type = NotifyVideo
+		d.Title, d.Cover = major.Archive.Title, major.Archive.Cover
+		d.Url = "https://www.bilibili.com/video/" + major.Archive.Bvid
+	case major.Draw != nil && len(major.Draw.Items) > 0:
+		d.Cover = major.Draw.Items[0].Src
+	case major.Opus != nil:
+		if len(d.Text) == 0 && major.Opus.Summary != nil {
+			d.Text = major.Opus.Summary.Text
+		}
+		if len(major.Opus.Pics) > 0 {
+			d.Cover = major.Opus.Pics[0].Url
+		}
+	}
+	if strings.HasPrefix(d.Cover, "//") {
+		d.Cover = "https:" + d.Cover
+	}
+	return d
+}
+
+// maxSeenDynamics 每个用户记录的已提醒动态数
+const maxSeenDynamics = 50
+
+// dynamicState 已提醒过的动态，用于去重
+type dynamicState struct {
+	// Seen 最近见过的动态 ID，新的在后
+	Seen []string `json:"seen"`
+	// LatestPubTs 见过的最新动态的发布时间，早于此时间的动态不再提醒
+	LatestPubTs int64 `json:"latest_pub_ts"`
+}
+
+func (s *dynamicState) hasSeen(id string) bool {
+	for _, seen := range s.Seen {
+		if seen == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *dynamicState) markSeen(id string, pubTs int64) {
+	s.Seen = append(s.Seen, id)
+	if len(s.Seen) > maxSeenDynamics {
+		s.Seen = s.Seen[len(s.Seen)-maxSeenDynamics:]
+	}
+	if pubTs > s.LatestPubTs {
+		s.LatestPubTs = pubTs
+	}
+}
+
+// dynamicStore 持久化的各用户动态去重状态
+type dynamicStore struct {
+	path   string
+	states map[int64]*dynamicState // bilibili UID -> state, mu protected
+	mu     sync.Mutex
+}
+
+func newDynamicStore(path string) *dynamicStore {
+	return &dynamicStore{
+		path:   path,
+		states: make(map[int64]*dynamicState),
+	}
+}
+
+// load 从文件读取去重状态，文件不存在时视为空
+func (s *dynamicStore) load() error {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	states := make(map[int64]*dynamicState)
+	if err = json.Unmarshal(b, &states); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.states = states
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *dynamicStore) save() error {
+	s.mu.Lock()
+	b, err := json.MarshalIndent(s.states, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path, b)
+}
+
+// forget 删除用户的去重状态，再次订阅时重新从最新的动态开始提醒
+func (s *dynamicStore) forget(uid int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, uid)
+}
+
+// filterNew 返回 items 中尚未提醒过的动态，并将其标记为已提醒
+// 首次拉取某用户的动态时只记录而不提醒，避免刷屏
+func (s *dynamicStore) filterNew(uid int64, items []DynamicItem) []*Dynamic {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[uid]
+	if !ok {
+		state = &dynamicState{}
+		s.states[uid] = state
+	}
+
+	// items are sorted from new to old (except the pinned one), mark them from old to new
+	rst := make([]*Dynamic, 0)
+	for i := len(items) - 1; i >= 0; i-- {
+		item := &items[i]
+		pubTs := item.Modules.ModuleAuthor.PubTs
+		if state.hasSeen(item.IdStr) || pubTs < state.LatestPubTs {
+			continue
+		}
+		state.markSeen(item.IdStr, pubTs)
+		if !ok {
+			continue
+		}
+		if d := newDynamic(item); d != nil {
+			rst = append(rst, d)
+		}
+	}
+	return rst
+}
+
+// getDynamicUidList 获取至少有一个群开启了动态或视频提醒的用户
+func (m *bili) getDynamicUidList() []int64 {
+	m.subscriptionRwMu.RLock()
+	defer m.subscriptionRwMu.RUnlock()
+
+	l := make([]int64, 0)
+	for uid, groupIdList := range m.biliUidToGroupIdList {
+		for _, gid := range groupIdList {
+			if m.isNotifyEnabled(gid, NotifyDynamic) || m.isNotifyEnabled(gid, NotifyVideo) {
+				l = append(l, uid)
+				break
+			}
+		}
+	}
+	return l
+}
+
+func (m *bili) pollDynamics() {
+	logger.Debug("start polling subscribed bilibili user dynamics")
+
+	uidList := m.getDynamicUidList()
+	for _, uid := range uidList {
+		items, err := GetSpaceDynamics(uid)
+		if err != nil {
+			logger.WithError(err).Errorf("failed to get dynamics for bid=%d", uid)
+			continue
+		}
+		for _, d := range m.dynamicStore.filterNew(uid, items) {
+			// the author is always the one we asked for
+			d.AuthorId = uid
+			logger.Infof("bilibili user %s(%d) has posted new %s %s", d.AuthorName, uid, d.Type, d.Id)
+			m.pollEvents.push(NewEvent(NewDynamic, d))
+		}
+	}
+	if err := m.dynamicStore.save(); err != nil {
+		logger.WithError(err).Errorf("failed to save dynamic state to %s", m.config.DynamicStatePath)
+	}
+
+	logger.Debugf("finish polling dynamics of %d bilibili users", len(uidList))
+}
+
+// notifyTypesOf 获取群开启的提醒类型，命令修改的设置优先于配置文件
+func (m *bili) notifyTypesOf(gid int64) []NotifyType {
+	if l, ok := m.subscriptionStore.notifyTypesOf(gid); ok {
+		return l
+	}
+	return m.config.Notify[gid]
+}
+
+func (m *bili) isNotifyEnabled(gid int64, t NotifyType) bool {
+	for _, enabled := range m.notifyTypesOf(gid) {
+		if enabled == t {
+			return true
+		}
+	}
+	return false
+}
+
+// groupsToNotify 获取订阅了 bid 且开启了提醒 t 的群，t 为空时返回所有订阅了 bid 的群
+func (m *bili) groupsToNotify(bid int64, t NotifyType) []int64 {
+	m.subscriptionRwMu.RLock()
+	defer m.subscriptionRwMu.RUnlock()
+
+	groupIdList := make([]int64, 0)
+	for _, gid := range m.biliUidToGroupIdList[bid] {
+		if len(t) == 0 || m.isNotifyEnabled(gid, t) {
+			groupIdList = append(groupIdList, gid)
+		}
+	}
+	return groupIdList
+}
+
+// broadcastDynamic 向订阅了作者且开启了对应提醒的群发送新动态，附带封面图
+func (m *bili) broadcastDynamic(qqClient bot.Client, d *Dynamic) {
+	groupIdList := m.groupsToNotify(d.AuthorId, d.Type)
+	if len(groupIdList) == 0 {
+		return
+	}
+
+	var text string
+	if d.Type == NotifyVideo {
+		text = fmt.Sprintf("%s投稿了新视频！\n标题：%s\n链接：%s", d.AuthorName, d.Title, d.Url)
+	} else {
+		text = fmt.Sprintf("%s发布了新动态！\n%s\n链接：%s", d.AuthorName, truncate(d.Text, maxDynamicTextLen), d.Url)
+	}
+
+	var cover []byte
+	if len(d.Cover) > 0 {
+		var err error
+		if cover, err = GetImage(d.Cover); err != nil {
+			logger.WithError(err).Warnf("failed to download cover %s", d.Cover)
+		}
+	}
+
+	for _, gid := range groupIdList {
+		msg := message.NewSendingMessage()
+		msg.Append(message.NewText(text))
+		sendWithImage(qqClient, gid, msg, cover)
+	}
+}
+
+// maxDynamicTextLen 动态正文在提醒中显示的最大长度
+const maxDynamicTextLen = 100
+
+// truncate 截断过长的文本
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "……"
+}
@@ -0,0 +1,75 @@
+package bili
+
+const (
+	// DynamicItem.Type
+	DynamicTypeVideo    = "DYNAMIC_TYPE_AV"
+	DynamicTypeLiveRcmd = "DYNAMIC_TYPE_LIVE_RCMD"
+)
+
+type DynamicRsp struct {
+	Code    int
+	Message string
+	Data    DynamicData
+}
+
+type DynamicData struct {
+	Items   []DynamicItem
+	HasMore bool `json:"has_more"`
+	Offset  string
+}
+
+type DynamicItem struct {
+	IdStr   string `json:"id_str"`
+	Type    string
+	Modules DynamicModules
+}
+
+type DynamicModules struct {
+	ModuleAuthor  DynamicAuthor  `json:"module_author"`
+	ModuleDynamic DynamicContent `json:"module_dynamic"`
+}
+
+type DynamicAuthor struct {
+	Mid   int64
+	Name  string
+	PubTs int64 `json:"pub_ts"`
+}
+
+type DynamicContent struct {
+	Desc  *DynamicDesc
+	Major *DynamicMajor
+}
+
+type DynamicDesc struct {
+	Text string
+}
+
+type DynamicMajor struct {
+	Type    string
+	Archive *DynamicArchive
+	Draw    *DynamicDraw
+	Opus    *DynamicOpus
+}
+
+type DynamicArchive struct {
+	Bvid    string
+	Title   string
+	Cover   string
+	Desc    string
+	JumpUrl string `json:"jump_url"`
+}
+
+type DynamicDraw struct {
+	Items []DynamicPic
+}
+
+type DynamicOpus struct {
+	Title   string
+	Summary *DynamicDesc
+	Pics    []DynamicPic
+}
+
+type DynamicPic struct {
+	Src string
+	Url string
+}
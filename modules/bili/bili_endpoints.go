@@ -0,0 +1,59 @@
+package bili
+
+import "sync"
+
+// Endpoints bilibili API 的地址，可指向本地的模拟服务器（见 fakebili）以便离线测试
+type Endpoints struct {
+	SpaceDynamic string `yaml:"space_dynamic"`
+	DanmuInfo    string `yaml:"danmu_info"`
+	LiveStatus   string `yaml:"live_status"`
+	// LiveMsg 获取弹幕服务器列表失败时使用的弹幕服务器
+	LiveMsg string `yaml:"live_msg"`
+}
+
+// DefaultEndpoints bilibili 官方的 API 地址
+func DefaultEndpoints() Endpoints {
+	return Endpoints{
+		SpaceDynamic: GetSpaceDynamicApi,
+		DanmuInfo:    GetDanmuInfoApi,
+		LiveStatus:   GetLiveStatusApi,
+		LiveMsg:      BiliLiveMsgApi,
+	}
+}
+
+// withDefaults 将未配置的地址设为默认值
+func (e Endpoints) withDefaults() Endpoints {
+	d := DefaultEndpoints()
+	if len(e.SpaceDynamic) == 0 {
+		e.SpaceDynamic = d.SpaceDynamic
+	}
+	if len(e.DanmuInfo) == 0 {
+		e.DanmuInfo = d.DanmuInfo
+	}
+	if len(e.LiveStatus) == 0 {
+		e.LiveStatus = d.LiveStatus
+	}
+	if len(e.LiveMsg) == 0 {
+		e.LiveMsg = d.LiveMsg
+	}
+	return e
+}
+
+var (
+	endpoints   = DefaultEndpoints() // endpointsMu protected
+	endpointsMu sync.RWMutex
+)
+
+// SetEndpoints 设置 API 地址，未设置的地址使用默认值
+func SetEndpoints(e Endpoints) {
+	endpointsMu.Lock()
+	defer endpointsMu.Unlock()
+	endpoints = e.withDefaults()
+}
+
+// CurrentEndpoints 获取当前使用的 API 地址
+func CurrentEndpoints() Endpoints {
+	endpointsMu.RLock()
+	defer endpointsMu.RUnlock()
+	return endpoints
+}
@@ -1,9 +1,40 @@
 package bili
 
+import "sync"
+
+// EventChanSize 事件队列的长度，弹幕较多时避免阻塞拉取与弹幕接收
+const EventChanSize = 1024
+
 const (
 	StartLive int = iota
 	StopLive
 	NewDanmu
+	// ResumeLive 重启或重载前已开播且仍在直播，不再提醒，仅恢复弹幕拉取
+	ResumeLive
+	// NewDynamic 新动态或新投稿的视频，Data 为 *Dynamic
+	NewDynamic
+	// TitleChange 直播中修改了标题，Data 为 *LiveRoomChangeData
+	TitleChange
+	// CoverChange 直播中更换了封面，Data 为 *LiveRoomChangeData
+	CoverChange
+	// NewGift 直播间收到礼物，Data 为 *GiftEventData
+	NewGift
+	// NewSuperChat 直播间收到醒目留言，Data 为 *SuperChatEventData
+	NewSuperChat
+	// NewGuard 直播间有人上舰，Data 为 *GuardEventData
+	NewGuard
+	// NewInteract 进入直播间、关注等互动，Data 为 *InteractEventData
+	NewInteract
+	// ServerStartLive 弹幕服务器推送的开播，Data 为 *UserInfo
+	ServerStartLive
+	// ServerStopLive 弹幕服务器推送的下播，Data 为 *UserInfo
+	ServerStopLive
+	// ServerRoomChange 弹幕服务器推送的直播间信息变更，Data 为 *RoomChangeEventData
+	ServerRoomChange
+	// WatchedChange 看过人数变化，Data 为 *WatchedChangeEventData
+	WatchedChange
+	// Popularity 心跳回复中的人气值，Data 为 *PopularityEventData
+	Popularity
 )
 
 type Event struct {
@@ -18,8 +49,99 @@ func NewEvent(eventType int, eventData interface{}) *Event {
 	}
 }
 
+// emitEvent 不阻塞地发送事件，队列已满时丢弃并返回 false
+// 仅用于弹幕服务器推送的事件，拉取产生的事件见 eventQueue
+func emitEvent(eventChan chan<- *Event, e *Event) bool {
+	select {
+	case eventChan <- e:
+		return true
+	default:
+		logger.Warnf("event queue is full, dropping event of type %d", e.Type)
+		return false
+	}
+}
+
+// eventQueue 不限长度的事件队列，用于开播、下播与新动态等拉取产生的、不能丢失的事件
+// 这类事件数量很少，push 从不阻塞，广播协程收到 notify 后通过 take 按顺序取出
+type eventQueue struct {
+	mu     sync.Mutex
+	events []*Event // mu protected
+	notify chan struct{}
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (q *eventQueue) push(e *Event) {
+	q.mu.Lock()
+	q.events = append(q.events, e)
+	q.mu.Unlock()
+
+	// a pending notification is enough for all events pushed so far
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take 取出所有事件
+func (q *eventQueue) take() []*Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	events := q.events
+	q.events = nil
+	return events
+}
+
 type DanmuEventData struct {
+	FromUid          int64
 	FromUserName     string
 	Content          string
+	MedalLevel       int
+	MedalRoomId      int64
+	StreamerUserInfo *UserInfo
+}
+
+type LiveRoomChangeData struct {
+	UserInfo *UserInfo
+	OldTitle string
+	OldCover string
+}
+
+type GiftEventData struct {
+	*GiftData
+	StreamerUserInfo *UserInfo
+}
+
+type SuperChatEventData struct {
+	*SuperChatData
+	StreamerUserInfo *UserInfo
+}
+
+type GuardEventData struct {
+	*GuardBuyData
+	StreamerUserInfo *UserInfo
+}
+
+type InteractEventData struct {
+	*InteractWordData
+	StreamerUserInfo *UserInfo
+}
+
+type RoomChangeEventData struct {
+	*RoomChangeData
+	StreamerUserInfo *UserInfo
+}
+
+type WatchedChangeEventData struct {
+	*WatchedChangeData
+	StreamerUserInfo *UserInfo
+}
+
+type PopularityEventData struct {
+	Popularity       uint32
 	StreamerUserInfo *UserInfo
 }
@@ -0,0 +1,46 @@
+package bili
+
+import "testing"
+
+func TestEmitEventDropsWhenFull(t *testing.T) {
+	eventChan := make(chan *Event, 1)
+	if !emitEvent(eventChan, NewEvent(NewDanmu, nil)) {
+		t.Fatal("expected the first danmu to be sent")
+	}
+	if emitEvent(eventChan, NewEvent(NewGift, nil)) {
+		t.Fatal("expected the gift to be dropped")
+	}
+}
+
+func TestEventQueueNeverBlocksNorLoses(t *testing.T) {
+	q := newEventQueue()
+	types := []int{StartLive, StopLive, StartLive, NewDynamic}
+	for _, typ := range types {
+		q.push(NewEvent(typ, nil))
+	}
+
+	// all pushes share a single notification
+	select {
+	case <-q.notify:
+	default:
+		t.Fatal("expected a notification")
+	}
+	select {
+	case <-q.notify:
+		t.Fatal("expected notifications to be coalesced")
+	default:
+	}
+
+	events := q.take()
+	if len(events) != len(types) {
+		t.Fatalf("expected %d events, got %d", len(types), len(events))
+	}
+	for i, e := range events {
+		if e.Type != types[i] {
+			t.Fatalf("event %d: expected type %d, got %d", i, types[i], e.Type)
+		}
+	}
+	if events = q.take(); len(events) != 0 {
+		t.Fatalf("expected the queue to be empty, got %d events", len(events))
+	}
+}
@@ -4,51 +4,207 @@ import (
 	"encoding/json"
 )
 import "errors"
+import "fmt"
+import "io"
 import "net/http"
 import "strconv"
 import "time"
 import "io/ioutil"
 
+// 默认的 API 地址，可通过配置文件中的 endpoints 修改
 const (
-	GetUserInfoApi     = "https://api.bilibili.com/x/space/acc/info"
-	GetLiveRoomInfoApi = "https://api.live.bilibili.com/room/v1/Room/room_init"
+	GetSpaceDynamicApi = "https://api.bilibili.com/x/polymer/web-dynamic/v1/feed/space"
+	GetDanmuInfoApi    = "https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo"
+	GetLiveStatusApi   = "https://api.live.bilibili.com/room/v1/Room/get_status_info_by_uids"
 
 	DefaultTimeout = 5 * time.Second
+	// MaxImageSize 下载封面等图片的大小上限
+	MaxImageSize = 10 << 20
+	// MaxLiveStatusBatch 批量获取直播状态时每次请求的用户数上限
+	MaxLiveStatusBatch = 50
 )
 
-func GetUserInfo(bid int64) (*UserInfo, error) {
-	req, err := http.NewRequest("GET", GetUserInfoApi, nil)
+// httpClient 所有 API 共用的 client，以便复用连接
+var httpClient = &http.Client{
+	Timeout: DefaultTimeout,
+}
+
+// ApiError API 返回的 code 不为 0
+type ApiError struct {
+	Api     string
+	Code    int
+	Message string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("%s return code is ERROR: %d %s", e.Api, e.Code, e.Message)
+}
+
+// IsRateLimited 请求是否因过于频繁被拒绝
+func IsRateLimited(err error) bool {
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case -412, -509, -799, http.StatusPreconditionFailed, http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkStatus 将被限流的 HTTP 状态码转换为 ApiError
+func checkStatus(api string, rsp *http.Response) error {
+	if rsp.StatusCode == http.StatusPreconditionFailed || rsp.StatusCode == http.StatusTooManyRequests {
+		return &ApiError{Api: api, Code: rsp.StatusCode, Message: rsp.Status}
+	}
+	return nil
+}
+
+// GetSpaceDynamics 获取用户空间的最新一页动态，包括投稿的视频
+func GetSpaceDynamics(bid int64) ([]DynamicItem, error) {
+	req, err := http.NewRequest("GET", CurrentEndpoints().SpaceDynamic, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	q := req.URL.Query()
-	q.Add("mid", strconv.FormatInt(bid, 10))
+	q.Add("host_mid", strconv.FormatInt(bid, 10))
 	req.URL.RawQuery = q.Encode()
 
-	client := http.Client{
-		Timeout: DefaultTimeout,
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
+	defer rsp.Body.Close()
+	if err = checkStatus("GetSpaceDynamicApi", rsp); err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicRsp := DynamicRsp{}
+	err = json.Unmarshal(body, &dynamicRsp)
+	if err != nil {
+		return nil, err
+	}
+
+	if dynamicRsp.Code != 0 {
+		return nil, &ApiError{Api: "GetSpaceDynamicApi", Code: dynamicRsp.Code, Message: dynamicRsp.Message}
+	}
+	return dynamicRsp.Data.Items, nil
+}
+
+// GetDanmuInfo 获取直播间的弹幕服务器列表与加入直播间所需的 token
+func GetDanmuInfo(roomId int64) (*DanmuInfo, error) {
+	req, err := http.NewRequest("GET", CurrentEndpoints().DanmuInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	q.Add("id", strconv.FormatInt(roomId, 10))
+	q.Add("type", "0")
+	req.URL.RawQuery = q.Encode()
 
-	rsp, err := client.Do(req)
+	rsp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer rsp.Body.Close()
+	if err = checkStatus("GetDanmuInfoApi", rsp); err != nil {
+		return nil, err
+	}
 
 	body, err := ioutil.ReadAll(rsp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	userInfoRsp := UserInfoRsp{}
-	err = json.Unmarshal(body, &userInfoRsp)
+	danmuInfoRsp := DanmuInfoRsp{}
+	err = json.Unmarshal(body, &danmuInfoRsp)
+	if err != nil {
+		return nil, err
+	}
+
+	if danmuInfoRsp.Code != 0 {
+		return nil, &ApiError{Api: "GetDanmuInfoApi", Code: danmuInfoRsp.Code, Message: danmuInfoRsp.Message}
+	}
+	return &danmuInfoRsp.Data, nil
+}
+
+// GetLiveStatus 批量获取用户的直播间信息，没有直播间的用户不在结果中
+// 用户数超过 MaxLiveStatusBatch 时分多次请求
+func GetLiveStatus(uids []int64) (map[int64]*UserInfo, error) {
+	rst := make(map[int64]*UserInfo)
+	for len(uids) > 0 {
+		n := len(uids)
+		if n > MaxLiveStatusBatch {
+			n = MaxLiveStatusBatch
+		}
+		if err := getLiveStatus(uids[:n], rst); err != nil {
+			return nil, err
+		}
+		uids = uids[n:]
+	}
+	return rst, nil
+}
+
+func getLiveStatus(uids []int64, rst map[int64]*UserInfo) error {
+	req, err := http.NewRequest("GET", CurrentEndpoints().LiveStatus, nil)
+	if err != nil {
+		return err
+	}
+
+	q := req.URL.Query()
+	for _, uid := range uids {
+		q.Add("uids[]", strconv.FormatInt(uid, 10))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if err = checkStatus("GetLiveStatusApi", rsp); err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+
+	liveStatusRsp := LiveStatusRsp{}
+	err = json.Unmarshal(body, &liveStatusRsp)
+	if err != nil {
+		return err
+	}
+
+	if liveStatusRsp.Code != 0 {
+		return &ApiError{Api: "GetLiveStatusApi", Code: liveStatusRsp.Code, Message: liveStatusRsp.Message}
+	}
+	for _, status := range liveStatusRsp.Data {
+		rst[status.Uid] = status.toUserInfo()
+	}
+	return nil
+}
+
+// GetImage 下载图片，如视频封面
+func GetImage(url string) ([]byte, error) {
+	rsp, err := httpClient.Get(url)
 	if err != nil {
 		return nil, err
 	}
+	defer rsp.Body.Close()
 
-	if userInfoRsp.Code != 0 {
-		return nil, errors.New("GetUserInfoApi return code is ERROR")
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", rsp.Status)
 	}
-	return &userInfoRsp.Data, nil
+	return ioutil.ReadAll(io.LimitReader(rsp.Body, MaxImageSize))
 }
@@ -1,14 +1,14 @@
 package bili
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/Mrs4s/MiraiGo/client"
 	"github.com/Mrs4s/MiraiGo/message"
 	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
 	"github.com/zhouziqunzzq/MiraiGo-DD/config"
-	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
-	"gopkg.in/yaml.v2"
-	"strings"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
 	"sync"
 	"time"
 )
@@ -16,14 +16,30 @@ import (
 type bili struct {
 	isEnabled            bool
 	config               Config
+	moduleConfig         *config.ModuleConfig[Config]
 	groupIdToBiliUidList map[int64][]int64 // subscriptionRwMu protected
 	biliUidToGroupIdList map[int64][]int64 // subscriptionRwMu protected
 	subscriptionRwMu     sync.RWMutex
+	subscriptionStore    *subscriptionStore
+	dynamicStore         *dynamicStore
+	templates            *liveTemplates
+	danmuRelayRules      map[int64][]*danmuRelayRule
+	danmuBatcher         *danmuBatcher
 	biliUserInfoBuf      map[int64]*UserInfo // infoBufRwMu protected
+	biliLiveSince        map[int64]time.Time // infoBufRwMu protected
+	liveSessions         *liveSessionStore
+	broadcastQueue       *broadcastQueue
+	fetcherQueue         *broadcastQueue // serializes starting and stopping the fetcher of a streamer
 	infoBufRwMu          sync.RWMutex
+	pollMu               sync.Mutex
+	emitMu               sync.Mutex // keeps events of consecutive polls in order
+	pollScheduler        *pollScheduler
 	biliUidToMsgFetcher  map[int64]*LiveMsgFetcher // fetcherRwMu protected
 	fetcherRwMu          sync.RWMutex
+	fetcherCtx           context.Context // canceled on stopping to stop all fetchers at once
+	stopFetchers         context.CancelFunc
 	eventChan            chan *Event
+	pollEvents           *eventQueue // kept on reloading so that no event is lost
 	quitPolling          chan bool
 	quitBroadcasting     chan bool
 }
@@ -34,9 +50,18 @@ func NewBili() *bili {
 		config:               Config{},
 		groupIdToBiliUidList: make(map[int64][]int64),
 		biliUidToGroupIdList: make(map[int64][]int64),
+		subscriptionStore:    newSubscriptionStore(""),
+		dynamicStore:         newDynamicStore(""),
+		pollScheduler:        newPollScheduler(DefaultPollingInterval * time.Second),
+		danmuBatcher:         newDanmuBatcher(0),
 		biliUserInfoBuf:      make(map[int64]*UserInfo),
+		biliLiveSince:        make(map[int64]time.Time),
+		liveSessions:         newLiveSessionStore(),
+		broadcastQueue:       newBroadcastQueue(),
+		fetcherQueue:         newBroadcastQueue(),
 		biliUidToMsgFetcher:  make(map[int64]*LiveMsgFetcher),
-		eventChan:            make(chan *Event),
+		eventChan:            make(chan *Event, EventChanSize),
+		pollEvents:           newEventQueue(),
 		quitPolling:          make(chan bool),
 		quitBroadcasting:     make(chan bool),
 	}
@@ -46,10 +71,29 @@ func (m *bili) MiraiGoModule() bot.ModuleInfo {
 	return bot.ModuleInfo{
 		ID:       ModuleName,
 		Instance: instance,
+		// 命令注册在 shell 中
+		Dependencies: []bot.ModuleID{shell.ModuleName},
 	}
 }
 
+// IsEnabled 本模块是否已成功初始化并启用
+func (m *bili) IsEnabled() bool {
+	return m.isEnabled
+}
+
 func (m *bili) Init() {
+	// reset states in case of reloading
+	// Note: biliUserInfoBuf is kept on purpose so that streamers already live
+	// won't be announced again after reloading.
+	m.config = Config{}
+	m.subscriptionRwMu.Lock()
+	m.groupIdToBiliUidList = make(map[int64][]int64)
+	m.biliUidToGroupIdList = make(map[int64][]int64)
+	m.subscriptionRwMu.Unlock()
+	m.quitPolling = make(chan bool)
+	m.quitBroadcasting = make(chan bool)
+	m.fetcherCtx, m.stopFetchers = context.WithCancel(context.Background())
+
 	// check is_enabled
 	m.isEnabled = config.GlobalConfig.GetBool("modules." + ModuleName + ".is_enabled")
 	if !m.isEnabled {
@@ -58,39 +102,75 @@ func (m *bili) Init() {
 	}
 
 	// load module config
-	configPath := config.GlobalConfig.GetString("modules." + ModuleName + ".config_path")
-	if configPath == "" {
-		configPath = "./bili.yaml"
-	}
-	logger.Debugf("reading config from %s", configPath)
-	cb := utils.ReadFile(configPath)
-	err := yaml.Unmarshal(cb, &m.config)
+	m.moduleConfig = config.NewModuleConfig[Config](ModuleName, "./bili.yaml")
+	cfg, err := m.moduleConfig.Load()
 	if err != nil {
-		logger.WithError(err).Errorf("unable to read config file in %s", configPath)
+		logger.WithError(err).Error("unable to load module config")
+		m.isEnabled = false
+		return
+	}
+	m.config = *cfg
+	if err = m.moduleConfig.Watch(m.OnConfigChange); err != nil {
+		logger.WithError(err).Warn("unable to watch module config, hot reload disabled")
+	}
+
+	SetEndpoints(m.config.Endpoints)
+	m.pollScheduler = newPollScheduler(time.Duration(m.config.PollingInterval) * time.Second)
+
+	// compile msg templates, already validated along with the config
+	if m.templates, err = parseTemplates(m.config.Templates, m.config.GroupTemplates); err != nil {
+		logger.WithError(err).Error("unable to parse msg templates")
+		m.isEnabled = false
+		return
+	}
+
+	if m.danmuRelayRules, err = parseDanmuRelayRules(m.config.DanmuRelayRules); err != nil {
+		logger.WithError(err).Error("unable to parse danmu relay rules")
+		m.isEnabled = false
+		return
+	}
+	m.danmuBatcher = newDanmuBatcher(m.config.DanmuBatchWindow)
+
+	// load subscription changed by cmds
+	m.subscriptionStore = newSubscriptionStore(m.config.SubscriptionStorePath)
+	if err = m.subscriptionStore.load(); err != nil {
+		logger.WithError(err).Errorf("unable to load subscription from %s", m.config.SubscriptionStorePath)
 		m.isEnabled = false
 		return
 	}
 
 	// load subscription
-	// group ID -> bilibili UID list
-	m.groupIdToBiliUidList = m.config.Subscription
-	logger.Infof("group ID to bilibili UID List: %v", m.groupIdToBiliUidList)
-	// bilibili UID -> group ID list (inverse mapping)
-	for groupId, BiliUidList := range m.groupIdToBiliUidList {
-		for _, uid := range BiliUidList {
-			if _, ok := m.biliUidToGroupIdList[uid]; !ok {
-				m.biliUidToGroupIdList[uid] = make([]int64, 0)
-			}
-			m.biliUidToGroupIdList[uid] = append(m.biliUidToGroupIdList[uid], groupId)
+	// group ID -> bilibili UID list, and bilibili UID -> group ID list (inverse mapping)
+	m.subscriptionRwMu.Lock()
+	for groupId, biliUidList := range m.subscriptionStore.apply(m.config.Subscription) {
+		for _, uid := range biliUidList {
+			m.addSubscription(groupId, uid)
 		}
 	}
+	logger.Infof("group ID to bilibili UID List: %v", m.groupIdToBiliUidList)
 	logger.Infof("bilibili UID to group ID List: %v", m.biliUidToGroupIdList)
+	m.subscriptionRwMu.Unlock()
+
+	// restore live state, so that streamers already live won't be announced again after restarting
+	if err = m.loadLiveState(); err != nil {
+		logger.WithError(err).Warnf("unable to restore live state from %s", m.config.LiveStatePath)
+	}
+
+	// load dynamics already announced
+	m.dynamicStore = newDynamicStore(m.config.DynamicStatePath)
+	if err = m.dynamicStore.load(); err != nil {
+		logger.WithError(err).Warnf("unable to load dynamic state from %s", m.config.DynamicStatePath)
+	}
 }
 
 func (m *bili) PostInit() {
 	// 第二次初始化
 	// 再次过程中可以进行跨Module的动作
 	// 如通用数据库等等
+
+	if m.isEnabled {
+		m.registerCommands()
+	}
 }
 
 func (m *bili) Serve(b *bot.Bot) {
@@ -108,16 +188,39 @@ func (m *bili) Start(b *bot.Bot) {
 	// 可以利用此部分进行后台操作
 	// 如http服务器等等
 
+	if !m.isEnabled {
+		return
+	}
+
+	// capture quit channels since they are recreated on reloading
+	quitPolling, quitBroadcasting := m.quitPolling, m.quitBroadcasting
+
 	// start polling coroutine
 	go func() {
-		ticker := time.NewTicker(time.Duration(m.config.PollingInterval) * time.Second)
+		// Note: check due users frequently, each user is polled at its own jittered interval
+		ticker := time.NewTicker(m.pollScheduler.tick())
 		for {
 			// perform polling at the very beginning
 			m.pollBiliUserInfo()
 			select {
 			case <-ticker.C:
 				continue
-			case <-m.quitPolling:
+			case <-quitPolling:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	// start dynamic polling coroutine
+	go func() {
+		ticker := time.NewTicker(time.Duration(m.config.DynamicPollingInterval) * time.Second)
+		for {
+			m.pollDynamics()
+			select {
+			case <-ticker.C:
+				continue
+			case <-quitPolling:
 				ticker.Stop()
 				return
 			}
@@ -127,11 +230,11 @@ func (m *bili) Start(b *bot.Bot) {
 	// start event broadcasting coroutine
 	go func() {
 		// wait until bot is online
-		for {
-			if b.Online.Load() {
-				break
-			} else {
-				time.Sleep(1 * time.Second)
+		for !b.Client().IsOnline() {
+			select {
+			case <-time.After(1 * time.Second):
+			case <-quitBroadcasting:
+				return
 			}
 		}
 
@@ -139,40 +242,12 @@ func (m *bili) Start(b *bot.Bot) {
 		for {
 			select {
 			case e := <-m.eventChan:
-				switch e.Type {
-				case StartLive:
-					if userInfo, ok := e.Data.(*UserInfo); ok {
-						m.broadcastStartLiveMsg(b.QQClient, userInfo)
-						// start fetching danmu for this user
-						m.runLiveMsgFetcherForBiliUser(int64(userInfo.Mid))
-					} else {
-						logger.Errorf("unknown event data provided for StartLive, event: %v", e)
-					}
-				case StopLive:
-					if userInfo, ok := e.Data.(*UserInfo); ok {
-						m.broadcastStopLiveMsg(b.QQClient, userInfo)
-						// stop fetching danmu for this user
-						// Note: BLOCKING call! Call from a new goroutine!
-						go m.stopLiveMsgFetcherForBiliUser(int64(userInfo.Mid))
-					} else {
-						logger.Errorf("unknown event data provided for StopLive, event: %v", e)
-					}
-				case NewDanmu:
-					if danmuData, ok := e.Data.(*DanmuEventData); ok {
-						// check danmu keywords
-						for _, w := range m.config.DanmuForwardKeywords {
-							if strings.Contains(danmuData.Content, w) {
-								m.broadcastDanmu(b.QQClient, danmuData)
-								break
-							}
-						}
-					} else {
-						logger.Errorf("unknown event data provided for NewDanmu, event: %v", e)
-					}
-				default:
-					logger.Debugf("unknown event type %d encountered, skipping", e.Type)
+				m.handleEvent(b, e)
+			case <-m.pollEvents.notify:
+				for _, e := range m.pollEvents.take() {
+					m.handleEvent(b, e)
 				}
-			case <-m.quitBroadcasting:
+			case <-quitBroadcasting:
 				return
 			}
 		}
@@ -192,26 +267,139 @@ func (m *bili) Start(b *bot.Bot) {
 	//m.runLiveMsgFetcherForBiliUser(407106379)
 }
 
+// handleEvent 在广播协程中处理一个事件
+func (m *bili) handleEvent(b *bot.Bot, e *Event) {
+	switch e.Type {
+	// Note: live msgs of a streamer are broadcast through broadcastQueue in the order of events,
+	// so that e.g. a stop-live msg never overtakes the start-live msg still uploading its cover.
+	case StartLive:
+		if userInfo, ok := e.Data.(*UserInfo); ok {
+			// downloading and uploading the cover takes a while
+			m.broadcastQueue.run(int64(userInfo.Mid), func() {
+				m.broadcastStartLiveMsg(b.Client(), userInfo)
+			})
+			// start fetching danmu for this user
+			m.runLiveMsgFetcherForBiliUser(int64(userInfo.Mid))
+		} else {
+			logger.Errorf("unknown event data provided for StartLive, event: %v", e)
+		}
+	case StopLive:
+		if userInfo, ok := e.Data.(*UserInfo); ok {
+			session := m.liveSessions.finish(int64(userInfo.Mid))
+			m.broadcastQueue.run(int64(userInfo.Mid), func() {
+				m.broadcastStopLiveMsg(b.Client(), userInfo)
+				if session != nil {
+					m.broadcastLiveSummary(b.Client(), userInfo, session)
+				}
+			})
+			// stop fetching danmu for this user
+			m.stopLiveMsgFetcherForBiliUser(int64(userInfo.Mid))
+		} else {
+			logger.Errorf("unknown event data provided for StopLive, event: %v", e)
+		}
+	case ResumeLive:
+		if userInfo, ok := e.Data.(*UserInfo); ok {
+			// resume fetching danmu for this user without announcing
+			m.runLiveMsgFetcherForBiliUser(int64(userInfo.Mid))
+		} else {
+			logger.Errorf("unknown event data provided for ResumeLive, event: %v", e)
+		}
+	case TitleChange, CoverChange:
+		if data, ok := e.Data.(*LiveRoomChangeData); ok {
+			m.broadcastQueue.run(int64(data.UserInfo.Mid), func() {
+				m.broadcastLiveRoomChangeMsg(b.Client(), e.Type, data)
+			})
+		} else {
+			logger.Errorf("unknown event data provided for live room change, event: %v", e)
+		}
+	case NewDynamic:
+		if d, ok := e.Data.(*Dynamic); ok {
+			// downloading and uploading the cover takes a while
+			go m.broadcastDynamic(b.Client(), d)
+		} else {
+			logger.Errorf("unknown event data provided for NewDynamic, event: %v", e)
+		}
+	case NewDanmu:
+		m.recordLiveSession(e)
+		if danmuData, ok := e.Data.(*DanmuEventData); ok {
+			m.relayDanmu(danmuData)
+		} else {
+			logger.Errorf("unknown event data provided for NewDanmu, event: %v", e)
+		}
+	case NewSuperChat:
+		m.recordLiveSession(e)
+		if data, ok := e.Data.(*SuperChatEventData); ok {
+			m.broadcastSuperChat(data)
+		} else {
+			logger.Errorf("unknown event data provided for NewSuperChat, event: %v", e)
+		}
+	case NewGuard:
+		m.recordLiveSession(e)
+		if data, ok := e.Data.(*GuardEventData); ok {
+			m.broadcastGuard(data)
+		} else {
+			logger.Errorf("unknown event data provided for NewGuard, event: %v", e)
+		}
+	case ServerStartLive, ServerStopLive:
+		if userInfo, ok := e.Data.(*UserInfo); ok {
+			go m.recheckBiliUser(int64(userInfo.Mid))
+		} else {
+			logger.Errorf("unknown event data provided for live status push, event: %v", e)
+		}
+	case ServerRoomChange:
+		if data, ok := e.Data.(*RoomChangeEventData); ok {
+			go m.recheckBiliUser(int64(data.StreamerUserInfo.Mid))
+		} else {
+			logger.Errorf("unknown event data provided for ServerRoomChange, event: %v", e)
+		}
+	case NewGift, Popularity:
+		// only counted in the live summary
+		m.recordLiveSession(e)
+	case NewInteract, WatchedChange:
+		// not broadcasted
+	default:
+		logger.Debugf("unknown event type %d encountered, skipping", e.Type)
+	}
+}
+
 func (m *bili) Stop(b *bot.Bot, wg *sync.WaitGroup) {
 	// 别忘了解锁
 	defer wg.Done()
+
+	// stop watching module config
+	if m.moduleConfig != nil {
+		m.moduleConfig.Close()
+	}
+	shell.UnregisterCommands(ModuleName)
 	// 结束部分
 	// 一般调用此函数时，程序接收到 os.Interrupt 信号
 	// 即将退出
 	// 在此处应该释放相应的资源或者对状态进行保存
 
+	if !m.isEnabled {
+		return
+	}
+
 	// stop polling coroutine
-	m.quitPolling <- true
+	close(m.quitPolling)
 
 	// stop broadcasting coroutine
-	m.quitBroadcasting <- true
+	close(m.quitBroadcasting)
 
-	// stop live fetchers
-	m.fetcherRwMu.RLock()
-	for _, f := range m.biliUidToMsgFetcher {
-		f.Stop()
+	// send danmu still waiting to be batched
+	m.danmuBatcher.flushAll()
+
+	// save live state for next start
+	if err := m.saveLiveState(); err != nil {
+		logger.WithError(err).Errorf("failed to save live state to %s", m.config.LiveStatePath)
 	}
-	m.fetcherRwMu.RUnlock()
+
+	m.stopAllLiveMsgFetchers()
+}
+
+// OnConfigChange 模块配置文件变更后重载本模块以应用新配置
+func (m *bili) OnConfigChange(*Config) {
+	bot.ReloadModuleAsync(ModuleName)
 }
 
 func (m *bili) registerCallbacks(b *bot.Bot) {
@@ -230,152 +418,357 @@ func (m *bili) getBiliUidList() []int64 {
 	return l
 }
 
+// pollBiliUserInfo 批量拉取到期的用户的直播状态，被限流时暂停拉取
 func (m *bili) pollBiliUserInfo() {
-	logger.Debug("start polling subscribed bilibili user info")
+	now := time.Now()
+	if m.pollScheduler.isBackingOff(now) {
+		logger.Debug("polling is backing off, skipping")
+		return
+	}
+	uidList := m.pollScheduler.due(m.getBiliUidList(), now)
+	if len(uidList) == 0 {
+		return
+	}
+	logger.Debugf("start polling live status of %d bilibili users", len(uidList))
 
-	uidList := m.getBiliUidList()
-	for _, uid := range uidList {
-		// call http api
-		newUserInfo, err := GetUserInfo(uid)
-		if err != nil {
-			logger.WithError(err).Errorf("failed to get user info for bid=%d", uid)
-			continue
+	if err := m.pollBiliUsers(uidList); err != nil {
+		if IsRateLimited(err) {
+			d := m.pollScheduler.backOff(now)
+			logger.WithError(err).Warnf("polling is rate limited, backing off for %s", d)
+			return
 		}
+		logger.WithError(err).Errorf("failed to poll live status of bilibili users %v", uidList)
+	} else {
+		m.pollScheduler.resetBackoff()
+	}
+	m.pollScheduler.schedule(uidList, now)
 
-		m.infoBufRwMu.Lock()
-
-		// update info buf and trigger events
-		if oldUserInfo, ok := m.biliUserInfoBuf[uid]; ok {
-			// we have old user info, check status change
-			if oldUserInfo.LiveRoom.LiveStatus == NotStreaming && newUserInfo.LiveRoom.LiveStatus == Streaming {
-				logger.Infof("bilibili user %s(%d) has started streaming", newUserInfo.Name, uid)
-				e := NewEvent(StartLive, newUserInfo)
-				m.eventChan <- e
-			} else if oldUserInfo.LiveRoom.LiveStatus == Streaming && newUserInfo.LiveRoom.LiveStatus == NotStreaming {
-				logger.Infof("bilibili user %s(%d) has stopped streaming", newUserInfo.Name, uid)
-				e := NewEvent(StopLive, newUserInfo)
-				m.eventChan <- e
-			}
+	if err := m.saveLiveState(); err != nil {
+		logger.WithError(err).Errorf("failed to save live state to %s", m.config.LiveStatePath)
+	}
+
+	logger.Debugf("finish polling live status of %d bilibili users", len(uidList))
+}
+
+// recheckBiliUser 收到弹幕服务器推送的开播、下播或直播间变更时立即拉取一次用户信息，
+// 不直接修改状态，避免与轮询的结果不一致而重复提醒
+func (m *bili) recheckBiliUser(uid int64) {
+	m.pollBiliUser(uid)
+	m.saveLiveState()
+}
+
+// pollBiliUser 拉取单个用户的直播状态，并在开播或下播时触发事件
+func (m *bili) pollBiliUser(uid int64) {
+	if err := m.pollBiliUsers([]int64{uid}); err != nil {
+		logger.WithError(err).Errorf("failed to get live status for bid=%d", uid)
+	}
+}
+
+// pollBiliUsers 批量拉取用户的直播状态，并在开播或下播时触发事件
+func (m *bili) pollBiliUsers(uids []int64) error {
+	// Note: polls are serialized so that a stale response never overrides a newer one
+	m.pollMu.Lock()
+	events, err := m.fetchLiveStatus(uids)
+	// Note: emit after releasing pollMu, while emitMu keeps the order of events across polls
+	m.emitMu.Lock()
+	m.pollMu.Unlock()
+	for _, e := range events {
+		m.pollEvents.push(e)
+	}
+	m.emitMu.Unlock()
+	return err
+}
+
+// fetchLiveStatus 拉取用户的直播状态并更新缓存，返回需要触发的事件
+// 调用方需持有 pollMu
+func (m *bili) fetchLiveStatus(uids []int64) ([]*Event, error) {
+	// call http api
+	infos, err := GetLiveStatus(uids)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*Event, 0)
+	for _, uid := range uids {
+		if info, ok := infos[uid]; ok {
+			events = append(events, m.updateBiliUserInfo(uid, info)...)
 		} else {
-			// we don't have old user info, just check current status
-			if newUserInfo.LiveRoom.LiveStatus == Streaming {
-				logger.Infof("bilibili user %s(%d) has started streaming", newUserInfo.Name, uid)
-				e := NewEvent(StartLive, newUserInfo)
-				m.eventChan <- e
+			logger.Debugf("bilibili user %d has no live room, skipping", uid)
+		}
+	}
+	return events, nil
+}
+
+// updateBiliUserInfo 更新用户信息缓存，返回开播、下播等需要触发的事件
+func (m *bili) updateBiliUserInfo(uid int64, newUserInfo *UserInfo) []*Event {
+	// Note: check it before locking infoBufRwMu, which is always locked after fetcherRwMu
+	isFetching := m.hasLiveMsgFetcher(uid)
+
+	m.infoBufRwMu.Lock()
+	defer m.infoBufRwMu.Unlock()
+
+	// update info buf and trigger events
+	events := make([]*Event, 0)
+	if oldUserInfo, ok := m.biliUserInfoBuf[uid]; ok {
+		// we have old user info, check status change
+		if oldUserInfo.LiveRoom.LiveStatus == NotStreaming && newUserInfo.LiveRoom.LiveStatus == Streaming {
+			logger.Infof("bilibili user %s(%d) has started streaming", newUserInfo.Name, uid)
+			m.biliLiveSince[uid] = time.Now()
+			m.liveSessions.start(uid, m.biliLiveSince[uid])
+			events = append(events, NewEvent(StartLive, newUserInfo))
+		} else if oldUserInfo.LiveRoom.LiveStatus == Streaming && newUserInfo.LiveRoom.LiveStatus == NotStreaming {
+			logger.Infof("bilibili user %s(%d) has stopped streaming", newUserInfo.Name, uid)
+			delete(m.biliLiveSince, uid)
+			events = append(events, NewEvent(StopLive, newUserInfo))
+		} else if newUserInfo.LiveRoom.LiveStatus == Streaming {
+			if !isFetching {
+				// still streaming since last restart or reload
+				logger.Infof("bilibili user %s(%d) is still streaming", newUserInfo.Name, uid)
+				// Note: stats before restarting are lost, only the duration is kept
+				if since, ok := m.biliLiveSince[uid]; ok {
+					m.liveSessions.start(uid, since)
+				}
+				events = append(events, NewEvent(ResumeLive, newUserInfo))
+			}
+			if oldUserInfo.LiveRoom.LiveStatus == Streaming {
+				events = append(events, liveRoomChangeEvents(oldUserInfo, newUserInfo)...)
 			}
 		}
-		m.biliUserInfoBuf[uid] = newUserInfo
+	} else {
+		// we don't have old user info, just check current status
+		if newUserInfo.LiveRoom.LiveStatus == Streaming {
+			logger.Infof("bilibili user %s(%d) has started streaming", newUserInfo.Name, uid)
+			m.biliLiveSince[uid] = time.Now()
+			m.liveSessions.start(uid, m.biliLiveSince[uid])
+			events = append(events, NewEvent(StartLive, newUserInfo))
+		}
+	}
+	m.biliUserInfoBuf[uid] = newUserInfo
+	return events
+}
+
+// liveRoomChangeEvents 检查直播中标题与封面的变化
+func liveRoomChangeEvents(oldUserInfo, newUserInfo *UserInfo) []*Event {
+	events := make([]*Event, 0)
+	data := &LiveRoomChangeData{
+		UserInfo: newUserInfo,
+		OldTitle: oldUserInfo.LiveRoom.Title,
+		OldCover: oldUserInfo.LiveRoom.Cover,
+	}
+	if data.OldTitle != newUserInfo.LiveRoom.Title {
+		logger.Infof("bilibili user %s(%d) has changed live room title to %s",
+			newUserInfo.Name, newUserInfo.Mid, newUserInfo.LiveRoom.Title)
+		events = append(events, NewEvent(TitleChange, data))
+	}
+	if data.OldCover != newUserInfo.LiveRoom.Cover {
+		logger.Infof("bilibili user %s(%d) has changed live room cover", newUserInfo.Name, newUserInfo.Mid)
+		events = append(events, NewEvent(CoverChange, data))
+	}
+	return events
+}
+
+func (m *bili) broadcastStartLiveMsg(qqClient bot.Client, userInfo *UserInfo) {
+	cover := m.getCover(userInfo.LiveRoom.Cover)
+	m.broadcastLiveMsg(qqClient, userInfo, TemplateStartLive, newLiveTemplateData(userInfo), "", cover, true)
+}
+
+func (m *bili) broadcastStopLiveMsg(qqClient bot.Client, userInfo *UserInfo) {
+	m.broadcastLiveMsg(qqClient, userInfo, TemplateStopLive, newLiveTemplateData(userInfo), "", nil, false)
+}
 
-		m.infoBufRwMu.Unlock()
+func (m *bili) broadcastLiveRoomChangeMsg(qqClient bot.Client, eventType int, data *LiveRoomChangeData) {
+	tplData := newLiveTemplateData(data.UserInfo)
+	if eventType == TitleChange {
+		tplData.OldTitle = data.OldTitle
+		m.broadcastLiveMsg(qqClient, data.UserInfo, TemplateTitleChange, tplData, NotifyRoomChange, nil, false)
+	} else {
+		cover := m.getCover(data.UserInfo.LiveRoom.Cover)
+		m.broadcastLiveMsg(qqClient, data.UserInfo, TemplateCoverChange, tplData, NotifyRoomChange, cover, false)
 	}
+}
 
-	logger.Debugf("finish polling %d subscribed bilibili user info", len(uidList))
+// getCover 下载直播间封面，失败时返回 nil
+func (m *bili) getCover(url string) []byte {
+	if len(url) == 0 {
+		return nil
+	}
+	cover, err := GetImage(url)
+	if err != nil {
+		logger.WithError(err).Warnf("failed to download cover %s", url)
+		return nil
+	}
+	return cover
 }
 
-func (m *bili) broadcastStartLiveMsg(qqClient *client.QQClient, userInfo *UserInfo) {
-	msg := message.NewSendingMessage()
-	msg.Append(message.NewText(fmt.Sprintf(
-		"您关注的%s开播啦！快去直播间 DD 吧～\n直播间标题：%s\n直播间链接：%s",
-		userInfo.Name, userInfo.LiveRoom.Title, userInfo.LiveRoom.Url,
-	)))
+// broadcastLiveMsg 使用各群的模板 tplName 向订阅了 userInfo 的群发送直播相关提醒
+// notifyType 非空时仅发送给开启了该提醒的群，cover 非空时附带封面图
+// atAll 为 true 时，在 at_all_groups 中且 Bot 为管理员的群内 @全体成员
+func (m *bili) broadcastLiveMsg(
+	qqClient bot.Client,
+	userInfo *UserInfo,
+	tplName string,
+	tplData *liveTemplateData,
+	notifyType NotifyType,
+	cover []byte,
+	atAll bool,
+) {
+	for _, gid := range m.groupsToNotify(int64(userInfo.Mid), notifyType) {
+		text, err := m.templates.render(gid, tplName, tplData)
+		if err != nil {
+			logger.WithError(err).Errorf("failed to render template %s for group %d", tplName, gid)
+			continue
+		}
+
+		msg := message.NewSendingMessage()
+		if atAll && m.isAtAllGroup(gid) && isGroupAdmin(qqClient, gid) {
+			msg.Append(message.AtAll())
+			msg.Append(message.NewText("\n"))
+		}
+		msg.Append(message.NewText(text))
+		sendWithImage(qqClient, gid, msg, cover)
+	}
+}
+
+// sendWithImage 向群 gid 发送消息 msg，img 非空时将其上传并附在消息末尾
+// 图片上传失败时仍发送不带图片的消息
+func sendWithImage(qqClient bot.Client, gid int64, msg *message.SendingMessage, img []byte) {
+	if len(img) > 0 {
+		// images are uploaded per group
+		if elem, err := qqClient.UploadGroupImage(gid, bytes.NewReader(img)); err != nil {
+			logger.WithError(err).Warnf("failed to upload image to group %d", gid)
+		} else {
+			msg.Append(elem)
+		}
+	}
+	bot.SendGroupMessage(gid, msg, bot.PriorityLow)
+}
+
+func (m *bili) isAtAllGroup(gid int64) bool {
+	for _, g := range m.config.AtAllGroups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
 
-	m.broadcastMsgToSubscribedGroup(qqClient, msg, int64(userInfo.Mid))
+// isGroupAdmin Bot 是否为群 gid 的管理员或群主
+func isGroupAdmin(qqClient bot.Client, gid int64) bool {
+	group := qqClient.FindGroup(gid)
+	if group == nil {
+		return false
+	}
+	self := group.FindMember(qqClient.BotUin())
+	return self != nil && (self.Permission == client.Administrator || self.Permission == client.Owner)
 }
 
-func (m *bili) broadcastStopLiveMsg(qqClient *client.QQClient, userInfo *UserInfo) {
+func (m *bili) broadcastSuperChat(data *SuperChatEventData) {
 	msg := message.NewSendingMessage()
 	msg.Append(message.NewText(fmt.Sprintf(
-		"您关注的%s下播啦！感谢观看，记得下次再来 DD 哦～",
-		userInfo.Name,
+		"【醒目留言】\n主播：%s\n发送人：%s\n金额：%d 元\n内容：%s",
+		data.StreamerUserInfo.Name, data.UserInfo.Uname, data.Price, data.Message,
 	)))
-
-	m.broadcastMsgToSubscribedGroup(qqClient, msg, int64(userInfo.Mid))
+	for _, gid := range m.groupsToNotify(int64(data.StreamerUserInfo.Mid), NotifySuperChat) {
+		bot.SendGroupMessage(gid, msg, bot.PriorityLow)
+	}
 }
 
-func (m *bili) broadcastDanmu(qqClient *client.QQClient, danmuData *DanmuEventData) {
-	userInfo := danmuData.StreamerUserInfo
+func (m *bili) broadcastGuard(data *GuardEventData) {
 	msg := message.NewSendingMessage()
 	msg.Append(message.NewText(fmt.Sprintf(
-		"【弹幕中继】\n主播：%s\n直播间标题：%s\n发送人：%s\n内容：%s",
-		userInfo.Name, userInfo.LiveRoom.Title, danmuData.FromUserName, danmuData.Content,
+		"【上舰】\n主播：%s\n%s 开通了 %d 个月的%s",
+		data.StreamerUserInfo.Name, data.Username, data.Num, GuardLevelName(data.GuardLevel),
 	)))
-
-	m.broadcastMsgToSubscribedGroup(qqClient, msg, int64(userInfo.Mid))
+	for _, gid := range m.groupsToNotify(int64(data.StreamerUserInfo.Mid), NotifyGuard) {
+		bot.SendGroupMessage(gid, msg, bot.PriorityLow)
+	}
 }
 
-func (m *bili) broadcastMsgToSubscribedGroup(qqClient *client.QQClient, msg *message.SendingMessage, bid int64) {
-	m.subscriptionRwMu.RLock()
-	defer m.subscriptionRwMu.RUnlock()
+// runLiveMsgFetcherForBiliUser 为 bid 启动弹幕获取，已有的实例会先被停止
+// 不会阻塞，同一主播的启动与停止经 fetcherQueue 按调用顺序执行
+func (m *bili) runLiveMsgFetcherForBiliUser(bid int64) {
+	ctx := m.fetcherCtx
+	m.fetcherQueue.run(bid, func() {
+		m.startLiveMsgFetcher(ctx, bid)
+	})
+}
 
-	if l, ok := m.biliUidToGroupIdList[bid]; !ok {
-		logger.Errorf("bilibili user %d not found in subscription map", bid)
-		return
-	} else {
-		for _, groupId := range l {
-			qqClient.SendGroupMessage(groupId, msg)
+// stopLiveMsgFetcherForBiliUser 停止 bid 的弹幕获取
+// 不会阻塞，同一主播的启动与停止经 fetcherQueue 按调用顺序执行
+func (m *bili) stopLiveMsgFetcherForBiliUser(bid int64) {
+	m.fetcherQueue.run(bid, func() {
+		if fetcher := m.takeLiveMsgFetcher(bid); fetcher == nil {
+			logger.Debugf("no live msg fetcher instance found for bid %d, ignoring...", bid)
+		} else {
+			logger.Infof("stopping live msg fetcher for bid %d", bid)
+			fetcher.Stop()
+			logger.Infof("successfully stopped live msg fetcher for bid %d", bid)
 		}
-	}
+	})
 }
 
-func (m *bili) runLiveMsgFetcherForBiliUser(bid int64) {
-	m.fetcherRwMu.Lock()
-	defer m.fetcherRwMu.Unlock()
-
-	if fetcher, ok := m.biliUidToMsgFetcher[bid]; ok {
+// Note: BLOCKING call!! It waits for the stale fetcher to disconnect, only call from fetcherQueue.
+func (m *bili) startLiveMsgFetcher(ctx context.Context, bid int64) {
+	if fetcher := m.takeLiveMsgFetcher(bid); fetcher != nil {
 		// Note: we stop the stale live msg fetcher first because the live might
 		// have been cut off abnormally and the live msg fetcher had been corrupted.
-		logger.Warnf("live msg fetcher instance for bid %d already exist, stopping stable instance...", bid)
+		logger.Warnf("live msg fetcher instance for bid %d already exist, stopping stale instance...", bid)
 		fetcher.Stop()
-		delete(m.biliUidToMsgFetcher, bid)
 		logger.Infof("successfully stopped live msg fetcher for bid %d", bid)
 	}
 
 	// get userinfo from buf
 	m.infoBufRwMu.RLock()
-	defer m.infoBufRwMu.RUnlock()
-	if info, ok := m.biliUserInfoBuf[bid]; !ok {
+	info, ok := m.biliUserInfoBuf[bid]
+	m.infoBufRwMu.RUnlock()
+	if !ok {
 		logger.Errorf("invalid bili uid %d, ignoring...", bid)
-	} else {
-		logger.Infof("starting live msg fetcher for bid %d", bid)
-		fetcher := NewLiveMsgFetcher(info, m.eventChan)
-		initSuccess := false
-		for i := 1; i <= MaxReconnection; i++ {
-			err := fetcher.Init()
-			if err != nil {
-				logger.WithError(err).Errorf(
-					"failed to initialize live msg fetcher for bid %d, retrying (%d/%d)",
-					bid, i, MaxReconnection,
-				)
-			} else {
-				initSuccess = true
-				break
-			}
-		}
-		if initSuccess {
-			fetcher.Run()
-			m.biliUidToMsgFetcher[bid] = fetcher
-			logger.Infof("successfully started live msg fetcher for bid %d", bid)
-		} else {
-			logger.Errorf(
-				"failed to initialize live msg fetcher for bid %d after %d attempts",
-				bid, MaxReconnection,
-			)
-		}
+		return
+	}
+
+	m.fetcherRwMu.Lock()
+	defer m.fetcherRwMu.Unlock()
+	// Note: the module might have been stopped while this task was waiting,
+	// checked under fetcherRwMu so that Stop never misses the new fetcher.
+	if ctx.Err() != nil {
+		logger.Infof("module stopped, not starting live msg fetcher for bid %d", bid)
+		return
 	}
+	logger.Infof("starting live msg fetcher for bid %d", bid)
+	// Note: connecting and reconnecting happen in the background, this never blocks
+	fetcher := NewLiveMsgFetcher(info, m.eventChan)
+	fetcher.Start(ctx)
+	m.biliUidToMsgFetcher[bid] = fetcher
 }
 
-// Note: BLOCKING call!! Refrain from calling directly from event broadcasting goroutine
-// since it might cause deadlock between that goroutine and message loop goroutine.
-func (m *bili) stopLiveMsgFetcherForBiliUser(bid int64) {
+// takeLiveMsgFetcher 从表中移除并返回 bid 的弹幕获取实例，不存在时返回 nil
+// Note: the fetcher is stopped by the caller without holding fetcherRwMu
+func (m *bili) takeLiveMsgFetcher(bid int64) *LiveMsgFetcher {
 	m.fetcherRwMu.Lock()
 	defer m.fetcherRwMu.Unlock()
+	fetcher, ok := m.biliUidToMsgFetcher[bid]
+	if !ok {
+		return nil
+	}
+	delete(m.biliUidToMsgFetcher, bid)
+	return fetcher
+}
 
-	if fetcher, ok := m.biliUidToMsgFetcher[bid]; !ok {
-		logger.Warnf("no live msg fetcher instance found for bid %d, ignoring...", bid)
-	} else {
-		logger.Infof("stopping live msg fetcher for bid %d", bid)
-		fetcher.Stop()
+// stopAllLiveMsgFetchers 停止所有弹幕获取，此后排队中的启动任务不再生效
+func (m *bili) stopAllLiveMsgFetchers() {
+	// live fetchers are canceled together and then waited one by one
+	m.stopFetchers()
+	m.fetcherRwMu.Lock()
+	defer m.fetcherRwMu.Unlock()
+	for bid, f := range m.biliUidToMsgFetcher {
+		f.Stop()
 		delete(m.biliUidToMsgFetcher, bid)
-		logger.Infof("successfully stopped live msg fetcher for bid %d", bid)
 	}
 }
+
+func (m *bili) hasLiveMsgFetcher(bid int64) bool {
+	m.fetcherRwMu.RLock()
+	defer m.fetcherRwMu.RUnlock()
+	_, ok := m.biliUidToMsgFetcher[bid]
+	return ok
+}
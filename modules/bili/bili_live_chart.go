@@ -0,0 +1,161 @@
+package bili
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+const (
+	chartWidth   = 640
+	chartHeight  = 320
+	chartMargin  = 20
+	maxChartBars = 120
+)
+
+var (
+	chartBgColor         = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	chartAxisColor       = color.RGBA{R: 0x99, G: 0x99, B: 0x99, A: 0xff}
+	chartGridColor       = color.RGBA{R: 0xee, G: 0xee, B: 0xee, A: 0xff}
+	chartDanmuColor      = color.RGBA{R: 0x7e, G: 0xc8, B: 0xf0, A: 0xff} // bilibili blue
+	chartPopularityColor = color.RGBA{R: 0xfb, G: 0x72, B: 0x99, A: 0xff} // bilibili pink
+)
+
+// chart 绘制直播的弹幕与人气走势图，横轴为时间
+// 蓝色柱状为每段时间的弹幕数，粉色折线为人气值，二者各自按最大值缩放
+// Note: no text is drawn since there's no font available
+func (s *liveSession) chart() ([]byte, error) {
+	if len(s.danmuPerMinute) == 0 && len(s.popularity) == 0 {
+		return nil, errors.New("no data to draw")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: chartBgColor}, image.Point{}, draw.Src)
+
+	// plot area
+	left, top := chartMargin, chartMargin
+	right, bottom := chartWidth-chartMargin, chartHeight-chartMargin
+	w, h := right-left, bottom-top
+
+	// horizontal grid lines at each quarter
+	for i := 1; i < 4; i++ {
+		y := bottom - h*i/4
+		drawLine(img, left, y, right, y, chartGridColor)
+	}
+
+	// danmu bars, merging minutes if the stream is too long
+	bars := bucketize(s.danmuPerMinute, maxChartBars)
+	if maxBar := maxInt(bars); maxBar > 0 {
+		barW := float64(w) / float64(len(bars))
+		for i, c := range bars {
+			x0 := left + int(float64(i)*barW)
+			x1 := left + int(float64(i+1)*barW) - 1
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			y := bottom - h*c/maxBar
+			draw.Draw(img, image.Rect(x0, y, x1, bottom), &image.Uniform{C: chartDanmuColor}, image.Point{}, draw.Src)
+		}
+	}
+
+	// popularity polyline
+	if maxP := maxUint32(s.popularity); maxP > 0 && len(s.popularity) > 1 {
+		step := float64(w) / float64(len(s.popularity)-1)
+		px, py := 0, 0
+		for i, p := range s.popularity {
+			x := left + int(float64(i)*step)
+			y := bottom - int(float64(h)*float64(p)/float64(maxP))
+			if i > 0 {
+				// thicken the line a little
+				drawLine(img, px, py, x, y, chartPopularityColor)
+				drawLine(img, px, py-1, x, y-1, chartPopularityColor)
+			}
+			px, py = x, y
+		}
+	}
+
+	// axes
+	drawLine(img, left, top, left, bottom, chartAxisColor)
+	drawLine(img, left, bottom, right, bottom, chartAxisColor)
+
+	buf := bytes.Buffer{}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// bucketize 将 l 合并为至多 n 个桶，每个桶为相邻元素之和
+func bucketize(l []int, n int) []int {
+	if len(l) <= n {
+		return l
+	}
+	size := (len(l) + n - 1) / n
+	rst := make([]int, 0, n)
+	for i := 0; i < len(l); i += size {
+		sum := 0
+		for j := i; j < i+size && j < len(l); j++ {
+			sum += l[j]
+		}
+		rst = append(rst, sum)
+	}
+	return rst
+}
+
+func maxInt(l []int) int {
+	rst := 0
+	for _, v := range l {
+		if v > rst {
+			rst = v
+		}
+	}
+	return rst
+}
+
+func maxUint32(l []uint32) uint32 {
+	var rst uint32
+	for _, v := range l {
+		if v > rst {
+			rst = v
+		}
+	}
+	return rst
+}
+
+// drawLine 使用 Bresenham 算法画线
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
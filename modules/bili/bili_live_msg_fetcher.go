@@ -1,8 +1,12 @@
 package bili
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,9 +14,13 @@ import (
 // https://github.com/lovelyyoshino/Bilibili-Live-API/blob/master/API.WebSocket.md
 
 const (
-	BiliLiveMsgApi    = "wss://broadcastlv.chat.bilibili.com:2245/sub"
+	// BiliLiveMsgApi 获取弹幕服务器列表失败时使用的默认服务器
+	BiliLiveMsgApi    = "wss://broadcastlv.chat.bilibili.com:443/sub"
 	HeartBeatInterval = 30 * time.Second
-	MaxReconnection   = 10
+	// ReconnectBaseDelay 第一次重连前的等待时间，之后每次连续失败时加倍
+	ReconnectBaseDelay = 1 * time.Second
+	// MaxReconnectDelay 重连前的最长等待时间
+	MaxReconnectDelay = 2 * time.Minute
 
 	// ReadTimeout equals to HeartBeatInterval plus the time (10s) after which we consider a
 	// read timeout since no heartbeat reply is received from server.
@@ -20,180 +28,422 @@ const (
 	WriteTimeout = 10 * time.Second
 )
 
+// FetcherState 弹幕接收的状态
+type FetcherState int
+
+const (
+	FetcherConnecting FetcherState = iota
+	FetcherJoined
+	FetcherReconnecting
+	FetcherStopped
+)
+
+func (s FetcherState) String() string {
+	switch s {
+	case FetcherConnecting:
+		return "connecting"
+	case FetcherJoined:
+		return "joined"
+	case FetcherReconnecting:
+		return "reconnecting"
+	case FetcherStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("FetcherState(%d)", int(s))
+	}
+}
+
+// Display 状态的中文名称，用于消息中
+func (s FetcherState) Display() string {
+	switch s {
+	case FetcherConnecting:
+		return "连接中"
+	case FetcherJoined:
+		return "已加入"
+	case FetcherReconnecting:
+		return "重连中"
+	case FetcherStopped:
+		return "已停止"
+	default:
+		return s.String()
+	}
+}
+
+// FetcherStatus 弹幕接收的当前状态
+type FetcherStatus struct {
+	Bid    int64
+	Name   string
+	RoomID int64
+	State  FetcherState
+	// Host 当前连接的弹幕服务器
+	Host string
+	// Reconnects 启动以来的重连次数
+	Reconnects int
+	// LastMsgTime 最近一次收到通知（弹幕、礼物等）的时间，未收到过时为零值
+	LastMsgTime time.Time
+}
+
 type LiveMsgFetcher struct {
-	UserInfo   *UserInfo
-	RoomID     int64
-	conn       *websocket.Conn
-	hbTicker   *time.Ticker
-	eventChan  chan<- *Event
-	closeChan  chan bool
-	quitHbChan chan bool
-	quitWg     sync.WaitGroup
-	writeMu    sync.Mutex
-	isRunning  bool
+	UserInfo  *UserInfo
+	RoomID    int64
+	hosts     []string // websocket urls of danmu servers, only accessed by the run goroutine
+	hostIdx   int
+	token     string
+	eventChan chan<- *Event
+	cancel    context.CancelFunc // statusMu protected
+	done      chan struct{}      // closed once the run goroutine exits, statusMu protected
+	status    FetcherStatus      // statusMu protected
+	statusMu  sync.RWMutex
 }
 
 func NewLiveMsgFetcher(userInfo *UserInfo, eventChan chan *Event) *LiveMsgFetcher {
 	return &LiveMsgFetcher{
-		UserInfo:   userInfo,
-		RoomID:     int64(userInfo.LiveRoom.RoomId),
-		conn:       nil,
-		hbTicker:   time.NewTicker(HeartBeatInterval),
-		eventChan:  eventChan,
-		closeChan:  make(chan bool),
-		quitHbChan: make(chan bool),
-		isRunning:  false,
+		UserInfo:  userInfo,
+		RoomID:    int64(userInfo.LiveRoom.RoomId),
+		eventChan: eventChan,
+		status: FetcherStatus{
+			Bid:    int64(userInfo.Mid),
+			Name:   userInfo.Name,
+			RoomID: int64(userInfo.LiveRoom.RoomId),
+			State:  FetcherStopped,
+		},
+	}
+}
+
+// Start 在后台连接直播间并接收消息，断线后按指数退避重连，直到 ctx 被取消或调用 Stop
+// 每个 fetcher 只能启动一次
+func (f *LiveMsgFetcher) Start(ctx context.Context) {
+	f.statusMu.Lock()
+	defer f.statusMu.Unlock()
+	if f.done != nil {
+		logger.Infof("live msg fetcher for live room %d has already started, ignoring...", f.RoomID)
+		return
+	}
+
+	ctx, f.cancel = context.WithCancel(ctx)
+	f.done = make(chan struct{})
+	f.status.State = FetcherConnecting
+	go f.run(ctx, f.done)
+}
+
+// Stop 停止接收消息，等待连接关闭后返回，未启动或已停止时立即返回
+func (f *LiveMsgFetcher) Stop() {
+	f.statusMu.RLock()
+	cancel, done := f.cancel, f.done
+	f.statusMu.RUnlock()
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+}
+
+// Status 返回当前状态的副本
+func (f *LiveMsgFetcher) Status() FetcherStatus {
+	f.statusMu.RLock()
+	defer f.statusMu.RUnlock()
+	return f.status
+}
+
+func (f *LiveMsgFetcher) setState(state FetcherState) {
+	f.statusMu.Lock()
+	defer f.statusMu.Unlock()
+	f.status.State = state
+}
+
+// run 连接与重连的主循环
+func (f *LiveMsgFetcher) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	defer f.setState(FetcherStopped)
+	logger.Infof("live msg fetcher for live room %d has started", f.RoomID)
+
+	failures := 0
+	for {
+		if failures > 0 {
+			delay := reconnectDelay(failures)
+			f.statusMu.Lock()
+			f.status.State = FetcherReconnecting
+			f.status.Reconnects++
+			f.statusMu.Unlock()
+			logger.Warnf("reconnecting to room %d in %s (attempt %d)", f.RoomID, delay, failures)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				logger.Infof("live msg fetcher for live room %d has stopped", f.RoomID)
+				return
+			}
+		}
+
+		conn, err := f.connect(ctx)
+		if err == nil {
+			var joined bool
+			joined, err = f.serve(ctx, conn)
+			if joined {
+				// the connection worked, start over from the base delay
+				failures = 0
+			} else {
+				f.nextHost()
+			}
+		}
+		if ctx.Err() != nil {
+			logger.Infof("live msg fetcher for live room %d has stopped", f.RoomID)
+			return
+		}
+		logger.WithError(err).Errorf("lost connection to room %d", f.RoomID)
+		failures++
+	}
+}
+
+// reconnectDelay 第 n 次连续失败后重连前的等待时间
+func reconnectDelay(n int) time.Duration {
+	d := ReconnectBaseDelay
+	for i := 1; i < n && d < MaxReconnectDelay; i++ {
+		d *= 2
 	}
+	if d > MaxReconnectDelay {
+		d = MaxReconnectDelay
+	}
+	return d
 }
 
-func (f *LiveMsgFetcher) Init() error {
+// connect 连接弹幕服务器并发送加入房间的请求
+func (f *LiveMsgFetcher) connect(ctx context.Context) (*websocket.Conn, error) {
+	if len(f.hosts) == 0 {
+		f.refreshDanmuInfo()
+	}
+	host := f.hosts[f.hostIdx]
+	f.statusMu.Lock()
+	f.status.Host = host
+	f.statusMu.Unlock()
+
 	// connect to bilibili live message websocket API
-	var err error
-	f.writeMu.Lock()
-	f.conn, _, err = websocket.DefaultDialer.Dial(BiliLiveMsgApi, nil)
-	f.writeMu.Unlock()
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, host, nil)
 	if err != nil {
-		return err
+		f.nextHost()
+		return nil, err
 	}
 
 	// join the live room
-	err = f.sendJoinRequest()
-	if err != nil {
-		return err
+	if err = f.sendJoinRequest(conn); err != nil {
+		_ = conn.Close()
+		f.nextHost()
+		return nil, err
 	}
 
-	return nil
+	logger.Infof("connected to %s for room %d", host, f.RoomID)
+	return conn, nil
 }
 
-func (f *LiveMsgFetcher) reconnect() bool {
-	for i := 1; i <= MaxReconnection; i++ {
-		logger.Warnf("trying to reconnect to room %d (%d/%d)", f.RoomID, i, MaxReconnection)
-		err := f.Init()
-		if err == nil {
-			return true
-		} else {
-			logger.WithError(err).Errorf("reconnect failed for room %d", f.RoomID)
+// refreshDanmuInfo 获取弹幕服务器列表与 token，失败时使用默认服务器
+func (f *LiveMsgFetcher) refreshDanmuInfo() {
+	f.hosts, f.hostIdx, f.token = nil, 0, ""
+	info, err := GetDanmuInfo(f.RoomID)
+	if err != nil {
+		logger.WithError(err).Warnf("failed to get danmu info for room %d, using default host", f.RoomID)
+	} else {
+		f.token = info.Token
+		for _, h := range info.HostList {
+			if h.WssPort != 0 {
+				f.hosts = append(f.hosts, fmt.Sprintf("wss://%s:%d/sub", h.Host, h.WssPort))
+			} else if h.WsPort != 0 {
+				// servers without TLS, e.g. the fake one for testing
+				f.hosts = append(f.hosts, fmt.Sprintf("ws://%s:%d/sub", h.Host, h.WsPort))
+			}
 		}
 	}
-	return false
+	if len(f.hosts) == 0 {
+		f.hosts = []string{CurrentEndpoints().LiveMsg}
+	}
 }
 
-func (f *LiveMsgFetcher) Run() {
-	if f.isRunning {
-		logger.Infof("live msg fetcher for live room %d is already running, ignoring...", f.RoomID)
-		return
-	} else {
-		defer func() { f.isRunning = true }()
+// nextHost 切换到下一个弹幕服务器，所有服务器都尝试过后重新获取服务器列表与 token
+func (f *LiveMsgFetcher) nextHost() {
+	f.hostIdx++
+	if f.hostIdx >= len(f.hosts) {
+		f.hosts, f.hostIdx = nil, 0
 	}
+}
+
+// serve 在连接上接收消息并定时发送心跳，直到连接出错或 ctx 被取消，返回是否曾成功加入房间
+func (f *LiveMsgFetcher) serve(ctx context.Context, conn *websocket.Conn) (bool, error) {
+	connCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
 
-	f.writeMu.Lock()
-	defer f.writeMu.Unlock()
+	// Note: closing the connection is the only way to interrupt a blocking read
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-connCtx.Done()
+		_ = conn.Close()
+	}()
 
 	// start heartbeat coroutine
+	wg.Add(1)
 	go func() {
-		f.quitWg.Add(1)
-		defer f.quitWg.Done()
-		logger.Infof("heartbeat coroutine for live room %d has started", f.RoomID)
+		defer wg.Done()
+		// Note: a new ticker for each connection, a stopped one never fires again
+		ticker := time.NewTicker(HeartBeatInterval)
+		defer ticker.Stop()
 		for {
-			err := f.sendHeartBeat()
-			if err != nil {
-				logger.WithError(err).Errorf("failed to send heartbeat for live room %d", f.RoomID)
-				// try to reconnect
-				if f.reconnect() {
-					continue
-				} else {
-					logger.Errorf("unable to reconnect for room %d, stopping live msg fetcher", f.RoomID)
-					f.closeChan <- true
-					return
+			if err := f.sendHeartBeat(conn); err != nil {
+				if connCtx.Err() == nil {
+					logger.WithError(err).Errorf("failed to send heartbeat for live room %d", f.RoomID)
 				}
+				cancel()
+				return
 			}
 			select {
-			case <-f.hbTicker.C:
-				continue
-			case <-f.quitHbChan:
-				f.hbTicker.Stop()
-				logger.Infof("heartbeat coroutine for live room %d has stopped", f.RoomID)
+			case <-ticker.C:
+			case <-connCtx.Done():
 				return
 			}
 		}
 	}()
 
-	// start main message loop coroutine
-	go func() {
-		f.quitWg.Add(1)
-		defer f.quitWg.Done()
-		defer f.conn.Close()
-		defer func() { f.quitHbChan <- true }()
-		logger.Infof("main message loop coroutine for live room %d has started", f.RoomID)
+	joined := false
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(ReadTimeout))
+		_, buffer, err := conn.ReadMessage()
+		if err != nil {
+			return joined, err
+		}
 
-		for {
-			select {
-			case <-f.closeChan:
-				logger.Infof("main message loop coroutine for live room %d has stopped", f.RoomID)
-				return
-			default:
-				_ = f.conn.SetReadDeadline(time.Now().Add(ReadTimeout))
-				_, buffer, err := f.conn.ReadMessage()
-				if err != nil {
-					logger.WithError(err).Errorf("failed to read message for live room %d", f.RoomID)
-					// try to reconnect
-					if f.reconnect() {
-						continue
-					} else {
-						logger.Errorf("unable to reconnect for room %d, stopping live msg fetcher", f.RoomID)
-						return
-					}
+		msgs, err := decodeFrame(buffer)
+		if err != nil {
+			logger.WithError(err).Errorf("failed to decode message for live room %d", f.RoomID)
+		}
+		for _, msg := range msgs {
+			if err = f.handleMsg(msg); err != nil {
+				if msg.Op == JoinReplyOp {
+					// the token might have expired, fetch a new one
+					f.hosts = nil
 				}
+				return joined, err
+			}
+			if msg.Op == JoinReplyOp {
+				joined = true
+			}
+		}
+	}
+}
 
-				msg, err := decodeMsg(buffer)
+// handleMsg 处理一个解析后的包，加入房间失败时返回错误
+func (f *LiveMsgFetcher) handleMsg(msg *DecodedLiveMsg) error {
+	switch msg.Op {
+	case JoinReplyOp:
+		if code, ok := msg.Data.(int); ok && code != 0 {
+			return fmt.Errorf("failed to join room %d, code=%d", f.RoomID, code)
+		}
+		logger.Infof("加入房间 %d", f.RoomID)
+		f.setState(FetcherJoined)
+	case HeartBeatReplyOp:
+		if c, ok := msg.Data.(uint32); ok {
+			logger.Infof("房间 %d 的人气值为 %d", f.RoomID, c)
+			emitEvent(f.eventChan, NewEvent(Popularity, &PopularityEventData{
+				Popularity:       c,
+				StreamerUserInfo: f.UserInfo,
+			}))
+		} else {
+			logger.Warnf("failed to convert viewer count to uint32")
+		}
+	case NotificationOp:
+		if nList, ok := msg.Data.([]*NotificationBody); ok && len(nList) > 0 {
+			f.statusMu.Lock()
+			f.status.LastMsgTime = time.Now()
+			f.statusMu.Unlock()
+			for _, nb := range nList {
+				e, err := f.newNotificationEvent(nb)
 				if err != nil {
-					logger.WithError(err).Errorf("failed to decode message for live room %d", f.RoomID)
-					continue
-				}
-
-				switch msg.Op {
-				case JoinReplyOp:
-					logger.Infof("加入房间 %d", f.RoomID)
-				case HeartBeatReplyOp:
-					if c, ok := msg.Data.(uint32); ok {
-						logger.Infof("房间 %d 的人气值为 %d", f.RoomID, c)
-					} else {
-						logger.Warnf("failed to convert viewer count to uint32")
-					}
-				case NotificationOp:
-					if nList, ok := msg.Data.([]*NotificationBody); ok {
-						for _, nb := range nList {
-							uname, content, err := nb.ParseAsDanmu()
-							if err != nil {
-								logger.WithError(err).Errorf("failed to parse notification as danmu")
-							} else {
-								f.eventChan <- NewEvent(NewDanmu, &DanmuEventData{
-									FromUserName:     uname,
-									Content:          content,
-									StreamerUserInfo: f.UserInfo,
-								})
-								logger.Infof("房间: %d - %s: %s", f.RoomID, uname, content)
-							}
-						}
-					}
-				default:
-					logger.Warnf("unhandled msg with op=%d", msg.Op)
+					logger.WithError(err).Errorf("failed to parse notification %s", nb.Cmd)
+				} else {
+					emitEvent(f.eventChan, e)
 				}
 			}
 		}
-	}()
+	default:
+		logger.Warnf("unhandled msg with op=%d", msg.Op)
+	}
+	return nil
 }
 
-func (f *LiveMsgFetcher) Stop() {
-	f.closeChan <- true
-	f.quitWg.Wait()
-	f.isRunning = false
+// newNotificationEvent 将通知转换为对应的事件
+func (f *LiveMsgFetcher) newNotificationEvent(nb *NotificationBody) (*Event, error) {
+	switch nb.Cmd {
+	case NotificationDanmuCmd:
+		d, err := nb.ParseAsDanmu()
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("房间: %d - %s: %s", f.RoomID, d.Uname, d.Content)
+		return NewEvent(NewDanmu, &DanmuEventData{
+			FromUid:          d.Uid,
+			FromUserName:     d.Uname,
+			Content:          d.Content,
+			MedalLevel:       d.MedalLevel,
+			MedalRoomId:      d.MedalRoomId,
+			StreamerUserInfo: f.UserInfo,
+		}), nil
+	case NotificationGiftCmd:
+		d := &GiftData{}
+		if err := nb.ParseData(d); err != nil {
+			return nil, err
+		}
+		logger.Debugf("房间: %d - %s 赠送了 %s x %d", f.RoomID, d.Uname, d.GiftName, d.Num)
+		return NewEvent(NewGift, &GiftEventData{GiftData: d, StreamerUserInfo: f.UserInfo}), nil
+	case NotificationSuperChatCmd:
+		d := &SuperChatData{}
+		if err := nb.ParseData(d); err != nil {
+			return nil, err
+		}
+		logger.Infof("房间: %d - %s 的醒目留言（%d 元）: %s", f.RoomID, d.UserInfo.Uname, d.Price, d.Message)
+		return NewEvent(NewSuperChat, &SuperChatEventData{SuperChatData: d, StreamerUserInfo: f.UserInfo}), nil
+	case NotificationGuardBuyCmd:
+		d := &GuardBuyData{}
+		if err := nb.ParseData(d); err != nil {
+			return nil, err
+		}
+		logger.Infof("房间: %d - %s 开通了 %s x %d", f.RoomID, d.Username, GuardLevelName(d.GuardLevel), d.Num)
+		return NewEvent(NewGuard, &GuardEventData{GuardBuyData: d, StreamerUserInfo: f.UserInfo}), nil
+	case NotificationInteractWordCmd:
+		d := &InteractWordData{}
+		if err := nb.ParseData(d); err != nil {
+			return nil, err
+		}
+		return NewEvent(NewInteract, &InteractEventData{InteractWordData: d, StreamerUserInfo: f.UserInfo}), nil
+	case NotificationLiveCmd:
+		logger.Infof("房间 %d 开播", f.RoomID)
+		return NewEvent(ServerStartLive, f.UserInfo), nil
+	case NotificationPreparingCmd:
+		logger.Infof("房间 %d 下播", f.RoomID)
+		return NewEvent(ServerStopLive, f.UserInfo), nil
+	case NotificationRoomChangeCmd:
+		d := &RoomChangeData{}
+		if err := nb.ParseData(d); err != nil {
+			return nil, err
+		}
+		logger.Infof("房间 %d 的标题变更为 %s", f.RoomID, d.Title)
+		return NewEvent(ServerRoomChange, &RoomChangeEventData{RoomChangeData: d, StreamerUserInfo: f.UserInfo}), nil
+	case NotificationWatchedChangeCmd:
+		d := &WatchedChangeData{}
+		if err := nb.ParseData(d); err != nil {
+			return nil, err
+		}
+		return NewEvent(WatchedChange, &WatchedChangeEventData{WatchedChangeData: d, StreamerUserInfo: f.UserInfo}), nil
+	default:
+		return nil, errors.New("unsupported notification")
+	}
 }
 
-func (f *LiveMsgFetcher) sendJoinRequest() error {
+func (f *LiveMsgFetcher) sendJoinRequest(conn *websocket.Conn) error {
 	req := JoinRequestBody{
 		Platform: "web",
+		ProtoVer: 3,
 		RoomID:   f.RoomID,
+		Type:     2,
+		Key:      f.token,
 	}
 	reqJson, err := json.Marshal(req)
 	if err != nil {
@@ -201,10 +451,8 @@ func (f *LiveMsgFetcher) sendJoinRequest() error {
 	}
 
 	reqBin := encodeMsg(reqJson, JoinOp, JsonProcVer)
-	f.writeMu.Lock()
-	defer f.writeMu.Unlock()
-	_ = f.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
-	err = f.conn.WriteMessage(websocket.BinaryMessage, reqBin)
+	_ = conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	err = conn.WriteMessage(websocket.BinaryMessage, reqBin)
 	if err != nil {
 		return err
 	}
@@ -212,12 +460,11 @@ func (f *LiveMsgFetcher) sendJoinRequest() error {
 	return nil
 }
 
-func (f *LiveMsgFetcher) sendHeartBeat() error {
+// sendHeartBeat Note: only called from the heartbeat coroutine, the sole writer once joined
+func (f *LiveMsgFetcher) sendHeartBeat(conn *websocket.Conn) error {
 	reqBin := encodeMsg([]byte{}, HeartBeatOp, Uint32ProcVer)
-	f.writeMu.Lock()
-	defer f.writeMu.Unlock()
-	_ = f.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
-	err := f.conn.WriteMessage(websocket.BinaryMessage, reqBin)
+	_ = conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	err := conn.WriteMessage(websocket.BinaryMessage, reqBin)
 	if err != nil {
 		return err
 	}
@@ -239,18 +486,39 @@ func encodeMsg(payload []byte, op uint32, procVer uint16) []byte {
 	return p.ToBytes()
 }
 
-func decodeMsg(buffer []byte) (*DecodedLiveMsg, error) {
-	p := new(LiveMsgPacket)
-	err := p.FromBytes(buffer)
+// decodeFrame 解析一个 WebSocket 消息，一个消息中可能有多个包
+// 部分包解析失败时，仍返回其它成功解析的包
+func decodeFrame(buffer []byte) ([]*DecodedLiveMsg, error) {
+	packets, err := splitPackets(buffer)
 	if err != nil {
 		return nil, err
 	}
 
+	rst := make([]*DecodedLiveMsg, 0, len(packets))
+	var lastErr error
+	for _, p := range packets {
+		msg, err := decodeMsg(p)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rst = append(rst, msg)
+	}
+	return rst, lastErr
+}
+
+func decodeMsg(p *LiveMsgPacket) (*DecodedLiveMsg, error) {
 	switch p.Op {
 	case JoinReplyOp:
+		b := JoinReplyBody{}
+		if len(p.Body) > 0 {
+			if err := json.Unmarshal(p.Body, &b); err != nil {
+				return nil, err
+			}
+		}
 		return &DecodedLiveMsg{
 			Op:   p.Op,
-			Data: nil,
+			Data: b.Code,
 		}, nil
 	case HeartBeatReplyOp:
 		c, err := p.DecodeBodyAsViewCnt()
@@ -275,8 +543,11 @@ func decodeMsg(buffer []byte) (*DecodedLiveMsg, error) {
 			if err != nil {
 				return nil, err
 			}
-			// we return just danmu for now
-			if b.Cmd == NotificationDanmuCmd {
+			// Note: some cmds come with a suffix, e.g. DANMU_MSG:4:0:2:2:2:0
+			if i := strings.IndexByte(b.Cmd, ':'); i >= 0 {
+				b.Cmd = b.Cmd[:i]
+			}
+			if supportedNotificationCmds[b.Cmd] {
 				parsedBodyList = append(parsedBodyList, &b)
 			}
 		}
@@ -0,0 +1,102 @@
+package bili_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/bili"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/bili/fakebili"
+)
+
+const (
+	testUid    = 1001
+	testRoomId = 2001
+)
+
+// startFetcher 启动一个连接到模拟服务器的 fetcher，并等待其加入直播间
+func startFetcher(t *testing.T, srv *fakebili.Server) (*bili.LiveMsgFetcher, chan *bili.Event) {
+	t.Helper()
+	events := make(chan *bili.Event, bili.EventChanSize)
+	f := bili.NewLiveMsgFetcher(&bili.UserInfo{
+		Mid:      testUid,
+		Name:     "主播",
+		LiveRoom: bili.LiveRoom{LiveStatus: bili.Streaming, RoomId: testRoomId},
+	}, events)
+	f.Start(context.Background())
+	t.Cleanup(f.Stop)
+
+	if err := srv.WaitForJoins(testRoomId, 1, waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+	return f, events
+}
+
+// expectDanmu 推送一条弹幕并检查解析结果
+func expectDanmu(t *testing.T, srv *fakebili.Server, events <-chan *bili.Event, content string, medalLevel int) {
+	t.Helper()
+	if err := srv.PushDanmu(testRoomId, 42, "观众", content, medalLevel); err != nil {
+		t.Fatal(err)
+	}
+	d := waitForEvent(t, events, bili.NewDanmu).Data.(*bili.DanmuEventData)
+	if d.FromUid != 42 || d.FromUserName != "观众" || d.Content != content {
+		t.Fatalf("unexpected danmu %+v", d)
+	}
+	if d.MedalLevel != medalLevel {
+		t.Fatalf("expected medal level %d, got %d", medalLevel, d.MedalLevel)
+	}
+	if medalLevel > 0 && d.MedalRoomId != testRoomId {
+		t.Fatalf("expected medal of room %d, got %d", testRoomId, d.MedalRoomId)
+	}
+	if d.StreamerUserInfo.Mid != testUid {
+		t.Fatalf("expected streamer %d, got %d", testUid, d.StreamerUserInfo.Mid)
+	}
+}
+
+func TestFetcherDecodesDanmuWithMedal(t *testing.T) {
+	srv := newFakeServer(t)
+	_, events := startFetcher(t, srv)
+
+	expectDanmu(t, srv, events, "有牌子", 21)
+	expectDanmu(t, srv, events, "没牌子", 0)
+}
+
+func TestFetcherDecodesFrames(t *testing.T) {
+	srv := newFakeServer(t)
+	_, events := startFetcher(t, srv)
+
+	cases := []struct {
+		name    string
+		procVer uint16
+	}{
+		{"zlib", bili.ZippedProcVer},
+		{"brotli", bili.BrotliProcVer},
+		// several uncompressed packets in one frame
+		{"multiple packets", bili.JsonProcVer},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv.SetProcVer(c.procVer)
+			expectDanmu(t, srv, events, c.name, 5)
+		})
+	}
+}
+
+func TestFetcherReconnects(t *testing.T) {
+	srv := newFakeServer(t)
+	f, events := startFetcher(t, srv)
+
+	srv.DropConnections(testRoomId)
+	if err := srv.WaitForJoins(testRoomId, 2, waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if st := f.Status(); st.Reconnects < 1 {
+		t.Fatalf("expected the reconnect to be counted, got %d", st.Reconnects)
+	}
+	// msgs are received again after reconnecting
+	expectDanmu(t, srv, events, "重连后", 0)
+
+	f.Stop()
+	if st := f.Status(); st.State != bili.FetcherStopped {
+		t.Fatalf("expected the fetcher to be stopped, got %s", st.State)
+	}
+}
@@ -7,12 +7,12 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
-	"regexp"
+
+	"github.com/andybalholm/brotli"
 )
 
 const (
-	HeaderLen  = 16
-	MinJsonLen = 4
+	HeaderLen = 16
 
 	HeartBeatOp      uint32 = 2
 	HeartBeatReplyOp uint32 = 3
@@ -22,12 +22,42 @@ const (
 
 	JsonProcVer   uint16 = 0
 	Uint32ProcVer uint16 = 1
-	ZippedProcVer uint16 = 2
-
-	NotificationDanmuCmd string = "DANMU_MSG"
+	ZippedProcVer uint16 = 2 // zlib
+	BrotliProcVer uint16 = 3
+
+	NotificationDanmuCmd         string = "DANMU_MSG"
+	NotificationGiftCmd          string = "SEND_GIFT"
+	NotificationSuperChatCmd     string = "SUPER_CHAT_MESSAGE"
+	NotificationGuardBuyCmd      string = "GUARD_BUY"
+	NotificationInteractWordCmd  string = "INTERACT_WORD"
+	NotificationLiveCmd          string = "LIVE"
+	NotificationPreparingCmd     string = "PREPARING"
+	NotificationRoomChangeCmd    string = "ROOM_CHANGE"
+	NotificationWatchedChangeCmd string = "WATCHED_CHANGE"
+
+	// InteractWordData.MsgType
+	InteractEnter  = 1
+	InteractFollow = 2
+	InteractShare  = 3
+
+	// GuardBuyData.GuardLevel
+	GuardLevelGovernor = 1 // 总督
+	GuardLevelAdmiral  = 2 // 提督
+	GuardLevelCaptain  = 3 // 舰长
 )
 
-var jsonSplitRegexp = regexp.MustCompile(`[\x00-\x1f]+`)
+// supportedNotificationCmds decodeMsg 保留的通知类型，其余的直接丢弃
+var supportedNotificationCmds = map[string]bool{
+	NotificationDanmuCmd:         true,
+	NotificationGiftCmd:          true,
+	NotificationSuperChatCmd:     true,
+	NotificationGuardBuyCmd:      true,
+	NotificationInteractWordCmd:  true,
+	NotificationLiveCmd:          true,
+	NotificationPreparingCmd:     true,
+	NotificationRoomChangeCmd:    true,
+	NotificationWatchedChangeCmd: true,
+}
 
 // ======== WebSocket Packet types ========
 
@@ -62,6 +92,7 @@ func (p *LiveMsgPacket) ToBytes() []byte {
 	return msg
 }
 
+// FromBytes 解析 buffer 开头的一个包，buffer 中可能还有其它的包
 func (p *LiveMsgPacket) FromBytes(buffer []byte) error {
 	if len(buffer) < HeaderLen {
 		return errors.New("corrupted packet")
@@ -79,13 +110,31 @@ func (p *LiveMsgPacket) FromBytes(buffer []byte) error {
 	// Sequence Id (4)
 	p.SeqID = binary.BigEndian.Uint32(buffer[12:])
 
+	if p.HeaderLen < HeaderLen || p.PacketLen < uint32(p.HeaderLen) || p.PacketLen > uint32(len(buffer)) {
+		return errors.New("corrupted packet length")
+	}
+
 	// Body
 	p.Body = make([]byte, 0, p.PacketLen-uint32(p.HeaderLen))
-	p.Body = append(p.Body, buffer[p.HeaderLen:]...)
+	p.Body = append(p.Body, buffer[p.HeaderLen:p.PacketLen]...)
 
 	return nil
 }
 
+// splitPackets 解析 buffer 中首尾相接的所有包
+func splitPackets(buffer []byte) ([]*LiveMsgPacket, error) {
+	rst := make([]*LiveMsgPacket, 0, 1)
+	for len(buffer) > 0 {
+		p := new(LiveMsgPacket)
+		if err := p.FromBytes(buffer); err != nil {
+			return nil, err
+		}
+		rst = append(rst, p)
+		buffer = buffer[p.PacketLen:]
+	}
+	return rst, nil
+}
+
 func (p *LiveMsgPacket) DecodeBodyAsViewCnt() (uint32, error) {
 	if p.Op != HeartBeatReplyOp {
 		return 0, errors.New("op not match")
@@ -98,45 +147,50 @@ func (p *LiveMsgPacket) DecodeBodyAsViewCnt() (uint32, error) {
 	return binary.BigEndian.Uint32(p.Body), nil
 }
 
+// DecodeBodyAsNotificationRawJson 解析通知的 JSON，压缩的包中可能有多个通知
 func (p *LiveMsgPacket) DecodeBodyAsNotificationRawJson() ([]string, error) {
 	if p.Op != NotificationOp {
 		return nil, errors.New("op not match")
 	}
 
-	if len(p.Body) < 0 {
-		return nil, errors.New("corrupted notification body data")
-	}
-
-	// unzip the message if necessary
-	var jsonToSplit string
-	if p.ProcVer == JsonProcVer {
-		jsonToSplit = string(p.Body)
-	} else if p.ProcVer == ZippedProcVer {
-		b := bytes.NewReader(p.Body)
-		decodedBuffer := new(bytes.Buffer)
-		r, err := zlib.NewReader(b)
+	// decompress the body if necessary
+	var r io.Reader
+	switch p.ProcVer {
+	case JsonProcVer:
+		return []string{string(p.Body)}, nil
+	case ZippedProcVer:
+		zr, err := zlib.NewReader(bytes.NewReader(p.Body))
 		if err != nil {
 			return nil, err
 		}
-		_, err = io.Copy(decodedBuffer, r)
-		if err != nil {
-			return nil, err
-		}
-
-		jsonToSplit = decodedBuffer.String()
-	} else {
+		defer zr.Close()
+		r = zr
+	case BrotliProcVer:
+		r = brotli.NewReader(bytes.NewReader(p.Body))
+	default:
 		return nil, errors.New("invalid protocol version for notification body data")
 	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
 
-	// split raw json and filter out splitters
-	jsonSplit := jsonSplitRegexp.Split(jsonToSplit, -1)
-	rst := make([]string, 0, len(jsonSplit))
-	for _, j := range jsonSplit {
-		if len(j) >= MinJsonLen {
-			rst = append(rst, j)
+	// the decompressed body consists of packets as well
+	packets, err := splitPackets(decoded)
+	if err != nil {
+		return nil, err
+	}
+	rst := make([]string, 0, len(packets))
+	for _, inner := range packets {
+		if inner.Op != NotificationOp {
+			continue
+		}
+		l, err := inner.DecodeBodyAsNotificationRawJson()
+		if err != nil {
+			return nil, err
 		}
+		rst = append(rst, l...)
 	}
-
 	return rst, nil
 }
 
@@ -156,6 +210,12 @@ type JoinRequestBody struct {
 	RoomID    int64  `json:"roomid"`
 	UID       int64  `json:"uid,omitempty"`
 	Type      int    `json:"type,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+// JoinReplyBody 加入直播间的结果，Code 不为 0 时认证失败
+type JoinReplyBody struct {
+	Code int `json:"code"`
 }
 
 type NotificationBody struct {
@@ -164,22 +224,134 @@ type NotificationBody struct {
 	Info []json.RawMessage // for DANMU_MSG
 }
 
-func (b *NotificationBody) ParseAsDanmu() (uname, content string, err error) {
+// DanmuData DANMU_MSG 弹幕
+type DanmuData struct {
+	Uid     int64
+	Uname   string
+	Content string
+	// MedalLevel 佩戴的粉丝勋章等级，未佩戴时为 0
+	MedalLevel int
+	// MedalRoomId 佩戴的粉丝勋章所属的直播间
+	MedalRoomId int64
+}
+
+func (b *NotificationBody) ParseAsDanmu() (*DanmuData, error) {
 	if b.Cmd != NotificationDanmuCmd || b.Info == nil || len(b.Info) < 3 {
-		err = errors.New("not a danmu notification")
-		return
+		return nil, errors.New("not a danmu notification")
 	}
 
+	d := &DanmuData{}
+	// info[2]: [uid, uname, ...]
 	var uInfo []json.RawMessage
-	err = json.Unmarshal(b.Info[2], &uInfo)
-	if err != nil {
-		return
+	if err := json.Unmarshal(b.Info[2], &uInfo); err != nil {
+		return nil, err
 	}
-	err = json.Unmarshal(uInfo[1], &uname)
-	if err != nil {
-		return
+	if len(uInfo) < 2 {
+		return nil, errors.New("corrupted danmu sender info")
+	}
+	if err := json.Unmarshal(uInfo[0], &d.Uid); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(uInfo[1], &d.Uname); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b.Info[1], &d.Content); err != nil {
+		return nil, err
+	}
+
+	// info[3]: [level, medal name, streamer name, room id, ...], empty if no medal worn
+	if len(b.Info) > 3 {
+		var medal []json.RawMessage
+		if err := json.Unmarshal(b.Info[3], &medal); err == nil && len(medal) > 3 {
+			_ = json.Unmarshal(medal[0], &d.MedalLevel)
+			_ = json.Unmarshal(medal[3], &d.MedalRoomId)
+		}
+	}
+	return d, nil
+}
+
+// ParseData 将通知的 data 字段解析到 v
+func (b *NotificationBody) ParseData(v interface{}) error {
+	if len(b.Data) == 0 {
+		return errors.New("empty notification data")
+	}
+	return json.Unmarshal(b.Data, v)
+}
+
+// ======== Notification Data types ========
+
+// GiftData SEND_GIFT 礼物
+type GiftData struct {
+	Uid      int64  `json:"uid"`
+	Uname    string `json:"uname"`
+	GiftId   int    `json:"giftId"`
+	GiftName string `json:"giftName"`
+	Num      int    `json:"num"`
+	// Price 单价，金瓜子为 1/1000 元，银瓜子不值钱
+	Price     int    `json:"price"`
+	CoinType  string `json:"coin_type"` // gold or silver
+	TotalCoin int    `json:"total_coin"`
+}
+
+// IsPaid 是否为金瓜子礼物
+func (d *GiftData) IsPaid() bool {
+	return d.CoinType == "gold"
+}
+
+// SuperChatData SUPER_CHAT_MESSAGE 醒目留言
+type SuperChatData struct {
+	Id      int64  `json:"id"`
+	Uid     int64  `json:"uid"`
+	Price   int    `json:"price"` // 元
+	Message string `json:"message"`
+	// Time 留言的置顶时长，秒
+	Time     int `json:"time"`
+	UserInfo struct {
+		Uname string `json:"uname"`
+	} `json:"user_info"`
+}
+
+// GuardBuyData GUARD_BUY 上舰
+type GuardBuyData struct {
+	Uid        int64  `json:"uid"`
+	Username   string `json:"username"`
+	GuardLevel int    `json:"guard_level"`
+	Num        int    `json:"num"`   // 月数
+	Price      int    `json:"price"` // 金瓜子
+	GiftName   string `json:"gift_name"`
+}
+
+// GuardLevelName 大航海等级的中文名
+func GuardLevelName(level int) string {
+	switch level {
+	case GuardLevelGovernor:
+		return "总督"
+	case GuardLevelAdmiral:
+		return "提督"
+	case GuardLevelCaptain:
+		return "舰长"
+	default:
+		return "大航海"
 	}
+}
+
+// InteractWordData INTERACT_WORD 进入直播间、关注、分享等互动
+type InteractWordData struct {
+	Uid     int64  `json:"uid"`
+	Uname   string `json:"uname"`
+	MsgType int    `json:"msg_type"`
+}
+
+// RoomChangeData ROOM_CHANGE 直播间标题或分区变更
+type RoomChangeData struct {
+	Title          string `json:"title"`
+	AreaName       string `json:"area_name"`
+	ParentAreaName string `json:"parent_area_name"`
+}
 
-	err = json.Unmarshal(b.Info[1], &content)
-	return
+// WatchedChangeData WATCHED_CHANGE 看过人数
+type WatchedChangeData struct {
+	Num       int    `json:"num"`
+	TextLarge string `json:"text_large"`
 }
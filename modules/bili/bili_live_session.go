@@ -0,0 +1,271 @@
+package bili
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Mrs4s/MiraiGo/message"
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+)
+
+const (
+	// maxSessionWords 每场直播统计的不同词数上限，超出后不再统计新词
+	maxSessionWords = 5000
+	// maxWordLen 统计的词的最大长度，更长的视为句子不统计
+	maxWordLen = 8
+	// summaryTopN 总结中列出的弹幕最多的用户数与高频词数
+	summaryTopN = 5
+)
+
+// liveSession 一场直播的统计数据
+type liveSession struct {
+	Since          time.Time
+	PeakPopularity uint32
+	DanmuCount     int
+	GiftCount      int
+	// GiftCoin 付费礼物的总价值，金瓜子
+	GiftCoin       int64
+	SuperChatCount int
+	// SuperChatPrice 醒目留言的总金额，元
+	SuperChatPrice int
+	GuardCount     int
+	senders        map[string]int
+	words          map[string]int
+	// danmuPerMinute 开播后每分钟的弹幕数
+	danmuPerMinute []int
+	// popularity 每次心跳回复的人气值
+	popularity []uint32
+}
+
+func newLiveSession(since time.Time) *liveSession {
+	return &liveSession{
+		Since:   since,
+		senders: make(map[string]int),
+		words:   make(map[string]int),
+	}
+}
+
+func (s *liveSession) addDanmu(sender, content string, at time.Time) {
+	s.DanmuCount++
+	s.senders[sender]++
+
+	minute := int(at.Sub(s.Since) / time.Minute)
+	if minute < 0 {
+		minute = 0
+	}
+	for len(s.danmuPerMinute) <= minute {
+		s.danmuPerMinute = append(s.danmuPerMinute, 0)
+	}
+	s.danmuPerMinute[minute]++
+
+	// count each word once per danmu, so that spamming doesn't dominate
+	seen := make(map[string]bool)
+	for _, w := range splitWords(content) {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		if _, ok := s.words[w]; ok || len(s.words) < maxSessionWords {
+			s.words[w]++
+		}
+	}
+}
+
+func (s *liveSession) addGift(d *GiftData) {
+	s.GiftCount += d.Num
+	if d.IsPaid() {
+		s.GiftCoin += int64(d.Price) * int64(d.Num)
+	}
+}
+
+func (s *liveSession) addSuperChat(d *SuperChatData) {
+	s.SuperChatCount++
+	s.SuperChatPrice += d.Price
+}
+
+func (s *liveSession) addGuard(d *GuardBuyData) {
+	s.GuardCount += d.Num
+}
+
+func (s *liveSession) addPopularity(p uint32) {
+	s.popularity = append(s.popularity, p)
+	if p > s.PeakPopularity {
+		s.PeakPopularity = p
+	}
+}
+
+// splitWords 将弹幕按标点与空白切分为词，忽略过长的句子与单个字母或数字
+func splitWords(content string) []string {
+	rst := make([]string, 0)
+	for _, w := range strings.FieldsFunc(content, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		n := utf8.RuneCountInString(w)
+		if n > maxWordLen || (n == 1 && w[0] < utf8.RuneSelf) {
+			continue
+		}
+		rst = append(rst, strings.ToLower(w))
+	}
+	return rst
+}
+
+type rankItem struct {
+	Key   string
+	Count int
+}
+
+// topN 按次数从多到少返回前 n 项，次数相同时按字典序
+func topN(m map[string]int, n int) []rankItem {
+	l := make([]rankItem, 0, len(m))
+	for k, c := range m {
+		l = append(l, rankItem{k, c})
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Count != l[j].Count {
+			return l[i].Count > l[j].Count
+		}
+		return l[i].Key < l[j].Key
+	})
+	if len(l) > n {
+		l = l[:n]
+	}
+	return l
+}
+
+func formatRank(l []rankItem) string {
+	parts := make([]string, 0, len(l))
+	for _, item := range l {
+		parts = append(parts, fmt.Sprintf("%s（%d）", item.Key, item.Count))
+	}
+	return strings.Join(parts, "、")
+}
+
+// formatLiveDuration 将直播时长格式化为 x 小时 y 分钟
+func formatLiveDuration(d time.Duration) string {
+	h, m := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	if h == 0 {
+		return fmt.Sprintf("%d 分钟", m)
+	}
+	return fmt.Sprintf("%d 小时 %d 分钟", h, m)
+}
+
+// summary 生成直播总结
+func (s *liveSession) summary(streamerName string, until time.Time) string {
+	sb := strings.Builder{}
+	sb.WriteString("【直播总结】\n")
+	sb.WriteString(fmt.Sprintf("主播：%s\n", streamerName))
+	sb.WriteString(fmt.Sprintf("直播时长：%s\n", formatLiveDuration(until.Sub(s.Since))))
+	sb.WriteString(fmt.Sprintf("人气峰值：%d\n", s.PeakPopularity))
+	sb.WriteString(fmt.Sprintf("弹幕数：%d", s.DanmuCount))
+	if s.DanmuCount > 0 {
+		sb.WriteString(fmt.Sprintf("\n弹幕最多：%s", formatRank(topN(s.senders, summaryTopN))))
+	}
+	if s.GiftCount > 0 {
+		sb.WriteString(fmt.Sprintf("\n礼物：%d 个，价值 %.1f 元", s.GiftCount, float64(s.GiftCoin)/1000))
+	}
+	if s.SuperChatCount > 0 {
+		sb.WriteString(fmt.Sprintf("\n醒目留言：%d 条，共 %d 元", s.SuperChatCount, s.SuperChatPrice))
+	}
+	if s.GuardCount > 0 {
+		sb.WriteString(fmt.Sprintf("\n上舰：%d", s.GuardCount))
+	}
+	if words := topN(s.words, summaryTopN); len(words) > 0 {
+		sb.WriteString(fmt.Sprintf("\n高频词：%s", formatRank(words)))
+	}
+	return sb.String()
+}
+
+// liveSessionStore 各用户正在进行的直播的统计数据
+type liveSessionStore struct {
+	sessions map[int64]*liveSession // bilibili UID -> session, mu protected
+	mu       sync.Mutex
+}
+
+func newLiveSessionStore() *liveSessionStore {
+	return &liveSessionStore{
+		sessions: make(map[int64]*liveSession),
+	}
+}
+
+// start 开始统计一场直播，已在统计时不做任何事
+func (s *liveSessionStore) start(uid int64, since time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[uid]; !ok {
+		s.sessions[uid] = newLiveSession(since)
+	}
+}
+
+// finish 结束统计并返回这场直播的统计数据，没有在统计时返回 nil
+func (s *liveSessionStore) finish(uid int64) *liveSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := s.sessions[uid]
+	delete(s.sessions, uid)
+	return session
+}
+
+// record 在持有锁的情况下更新用户正在进行的直播的统计数据
+func (s *liveSessionStore) record(uid int64, fn func(session *liveSession)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[uid]; ok {
+		fn(session)
+	}
+}
+
+// recordLiveSession 将直播间的事件计入统计
+func (m *bili) recordLiveSession(e *Event) {
+	now := time.Now()
+	switch data := e.Data.(type) {
+	case *DanmuEventData:
+		m.liveSessions.record(int64(data.StreamerUserInfo.Mid), func(s *liveSession) {
+			s.addDanmu(data.FromUserName, data.Content, now)
+		})
+	case *GiftEventData:
+		m.liveSessions.record(int64(data.StreamerUserInfo.Mid), func(s *liveSession) {
+			s.addGift(data.GiftData)
+		})
+	case *SuperChatEventData:
+		m.liveSessions.record(int64(data.StreamerUserInfo.Mid), func(s *liveSession) {
+			s.addSuperChat(data.SuperChatData)
+		})
+	case *GuardEventData:
+		m.liveSessions.record(int64(data.StreamerUserInfo.Mid), func(s *liveSession) {
+			s.addGuard(data.GuardBuyData)
+		})
+	case *PopularityEventData:
+		m.liveSessions.record(int64(data.StreamerUserInfo.Mid), func(s *liveSession) {
+			s.addPopularity(data.Popularity)
+		})
+	}
+}
+
+// broadcastLiveSummary 向开启了直播总结的群发送直播总结，并按配置附带弹幕与人气走势图
+func (m *bili) broadcastLiveSummary(qqClient bot.Client, userInfo *UserInfo, session *liveSession) {
+	groupIdList := m.groupsToNotify(int64(userInfo.Mid), NotifySummary)
+	if len(groupIdList) == 0 {
+		return
+	}
+
+	// Note: the session is no longer recorded once finished, no locking needed
+	text := session.summary(userInfo.Name, time.Now())
+	var chart []byte
+	if m.config.LiveSummaryChart {
+		var err error
+		if chart, err = session.chart(); err != nil {
+			logger.WithError(err).Warnf("failed to draw live summary chart for bid=%d", userInfo.Mid)
+		}
+	}
+
+	for _, gid := range groupIdList {
+		msg := message.NewSendingMessage()
+		msg.Append(message.NewText(text))
+		sendWithImage(qqClient, gid, msg, chart)
+	}
+}
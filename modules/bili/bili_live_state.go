@@ -0,0 +1,69 @@
+package bili
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
+)
+
+// liveState 持久化的直播状态，用于重启后避免重复发送开播提醒
+type liveState struct {
+	UserInfo *UserInfo `json:"user_info"`
+	// LiveSince 本场直播开始（被发现）的时间，未开播时为零值
+	LiveSince time.Time `json:"live_since,omitempty"`
+}
+
+// loadLiveState 从文件恢复已订阅用户的直播状态，文件不存在时视为空
+// 内存中已有的状态（如重载模块时）优先
+func (m *bili) loadLiveState() error {
+	b, err := os.ReadFile(m.config.LiveStatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	states := make(map[int64]*liveState)
+	if err = json.Unmarshal(b, &states); err != nil {
+		return err
+	}
+
+	m.subscriptionRwMu.RLock()
+	defer m.subscriptionRwMu.RUnlock()
+	m.infoBufRwMu.Lock()
+	defer m.infoBufRwMu.Unlock()
+	restored := 0
+	for uid, state := range states {
+		if _, ok := m.biliUidToGroupIdList[uid]; !ok || state.UserInfo == nil {
+			continue
+		}
+		if _, ok := m.biliUserInfoBuf[uid]; ok {
+			continue
+		}
+		m.biliUserInfoBuf[uid] = state.UserInfo
+		if !state.LiveSince.IsZero() {
+			m.biliLiveSince[uid] = state.LiveSince
+		}
+		restored++
+	}
+	logger.Infof("restored live state of %d bilibili users from %s", restored, m.config.LiveStatePath)
+	return nil
+}
+
+// saveLiveState 将直播状态写入文件
+func (m *bili) saveLiveState() error {
+	m.infoBufRwMu.RLock()
+	states := make(map[int64]*liveState, len(m.biliUserInfoBuf))
+	for uid, info := range m.biliUserInfoBuf {
+		states[uid] = &liveState{UserInfo: info, LiveSince: m.biliLiveSince[uid]}
+	}
+	m.infoBufRwMu.RUnlock()
+
+	b, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(m.config.LiveStatePath, b)
+}
@@ -0,0 +1,65 @@
+package bili
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+const (
+	// LiveStatus.LiveStatus, besides NotStreaming and Streaming
+	Rounding = 2 // 轮播
+)
+
+type LiveStatusRsp struct {
+	Code    int
+	Message string
+	// Data bilibili UID -> live status
+	Data LiveStatusMap
+}
+
+type LiveStatusMap map[string]LiveStatus
+
+// UnmarshalJSON Note: the API returns an empty array instead of an empty object if no one has a live room
+func (m *LiveStatusMap) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		*m = make(LiveStatusMap)
+		return nil
+	}
+	return json.Unmarshal(b, (*map[string]LiveStatus)(m))
+}
+
+type LiveStatus struct {
+	Uid           int64  `json:"uid"`
+	Uname         string `json:"uname"`
+	Face          string `json:"face"`
+	Title         string `json:"title"`
+	RoomId        int    `json:"room_id"`
+	Online        int    `json:"online"`
+	LiveTime      int64  `json:"live_time"`
+	LiveStatus    int    `json:"live_status"`
+	CoverFromUser string `json:"cover_from_user"`
+	AreaName      string `json:"area_v2_name"`
+}
+
+// toUserInfo 转换为模块内通用的用户信息，轮播视为未开播
+func (s *LiveStatus) toUserInfo() *UserInfo {
+	liveStatus := s.LiveStatus
+	if liveStatus != Streaming {
+		liveStatus = NotStreaming
+	}
+	return &UserInfo{
+		Mid:  int(s.Uid),
+		Name: s.Uname,
+		Face: s.Face,
+		LiveRoom: LiveRoom{
+			RoomStatus: 1,
+			LiveStatus: liveStatus,
+			Url:        "https://live.bilibili.com/" + strconv.Itoa(s.RoomId),
+			Title:      s.Title,
+			Cover:      s.CoverFromUser,
+			Online:     s.Online,
+			RoomId:     s.RoomId,
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package bili
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// PollTick 检查是否有用户需要拉取的间隔，拉取间隔更短时使用拉取间隔
+	PollTick = 5 * time.Second
+	// MaxPollBackoff 被限流时暂停拉取的最长时间
+	MaxPollBackoff = 30 * time.Minute
+	// pollJitter 每个用户的拉取间隔随机浮动的比例，避免所有用户同时到期
+	pollJitter = 0.1
+)
+
+// pollScheduler 决定每个用户下次拉取直播状态的时间，并在被限流时指数退避
+type pollScheduler struct {
+	interval     time.Duration
+	next         map[int64]time.Time // bilibili UID -> next poll time, mu protected
+	backoff      time.Duration       // mu protected
+	backoffUntil time.Time           // mu protected
+	rand         *rand.Rand          // mu protected
+	mu           sync.Mutex
+}
+
+func newPollScheduler(interval time.Duration) *pollScheduler {
+	return &pollScheduler{
+		interval: interval,
+		next:     make(map[int64]time.Time),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// tick 检查到期用户的间隔
+func (s *pollScheduler) tick() time.Duration {
+	if s.interval < PollTick {
+		return s.interval
+	}
+	return PollTick
+}
+
+// due 返回 uids 中到期需要拉取的用户，从未拉取过的用户总是到期
+// 不在 uids 中的用户视为已取消订阅，不再记录
+func (s *pollScheduler) due(uids []int64, now time.Time) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscribed := make(map[int64]bool, len(uids))
+	rst := make([]int64, 0)
+	for _, uid := range uids {
+		subscribed[uid] = true
+		if next, ok := s.next[uid]; !ok || !next.After(now) {
+			rst = append(rst, uid)
+		}
+	}
+	for uid := range s.next {
+		if !subscribed[uid] {
+			delete(s.next, uid)
+		}
+	}
+	return rst
+}
+
+// schedule 安排用户下次拉取的时间
+func (s *pollScheduler) schedule(uids []int64, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maxJitter := int64(float64(s.interval) * pollJitter)
+	for _, uid := range uids {
+		jitter := time.Duration(0)
+		if maxJitter > 0 {
+			jitter = time.Duration(s.rand.Int63n(2*maxJitter+1) - maxJitter)
+		}
+		s.next[uid] = now.Add(s.interval + jitter)
+	}
+}
+
+// isBackingOff 是否仍在退避中
+func (s *pollScheduler) isBackingOff(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Before(s.backoffUntil)
+}
+
+// backOff 被限流时暂停拉取，每次连续被限流时暂停时间加倍，返回暂停的时间
+func (s *pollScheduler) backOff(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.backoff == 0 {
+		s.backoff = s.interval
+	} else {
+		s.backoff *= 2
+	}
+	if s.backoff > MaxPollBackoff {
+		s.backoff = MaxPollBackoff
+	}
+	s.backoffUntil = now.Add(s.backoff)
+	return s.backoff
+}
+
+// resetBackoff 拉取成功后重置退避时间
+func (s *pollScheduler) resetBackoff() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backoff = 0
+	s.backoffUntil = time.Time{}
+}
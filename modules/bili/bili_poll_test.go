@@ -0,0 +1,148 @@
+package bili_test
+
+import (
+	"testing"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/bili"
+)
+
+// expectEvents 检查拉取产生的事件类型
+func expectEvents(t *testing.T, p *bili.Poller, types ...int) []*bili.Event {
+	t.Helper()
+	events := p.Events()
+	if len(events) != len(types) {
+		t.Fatalf("expected %d events, got %d", len(types), len(events))
+	}
+	for i, e := range events {
+		if e.Type != types[i] {
+			t.Fatalf("event %d: expected type %d, got %d", i, types[i], e.Type)
+		}
+	}
+	return events
+}
+
+func TestPollDetectsStartAndStopLive(t *testing.T) {
+	srv := newFakeServer(t)
+	const uid = 1001
+	srv.SetUser(bili.UserInfo{
+		Mid:  uid,
+		Name: "主播",
+		LiveRoom: bili.LiveRoom{
+			LiveStatus: bili.NotStreaming,
+			RoomId:     2001,
+			Title:      "标题",
+		},
+	})
+
+	p := bili.NewPoller()
+	if err := p.Poll(uid); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, p)
+
+	srv.SetLiveStatus(uid, bili.Streaming)
+	if err := p.Poll(uid); err != nil {
+		t.Fatal(err)
+	}
+	e := expectEvents(t, p, bili.StartLive)[0]
+	if info := e.Data.(*bili.UserInfo); info.Mid != uid || info.LiveRoom.Title != "标题" {
+		t.Fatalf("unexpected user info %+v", info)
+	}
+
+	srv.SetLiveStatus(uid, bili.NotStreaming)
+	if err := p.Poll(uid); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, p, bili.StopLive)
+}
+
+func TestPollKeepsEventsUntilTaken(t *testing.T) {
+	srv := newFakeServer(t)
+	const uid = 1001
+	srv.SetUser(bili.UserInfo{Mid: uid, LiveRoom: bili.LiveRoom{RoomId: 2001}})
+
+	p := bili.NewPoller()
+	// far more transitions than the danmu queue holds, none is dropped
+	n := bili.EventChanSize + 1
+	for i := 0; i < n; i++ {
+		status := bili.Streaming
+		if i%2 == 1 {
+			status = bili.NotStreaming
+		}
+		srv.SetLiveStatus(uid, status)
+		if err := p.Poll(uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events := p.Events()
+	if len(events) != n {
+		t.Fatalf("expected %d events, got %d", n, len(events))
+	}
+	if events[0].Type != bili.StartLive || events[n-1].Type != bili.StartLive {
+		t.Fatalf("expected events in order, got %d ... %d", events[0].Type, events[n-1].Type)
+	}
+}
+
+func TestPollRateLimited(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.SetResponseCode(-412)
+
+	p := bili.NewPoller()
+	if err := p.Poll(1001); !bili.IsRateLimited(err) {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+}
+
+func TestFetcherStartAndStopInOrder(t *testing.T) {
+	srv := newFakeServer(t)
+	const uid = 1001
+	srv.SetUser(bili.UserInfo{
+		Mid:      uid,
+		LiveRoom: bili.LiveRoom{LiveStatus: bili.Streaming, RoomId: 2001},
+	})
+
+	p := bili.NewPoller()
+	t.Cleanup(p.Close)
+	if err := p.Poll(uid); err != nil {
+		t.Fatal(err)
+	}
+
+	// a quick restart of the live, the latest start wins
+	p.StartFetcher(uid)
+	p.StopFetcher(uid)
+	p.StartFetcher(uid)
+	p.SyncFetcher(uid)
+	if !p.HasFetcher(uid) {
+		t.Fatal("expected the fetcher to be running")
+	}
+	if err := srv.WaitForJoins(2001, 1, waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	p.StopFetcher(uid)
+	p.SyncFetcher(uid)
+	if p.HasFetcher(uid) {
+		t.Fatal("expected the fetcher to be stopped")
+	}
+}
+
+func TestFetcherNotStartedAfterClose(t *testing.T) {
+	srv := newFakeServer(t)
+	const uid = 1001
+	srv.SetUser(bili.UserInfo{
+		Mid:      uid,
+		LiveRoom: bili.LiveRoom{LiveStatus: bili.Streaming, RoomId: 2001},
+	})
+
+	p := bili.NewPoller()
+	if err := p.Poll(uid); err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	p.StartFetcher(uid)
+	p.SyncFetcher(uid)
+	if p.HasFetcher(uid) {
+		t.Fatal("expected no fetcher to start after closing")
+	}
+}
@@ -0,0 +1,197 @@
+package bili
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
+)
+
+// subscriptionStore 持久化运行时通过命令修改的订阅
+// 仅记录相对于配置文件 subscription 的增删，以便配置文件的修改仍然生效
+type subscriptionStore struct {
+	path string
+	// Added 在配置文件之外新增的订阅，group ID -> bilibili UID list
+	Added map[int64][]int64 `json:"added"`
+	// Removed 从配置文件中取消的订阅，group ID -> bilibili UID list
+	Removed map[int64][]int64 `json:"removed"`
+	// Notify 通过命令设置的各群开启的提醒类型，覆盖配置文件中的 notify
+	Notify map[int64][]NotifyType `json:"notify"`
+	mu     sync.Mutex
+}
+
+func newSubscriptionStore(path string) *subscriptionStore {
+	return &subscriptionStore{
+		path:    path,
+		Added:   make(map[int64][]int64),
+		Removed: make(map[int64][]int64),
+		Notify:  make(map[int64][]NotifyType),
+	}
+}
+
+// load 从文件读取订阅的增删，文件不存在时视为空
+func (s *subscriptionStore) load() error {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err = json.Unmarshal(b, s); err != nil {
+		return err
+	}
+	if s.Added == nil {
+		s.Added = make(map[int64][]int64)
+	}
+	if s.Removed == nil {
+		s.Removed = make(map[int64][]int64)
+	}
+	if s.Notify == nil {
+		s.Notify = make(map[int64][]NotifyType)
+	}
+	return nil
+}
+
+// apply 将订阅的增删应用到配置文件中的订阅上，返回新的订阅
+func (s *subscriptionStore) apply(subscription map[int64][]int64) map[int64][]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rst := make(map[int64][]int64)
+	for gid, uidList := range subscription {
+		for _, uid := range uidList {
+			if !contains(s.Removed[gid], uid) {
+				rst[gid] = appendUnique(rst[gid], uid)
+			}
+		}
+	}
+	for gid, uidList := range s.Added {
+		for _, uid := range uidList {
+			rst[gid] = appendUnique(rst[gid], uid)
+		}
+	}
+	return rst
+}
+
+// record 记录一次订阅或取消订阅并写入文件，写入失败时不做任何修改
+func (s *subscriptionStore) record(gid, uid int64, subscribed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, to := s.Removed, s.Added
+	if !subscribed {
+		from, to = s.Added, s.Removed
+	}
+	oldFrom, hadFrom := from[gid]
+	oldTo, hadTo := to[gid]
+	// record the desired state instead of merely undoing the opposite change,
+	// so that it still holds after the config file is edited
+	if l := remove(oldFrom, uid); len(l) > 0 {
+		from[gid] = l
+	} else {
+		delete(from, gid)
+	}
+	to[gid] = appendUnique(oldTo, uid)
+	if err := s.save(); err != nil {
+		restore(from, gid, oldFrom, hadFrom)
+		restore(to, gid, oldTo, hadTo)
+		return err
+	}
+	return nil
+}
+
+// notifyTypesOf 获取通过命令设置的群开启的提醒类型，未设置时返回 false
+func (s *subscriptionStore) notifyTypesOf(gid int64) ([]NotifyType, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.Notify[gid]
+	return l, ok
+}
+
+// setNotifyTypes 设置群开启的提醒类型并写入文件，写入失败时不做任何修改
+func (s *subscriptionStore) setNotifyTypes(gid int64, l []NotifyType) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, hadOld := s.Notify[gid]
+	s.Notify[gid] = l
+	if err := s.save(); err != nil {
+		restore(s.Notify, gid, old, hadOld)
+		return err
+	}
+	return nil
+}
+
+// restore 将 m[k] 恢复为修改前的值，ok 为修改前 k 是否存在
+func restore[K comparable, V any](m map[K]V, k K, v V, ok bool) {
+	if ok {
+		m[k] = v
+	} else {
+		delete(m, k)
+	}
+}
+
+// save 写入文件
+// 调用方需持有 mu
+func (s *subscriptionStore) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path, b)
+}
+
+// addSubscription 添加订阅，返回该 UID 是否此前没有被任何群订阅
+// 调用方需持有 subscriptionRwMu
+func (m *bili) addSubscription(gid, uid int64) bool {
+	isNew := len(m.biliUidToGroupIdList[uid]) == 0
+	m.groupIdToBiliUidList[gid] = appendUnique(m.groupIdToBiliUidList[gid], uid)
+	m.biliUidToGroupIdList[uid] = appendUnique(m.biliUidToGroupIdList[uid], gid)
+	return isNew
+}
+
+// removeSubscription 取消订阅，返回该 UID 是否已不再被任何群订阅
+// 调用方需持有 subscriptionRwMu
+func (m *bili) removeSubscription(gid, uid int64) bool {
+	m.groupIdToBiliUidList[gid] = remove(m.groupIdToBiliUidList[gid], uid)
+	if len(m.groupIdToBiliUidList[gid]) == 0 {
+		delete(m.groupIdToBiliUidList, gid)
+	}
+	m.biliUidToGroupIdList[uid] = remove(m.biliUidToGroupIdList[uid], gid)
+	if len(m.biliUidToGroupIdList[uid]) == 0 {
+		delete(m.biliUidToGroupIdList, uid)
+		return true
+	}
+	return false
+}
+
+func contains(l []int64, v int64) bool {
+	for _, x := range l {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(l []int64, v int64) []int64 {
+	if contains(l, v) {
+		return l
+	}
+	return append(l, v)
+}
+
+// remove 返回移除 v 后的新列表，不修改 l
+func remove(l []int64, v int64) []int64 {
+	rst := make([]int64, 0, len(l))
+	for _, x := range l {
+		if x != v {
+			rst = append(rst, x)
+		}
+	}
+	return rst
+}
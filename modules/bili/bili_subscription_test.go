@@ -0,0 +1,43 @@
+package bili
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSubscriptionStoreRollsBackOnSaveError(t *testing.T) {
+	dir := t.TempDir()
+	s := newSubscriptionStore(filepath.Join(dir, "sub.json"))
+	if err := s.record(1, 100, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.setNotifyTypes(1, []NotifyType{NotifyVideo}); err != nil {
+		t.Fatal(err)
+	}
+
+	// writes fail from now on since the parent is a regular file
+	s.path = filepath.Join(s.path, "sub.json")
+	if err := s.record(1, 100, false); err == nil {
+		t.Fatal("expected record to fail")
+	}
+	if err := s.record(2, 200, true); err == nil {
+		t.Fatal("expected record to fail")
+	}
+	if err := s.setNotifyTypes(1, nil); err == nil {
+		t.Fatal("expected setNotifyTypes to fail")
+	}
+	if err := s.setNotifyTypes(2, []NotifyType{NotifyVideo}); err == nil {
+		t.Fatal("expected setNotifyTypes to fail")
+	}
+
+	if want := map[int64][]int64{1: {100}}; !reflect.DeepEqual(s.Added, want) {
+		t.Errorf("Added = %v, want %v", s.Added, want)
+	}
+	if len(s.Removed) != 0 {
+		t.Errorf("Removed = %v, want empty", s.Removed)
+	}
+	if want := map[int64][]NotifyType{1: {NotifyVideo}}; !reflect.DeepEqual(s.Notify, want) {
+		t.Errorf("Notify = %v, want %v", s.Notify, want)
+	}
+}
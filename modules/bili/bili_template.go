@@ -0,0 +1,107 @@
+package bili
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/template"
+)
+
+// 直播相关提醒的模板名，即配置文件中 templates 的键
+const (
+	TemplateStartLive   = "start_live"
+	TemplateStopLive    = "stop_live"
+	TemplateTitleChange = "title_change"
+	TemplateCoverChange = "cover_change"
+)
+
+var defaultTemplates = map[string]string{
+	TemplateStartLive:   "您关注的{{.Name}}开播啦！快去直播间 DD 吧～\n直播间标题：{{.Title}}\n直播间链接：{{.Url}}",
+	TemplateStopLive:    "您关注的{{.Name}}下播啦！感谢观看，记得下次再来 DD 哦～",
+	TemplateTitleChange: "{{.Name}}修改了直播间标题：\n{{.OldTitle}} → {{.Title}}\n直播间链接：{{.Url}}",
+	TemplateCoverChange: "{{.Name}}更换了直播间封面\n直播间链接：{{.Url}}",
+}
+
+// liveTemplateData 模板中可用的字段
+type liveTemplateData struct {
+	Uid    int64
+	Name   string
+	Title  string
+	Url    string
+	RoomId int
+	// OldTitle 修改前的标题，仅 title_change 可用
+	OldTitle string
+}
+
+func newLiveTemplateData(userInfo *UserInfo) *liveTemplateData {
+	return &liveTemplateData{
+		Uid:    int64(userInfo.Mid),
+		Name:   userInfo.Name,
+		Title:  userInfo.LiveRoom.Title,
+		Url:    userInfo.LiveRoom.Url,
+		RoomId: userInfo.LiveRoom.RoomId,
+	}
+}
+
+// liveTemplates 编译后的消息模板
+type liveTemplates struct {
+	defaults map[string]*template.Template
+	groups   map[int64]map[string]*template.Template
+}
+
+// parseTemplates 编译内置模板与配置文件中的模板，配置文件中的模板优先
+func parseTemplates(templates map[string]string, groupTemplates map[int64]map[string]string) (*liveTemplates, error) {
+	t := &liveTemplates{
+		defaults: make(map[string]*template.Template),
+		groups:   make(map[int64]map[string]*template.Template),
+	}
+	for name, text := range defaultTemplates {
+		t.defaults[name] = template.Must(template.New(name).Parse(text))
+	}
+	for name, text := range templates {
+		tpl, err := parseTemplate(name, text)
+		if err != nil {
+			return nil, err
+		}
+		t.defaults[name] = tpl
+	}
+	for gid, m := range groupTemplates {
+		t.groups[gid] = make(map[string]*template.Template)
+		for name, text := range m {
+			tpl, err := parseTemplate(name, text)
+			if err != nil {
+				return nil, fmt.Errorf("group %d: %v", gid, err)
+			}
+			t.groups[gid][name] = tpl
+		}
+	}
+	return t, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	if _, ok := defaultTemplates[name]; !ok {
+		return nil, fmt.Errorf("unknown template %s", name)
+	}
+	tpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %v", name, err)
+	}
+	// catch unknown fields early instead of failing at broadcasting
+	if err = tpl.Execute(io.Discard, &liveTemplateData{}); err != nil {
+		return nil, fmt.Errorf("invalid template %s: %v", name, err)
+	}
+	return tpl, nil
+}
+
+// render 使用群 gid 的模板 name 生成消息
+func (t *liveTemplates) render(gid int64, name string, data *liveTemplateData) (string, error) {
+	tpl, ok := t.groups[gid][name]
+	if !ok {
+		tpl = t.defaults[name]
+	}
+	buf := bytes.Buffer{}
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,40 @@
+package bili_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/bili"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/bili/fakebili"
+)
+
+const waitTimeout = 5 * time.Second
+
+// newFakeServer 启动模拟服务器并将 API 地址指向它，测试结束后恢复
+func newFakeServer(t *testing.T) *fakebili.Server {
+	t.Helper()
+	srv := fakebili.NewServer()
+	bili.SetEndpoints(srv.Endpoints())
+	t.Cleanup(func() {
+		bili.SetEndpoints(bili.DefaultEndpoints())
+		srv.Close()
+	})
+	return srv
+}
+
+// waitForEvent 等待下一个类型为 eventType 的事件，忽略其它事件
+func waitForEvent(t *testing.T, events <-chan *bili.Event, eventType int) *bili.Event {
+	t.Helper()
+	deadline := time.After(waitTimeout)
+	for {
+		select {
+		case e := <-events:
+			if e.Type == eventType {
+				return e
+			}
+		case <-deadline:
+			t.Fatalf("timeout waiting for event of type %d", eventType)
+			return nil
+		}
+	}
+}
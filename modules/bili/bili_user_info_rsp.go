@@ -6,13 +6,6 @@ const (
 	Streaming    = 1
 )
 
-type UserInfoRsp struct {
-	Code    int
-	Message string
-	Ttl     int
-	Data    UserInfo
-}
-
 type UserInfo struct {
 	Mid      int
 	Name     string
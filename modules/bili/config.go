@@ -1,7 +1,76 @@
 package bili
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultPollingInterval        = 60
+	DefaultDynamicPollingInterval = 300
+)
+
 type Config struct {
 	Subscription         map[int64][]int64 `yaml:"subscription"`
 	PollingInterval      uint              `yaml:"polling_interval"`
 	DanmuForwardKeywords []string          `yaml:"danmu_forward_keywords"`
+	// DanmuRelayRules 各群的弹幕中继规则，满足任一规则即转发，未配置的群使用 DanmuForwardKeywords
+	DanmuRelayRules map[int64][]DanmuRelayRule `yaml:"danmu_relay_rules"`
+	// DanmuBatchWindow 合并转发弹幕的时间窗口，为 0 时逐条转发
+	DanmuBatchWindow time.Duration `yaml:"danmu_batch_window"`
+	// Notify 各群开启的提醒类型（dynamic, video, room, superchat, guard, summary），开播提醒总是开启
+	Notify map[int64][]NotifyType `yaml:"notify"`
+	// DynamicPollingInterval 拉取动态的间隔，单位为秒
+	DynamicPollingInterval uint `yaml:"dynamic_polling_interval"`
+	// Templates 直播提醒的消息模板（text/template），键为 start_live, stop_live, title_change, cover_change
+	Templates map[string]string `yaml:"templates"`
+	// GroupTemplates 各群的消息模板，覆盖 Templates
+	GroupTemplates map[int64]map[string]string `yaml:"group_templates"`
+	// AtAllGroups 开播提醒时 @全体成员 的群，仅当 Bot 为群管理员时生效
+	AtAllGroups []int64 `yaml:"at_all_groups"`
+	// LiveSummaryChart 直播总结是否附带弹幕与人气走势图
+	LiveSummaryChart bool `yaml:"live_summary_chart"`
+	// Endpoints bilibili API 的地址，未配置时使用官方地址
+	Endpoints Endpoints `yaml:"endpoints"`
+	// SubscriptionStorePath 通过命令增删的订阅保存在此文件中
+	SubscriptionStorePath string `yaml:"subscription_store_path"`
+	// LiveStatePath 最近一次拉取的直播状态保存在此文件中，重启后恢复
+	LiveStatePath string `yaml:"live_state_path"`
+	// DynamicStatePath 已提醒过的动态保存在此文件中，用于去重
+	DynamicStatePath string `yaml:"dynamic_state_path"`
+}
+
+func (c *Config) SetDefaults() {
+	c.PollingInterval = DefaultPollingInterval
+	c.DynamicPollingInterval = DefaultDynamicPollingInterval
+	c.SubscriptionStorePath = "./bili_subscription.json"
+	c.LiveStatePath = "./bili_live_state.json"
+	c.DynamicStatePath = "./bili_dynamic_state.json"
+}
+
+func (c *Config) Validate() error {
+	if c.PollingInterval == 0 {
+		return errors.New("polling_interval must be positive")
+	}
+	if c.DynamicPollingInterval == 0 {
+		return errors.New("dynamic_polling_interval must be positive")
+	}
+	if c.DanmuBatchWindow < 0 {
+		return errors.New("danmu_batch_window must not be negative")
+	}
+	if _, err := parseDanmuRelayRules(c.DanmuRelayRules); err != nil {
+		return err
+	}
+	if _, err := parseTemplates(c.Templates, c.GroupTemplates); err != nil {
+		return err
+	}
+	for gid, l := range c.Notify {
+		for _, t := range l {
+			if !t.isValid() {
+				return fmt.Errorf("invalid notify type %s for group %d", t, gid)
+			}
+		}
+	}
+	return nil
 }
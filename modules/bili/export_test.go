@@ -0,0 +1,51 @@
+package bili
+
+import "context"
+
+// Poller 供 bili_test 包在不启动 Bot 的情况下测试开播与下播检测
+type Poller struct {
+	m *bili
+}
+
+func NewPoller() *Poller {
+	m := NewBili()
+	m.fetcherCtx, m.stopFetchers = context.WithCancel(context.Background())
+	return &Poller{m: m}
+}
+
+// Poll 拉取一次 uids 的直播状态
+func (p *Poller) Poll(uids ...int64) error {
+	return p.m.pollBiliUsers(uids)
+}
+
+// Events 取出拉取产生的事件
+func (p *Poller) Events() []*Event {
+	return p.m.pollEvents.take()
+}
+
+// StartFetcher 启动 uid 的弹幕获取，与模块收到开播事件时相同
+func (p *Poller) StartFetcher(uid int64) {
+	p.m.runLiveMsgFetcherForBiliUser(uid)
+}
+
+// StopFetcher 停止 uid 的弹幕获取，与模块收到下播事件时相同
+func (p *Poller) StopFetcher(uid int64) {
+	p.m.stopLiveMsgFetcherForBiliUser(uid)
+}
+
+// SyncFetcher 等待 uid 此前排队的启动与停止完成
+func (p *Poller) SyncFetcher(uid int64) {
+	done := make(chan struct{})
+	p.m.fetcherQueue.run(uid, func() { close(done) })
+	<-done
+}
+
+// HasFetcher uid 是否有运行中的弹幕获取
+func (p *Poller) HasFetcher(uid int64) bool {
+	return p.m.hasLiveMsgFetcher(uid)
+}
+
+// Close 停止所有弹幕获取，与模块停止时相同
+func (p *Poller) Close() {
+	p.m.stopAllLiveMsgFetchers()
+}
@@ -0,0 +1,453 @@
+// Package fakebili 本地的模拟 bilibili 服务器，提供 bili 模块用到的 HTTP API 与弹幕 WebSocket，
+// 配合 bili.SetEndpoints 或配置文件中的 endpoints 使用，以便离线测试开播下播检测、断线重连与弹幕解析
+package fakebili
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/bili"
+)
+
+const (
+	SpaceDynamicPath = "/x/polymer/web-dynamic/v1/feed/space"
+	DanmuInfoPath    = "/xlive/web-room/v1/index/getDanmuInfo"
+	LiveStatusPath   = "/room/v1/Room/get_status_info_by_uids"
+	LiveMsgPath      = "/sub"
+
+	// Token getDanmuInfo 返回的 token，加入直播间时携带其它 key 会被拒绝
+	Token = "fake-token"
+)
+
+// wsConn 一个弹幕 WebSocket 连接
+type wsConn struct {
+	conn    *websocket.Conn
+	roomId  int64
+	writeMu sync.Mutex
+}
+
+func (c *wsConn) write(b []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.BinaryMessage, b)
+}
+
+// Server 模拟的 bilibili 服务器
+type Server struct {
+	HTTP *httptest.Server
+
+	mu         sync.Mutex
+	users      map[int64]*bili.UserInfo     // UID -> user info
+	dynamics   map[int64][]bili.DynamicItem // UID -> dynamics
+	conns      map[int64]map[*wsConn]bool   // room ID -> joined connections
+	joins      map[int64]int                // room ID -> number of joins
+	requests   map[string]int               // path -> number of requests
+	code       int                          // code of all HTTP API responses
+	procVer    uint16                       // how notifications are pushed
+	popularity uint32
+	notify     chan struct{}
+	upgrader   websocket.Upgrader
+}
+
+// NewServer 启动模拟服务器，使用完毕后需调用 Close
+func NewServer() *Server {
+	s := &Server{
+		users:      make(map[int64]*bili.UserInfo),
+		dynamics:   make(map[int64][]bili.DynamicItem),
+		conns:      make(map[int64]map[*wsConn]bool),
+		joins:      make(map[int64]int),
+		requests:   make(map[string]int),
+		procVer:    bili.ZippedProcVer,
+		popularity: 1,
+		notify:     make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(SpaceDynamicPath, s.handleSpaceDynamic)
+	mux.HandleFunc(DanmuInfoPath, s.handleDanmuInfo)
+	mux.HandleFunc(LiveStatusPath, s.handleLiveStatus)
+	mux.HandleFunc(LiveMsgPath, s.handleLiveMsg)
+	s.HTTP = httptest.NewServer(mux)
+	return s
+}
+
+// Close 关闭所有连接并停止服务器
+func (s *Server) Close() {
+	s.mu.Lock()
+	for _, conns := range s.conns {
+		for c := range conns {
+			_ = c.conn.Close()
+		}
+	}
+	s.mu.Unlock()
+	s.HTTP.Close()
+}
+
+// Endpoints 指向模拟服务器的 API 地址
+func (s *Server) Endpoints() bili.Endpoints {
+	wsUrl := "ws" + strings.TrimPrefix(s.HTTP.URL, "http")
+	return bili.Endpoints{
+		SpaceDynamic: s.HTTP.URL + SpaceDynamicPath,
+		DanmuInfo:    s.HTTP.URL + DanmuInfoPath,
+		LiveStatus:   s.HTTP.URL + LiveStatusPath,
+		LiveMsg:      wsUrl + LiveMsgPath,
+	}
+}
+
+// ======== State ========
+
+// SetUser 添加或替换用户信息
+func (s *Server) SetUser(info bili.UserInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[int64(info.Mid)] = &info
+}
+
+// UpdateUser 修改用户信息，用户不存在时返回 false
+func (s *Server) UpdateUser(uid int64, fn func(info *bili.UserInfo)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.users[uid]
+	if ok {
+		fn(info)
+	}
+	return ok
+}
+
+// SetLiveStatus 设置用户的直播状态，bili.Streaming 或 bili.NotStreaming
+func (s *Server) SetLiveStatus(uid int64, status int) bool {
+	return s.UpdateUser(uid, func(info *bili.UserInfo) {
+		info.LiveRoom.LiveStatus = status
+	})
+}
+
+// SetDynamics 设置用户的动态，新的在前
+func (s *Server) SetDynamics(uid int64, items []bili.DynamicItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dynamics[uid] = items
+}
+
+// SetResponseCode 设置所有 HTTP API 返回的 code，如 -412 模拟被限流，0 恢复正常
+func (s *Server) SetResponseCode(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.code = code
+}
+
+// SetProcVer 设置推送通知的方式：bili.ZippedProcVer（默认）或 bili.BrotliProcVer 时压缩后放在一个包中，
+// bili.JsonProcVer 时不压缩，各通知分别作为一个包放在同一个 WebSocket 消息中
+func (s *Server) SetProcVer(procVer uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.procVer = procVer
+}
+
+// SetPopularity 设置心跳回复中的人气值
+func (s *Server) SetPopularity(p uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.popularity = p
+}
+
+// Requests 获取某个 API 收到的请求数，path 如 LiveStatusPath
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Connections 获取已加入直播间的连接数
+func (s *Server) Connections(roomId int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns[roomId])
+}
+
+// Joins 获取直播间被加入的总次数，包括断线重连
+func (s *Server) Joins(roomId int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.joins[roomId]
+}
+
+// WaitForJoins 等待直至直播间共被加入至少 n 次或超时
+func (s *Server) WaitForJoins(roomId int64, n int, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		got, notify := s.joins[roomId], s.notify
+		s.mu.Unlock()
+		if got >= n {
+			return nil
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return fmt.Errorf("timeout waiting for %d joins of room %d, got %d", n, roomId, got)
+		}
+	}
+}
+
+// ======== Live messages ========
+
+// Push 向加入了直播间的所有连接推送一条通知，body 为包括 cmd 的完整 JSON 对象
+// 通知与一个空通知合并在同一个 WebSocket 消息中，与真实服务器一致，压缩方式见 SetProcVer
+func (s *Server) Push(roomId int64, body interface{}) error {
+	j, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	inner := bytes.Buffer{}
+	inner.Write(packet(j, bili.NotificationOp, bili.JsonProcVer))
+	inner.Write(packet([]byte(`{"cmd":"NOOP"}`), bili.NotificationOp, bili.JsonProcVer))
+
+	s.mu.Lock()
+	procVer := s.procVer
+	s.mu.Unlock()
+	if procVer == bili.JsonProcVer {
+		return s.broadcast(roomId, inner.Bytes())
+	}
+
+	compressed := bytes.Buffer{}
+	var w io.WriteCloser
+	switch procVer {
+	case bili.ZippedProcVer:
+		w = zlib.NewWriter(&compressed)
+	case bili.BrotliProcVer:
+		w = brotli.NewWriter(&compressed)
+	default:
+		return fmt.Errorf("unsupported proc ver %d", procVer)
+	}
+	if _, err = w.Write(inner.Bytes()); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return s.broadcast(roomId, packet(compressed.Bytes(), bili.NotificationOp, procVer))
+}
+
+// PushDanmu 推送一条弹幕，medalLevel 为 0 时不佩戴粉丝勋章
+func (s *Server) PushDanmu(roomId, uid int64, uname, content string, medalLevel int) error {
+	medal := []interface{}{}
+	if medalLevel > 0 {
+		medal = []interface{}{medalLevel, "牌子", "主播", roomId}
+	}
+	return s.Push(roomId, map[string]interface{}{
+		"cmd":  bili.NotificationDanmuCmd,
+		"info": []interface{}{[]interface{}{0}, content, []interface{}{uid, uname}, medal},
+	})
+}
+
+// PushCmd 推送一条 data 字段为 data 的通知，如 SEND_GIFT、SUPER_CHAT_MESSAGE
+func (s *Server) PushCmd(roomId int64, cmd string, data interface{}) error {
+	return s.Push(roomId, map[string]interface{}{
+		"cmd":  cmd,
+		"data": data,
+	})
+}
+
+// DropConnections 断开直播间的所有连接，用于测试断线重连
+func (s *Server) DropConnections(roomId int64) {
+	s.mu.Lock()
+	conns := s.conns[roomId]
+	delete(s.conns, roomId)
+	s.mu.Unlock()
+
+	for c := range conns {
+		_ = c.conn.Close()
+	}
+}
+
+func (s *Server) broadcast(roomId int64, b []byte) error {
+	s.mu.Lock()
+	conns := make([]*wsConn, 0, len(s.conns[roomId]))
+	for c := range s.conns[roomId] {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	if len(conns) == 0 {
+		return fmt.Errorf("no connection joined room %d", roomId)
+	}
+	var lastErr error
+	for _, c := range conns {
+		if err := c.write(b); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func packet(body []byte, op uint32, procVer uint16) []byte {
+	p := bili.LiveMsgPacket{
+		HeaderLen: bili.HeaderLen,
+		ProcVer:   procVer,
+		Op:        op,
+		SeqID:     1,
+		Body:      body,
+	}
+	return p.ToBytes()
+}
+
+// ======== Handlers ========
+
+// respond 以 bilibili API 的格式返回 data，设置了 code 时返回错误
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, data interface{}) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	code := s.code
+	s.mu.Unlock()
+
+	rsp := map[string]interface{}{
+		"code":    code,
+		"message": "0",
+		"ttl":     1,
+	}
+	if code == 0 {
+		rsp["data"] = data
+	} else {
+		rsp["message"] = "fake error"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rsp)
+}
+
+func queryInt64(r *http.Request, key string) int64 {
+	v, _ := strconv.ParseInt(r.URL.Query().Get(key), 10, 64)
+	return v
+}
+
+func (s *Server) handleSpaceDynamic(w http.ResponseWriter, r *http.Request) {
+	uid := queryInt64(r, "host_mid")
+	s.mu.Lock()
+	items := s.dynamics[uid]
+	s.mu.Unlock()
+	if items == nil {
+		items = []bili.DynamicItem{}
+	}
+
+	s.respond(w, r, map[string]interface{}{
+		"items":    items,
+		"has_more": false,
+		"offset":   "",
+	})
+}
+
+func (s *Server) handleLiveStatus(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	s.mu.Lock()
+	for _, v := range r.URL.Query()["uids[]"] {
+		uid, _ := strconv.ParseInt(v, 10, 64)
+		u, ok := s.users[uid]
+		if !ok || u.LiveRoom.RoomId == 0 {
+			// users without a live room are omitted
+			continue
+		}
+		data[v] = map[string]interface{}{
+			"uid":             u.Mid,
+			"uname":           u.Name,
+			"face":            u.Face,
+			"title":           u.LiveRoom.Title,
+			"room_id":         u.LiveRoom.RoomId,
+			"online":          u.LiveRoom.Online,
+			"live_status":     u.LiveRoom.LiveStatus,
+			"cover_from_user": u.LiveRoom.Cover,
+		}
+	}
+	s.mu.Unlock()
+	s.respond(w, r, data)
+}
+
+func (s *Server) handleDanmuInfo(w http.ResponseWriter, r *http.Request) {
+	host, port, _ := net.SplitHostPort(s.HTTP.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	s.respond(w, r, map[string]interface{}{
+		"token": Token,
+		"host_list": []map[string]interface{}{
+			{"host": host, "port": p, "ws_port": p, "wss_port": 0},
+		},
+	})
+}
+
+func (s *Server) handleLiveMsg(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &wsConn{conn: conn}
+	defer func() {
+		_ = conn.Close()
+		s.mu.Lock()
+		delete(s.conns[c.roomId], c)
+		s.mu.Unlock()
+	}()
+
+	for {
+		_, buffer, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		p := new(bili.LiveMsgPacket)
+		if err = p.FromBytes(buffer); err != nil {
+			return
+		}
+
+		switch p.Op {
+		case bili.JoinOp:
+			if err = s.join(c, p.Body); err != nil {
+				_ = c.write(packet([]byte(`{"code":-101}`), bili.JoinReplyOp, bili.Uint32ProcVer))
+				return
+			}
+			_ = c.write(packet([]byte(`{"code":0}`), bili.JoinReplyOp, bili.Uint32ProcVer))
+		case bili.HeartBeatOp:
+			s.mu.Lock()
+			body := make([]byte, 4)
+			binary.BigEndian.PutUint32(body, s.popularity)
+			s.mu.Unlock()
+			_ = c.write(packet(body, bili.HeartBeatReplyOp, bili.Uint32ProcVer))
+		}
+	}
+}
+
+// join 校验加入直播间的请求并记录连接
+func (s *Server) join(c *wsConn, body []byte) error {
+	req := bili.JoinRequestBody{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return err
+	}
+	// Note: anonymous joins without a key are allowed, as the real server does
+	if len(req.Key) > 0 && req.Key != Token {
+		return errors.New("invalid token")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.roomId = req.RoomID
+	if s.conns[req.RoomID] == nil {
+		s.conns[req.RoomID] = make(map[*wsConn]bool)
+	}
+	s.conns[req.RoomID][c] = true
+	s.joins[req.RoomID]++
+	// wake up all waiters
+	close(s.notify)
+	s.notify = make(chan struct{})
+	return nil
+}
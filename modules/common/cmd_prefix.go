@@ -0,0 +1,48 @@
+package common
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	cmdPrefixes     = []string{DefaultCmdPrefix} // cmdPrefixesRwMu protected
+	cmdPrefixesRwMu sync.RWMutex
+)
+
+// SetCmdPrefixes 设置命令前缀，第一个前缀用于帮助信息等的展示
+// 由 shell 模块按配置设置，prefixes 为空时恢复默认
+func SetCmdPrefixes(prefixes []string) {
+	cmdPrefixesRwMu.Lock()
+	defer cmdPrefixesRwMu.Unlock()
+	if len(prefixes) == 0 {
+		cmdPrefixes = []string{DefaultCmdPrefix}
+	} else {
+		cmdPrefixes = append([]string(nil), prefixes...)
+	}
+}
+
+// CmdPrefix 首选的命令前缀
+func CmdPrefix() string {
+	cmdPrefixesRwMu.RLock()
+	defer cmdPrefixesRwMu.RUnlock()
+	return cmdPrefixes[0]
+}
+
+// TrimCmdPrefix 去掉 s 开头的命令前缀，s 不以命令前缀开头时返回 false
+func TrimCmdPrefix(s string) (string, bool) {
+	cmdPrefixesRwMu.RLock()
+	defer cmdPrefixesRwMu.RUnlock()
+	for _, p := range cmdPrefixes {
+		if strings.HasPrefix(s, p) {
+			return s[len(p):], true
+		}
+	}
+	return s, false
+}
+
+// IsCmd s 是否以命令前缀开头，其他模块可借此忽略命令消息
+func IsCmd(s string) bool {
+	_, ok := TrimCmdPrefix(s)
+	return ok
+}
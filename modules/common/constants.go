@@ -1,5 +1,6 @@
 package common
 
 const (
-	CmdIdentifier = '/'
+	// DefaultCmdPrefix 默认的命令前缀，可通过 shell 的配置 cmd_prefixes 修改
+	DefaultCmdPrefix = "/"
 )
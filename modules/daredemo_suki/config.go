@@ -1,7 +1,20 @@
 package daredemo_suki
 
+import "errors"
+
 type Config struct {
 	EnabledGroups []int64  `yaml:"enabled_groups"`
 	ImgPath       string   `yaml:"img_path"`
 	Keywords      []string `yaml:"keywords"`
 }
+
+func (c *Config) SetDefaults() {
+	c.ImgPath = "./dd_img"
+}
+
+func (c *Config) Validate() error {
+	if c.ImgPath == "" {
+		return errors.New("img_path must not be empty")
+	}
+	return nil
+}
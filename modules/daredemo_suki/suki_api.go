@@ -1,11 +1,11 @@
 package daredemo_suki
 
-import "github.com/Mrs4s/MiraiGo/client"
+import "github.com/zhouziqunzzq/MiraiGo-DD/bot"
 
 // These are APIs exposed to other modules.
 // They should only be called after initialization of all modules.
 
-func SendDdPic(qqClient *client.QQClient, groupId int64) {
+func SendDdPic(qqClient bot.Client, groupId int64) {
 	if instance != nil {
 		instance.SendDdPic(qqClient, groupId)
 	}
@@ -0,0 +1,25 @@
+package daredemo_suki
+
+import (
+	"time"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
+)
+
+// registerCommands 注册本模块的 shell 命令
+func (m *suki) registerCommands() {
+	err := shell.RegisterCommand(ModuleName, &shell.Command{
+		Name:        "dd",
+		Description: "随机发送一张 DD 图",
+		Contexts:    shell.GroupContext,
+		Cooldown:    shell.Cooldown{User: 30 * time.Second, Group: 10 * time.Second},
+		Handler:     handleDd,
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed to register commands")
+	}
+}
+
+func handleDd(ctx *shell.CmdContext) {
+	SendDdPic(ctx.Client, ctx.GroupId)
+}
@@ -2,13 +2,12 @@ package daredemo_suki
 
 import (
 	"bytes"
-	"github.com/Mrs4s/MiraiGo/client"
 	"github.com/Mrs4s/MiraiGo/message"
 	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
 	"github.com/zhouziqunzzq/MiraiGo-DD/config"
 	"github.com/zhouziqunzzq/MiraiGo-DD/modules/common"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
 	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
-	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"math/rand"
 	"path"
@@ -19,6 +18,7 @@ import (
 type suki struct {
 	isEnabled        bool
 	config           Config
+	moduleConfig     *config.ModuleConfig[Config]
 	enabledGroupsMap map[int64]bool
 	ddImgPool        [][]byte
 }
@@ -36,10 +36,22 @@ func (m *suki) MiraiGoModule() bot.ModuleInfo {
 	return bot.ModuleInfo{
 		ID:       ModuleName,
 		Instance: instance,
+		// 命令注册在 shell 中
+		Dependencies: []bot.ModuleID{shell.ModuleName},
 	}
 }
 
+// IsEnabled 本模块是否已成功初始化并启用
+func (m *suki) IsEnabled() bool {
+	return m.isEnabled
+}
+
 func (m *suki) Init() {
+	// reset states in case of reloading
+	m.config = Config{}
+	m.enabledGroupsMap = make(map[int64]bool)
+	m.ddImgPool = make([][]byte, 0)
+
 	// check is_enabled
 	m.isEnabled = config.GlobalConfig.GetBool("modules." + ModuleName + ".is_enabled")
 	if !m.isEnabled {
@@ -48,18 +60,17 @@ func (m *suki) Init() {
 	}
 
 	// load module config
-	configPath := config.GlobalConfig.GetString("modules." + ModuleName + ".config_path")
-	if configPath == "" {
-		configPath = "./dd.yaml"
-	}
-	logger.Debugf("reading config from %s", configPath)
-	cb := utils.ReadFile(configPath)
-	err := yaml.Unmarshal(cb, &m.config)
+	m.moduleConfig = config.NewModuleConfig[Config](ModuleName, "./dd.yaml")
+	cfg, err := m.moduleConfig.Load()
 	if err != nil {
-		logger.WithError(err).Errorf("unable to read config file in %s", configPath)
+		logger.WithError(err).Error("unable to load module config")
 		m.isEnabled = false
 		return
 	}
+	m.config = *cfg
+	if err = m.moduleConfig.Watch(m.OnConfigChange); err != nil {
+		logger.WithError(err).Warn("unable to watch module config, hot reload disabled")
+	}
 
 	// load enabled groups
 	for _, groupCode := range m.config.EnabledGroups {
@@ -91,6 +102,10 @@ func (m *suki) PostInit() {
 	// 第二次初始化
 	// 再次过程中可以进行跨Module的动作
 	// 如通用数据库等等
+
+	if m.isEnabled {
+		m.registerCommands()
+	}
 }
 
 func (m *suki) Serve(b *bot.Bot) {
@@ -112,15 +127,26 @@ func (m *suki) Start(b *bot.Bot) {
 func (m *suki) Stop(b *bot.Bot, wg *sync.WaitGroup) {
 	// 别忘了解锁
 	defer wg.Done()
+
+	// stop watching module config
+	if m.moduleConfig != nil {
+		m.moduleConfig.Close()
+	}
+	shell.UnregisterCommands(ModuleName)
 	// 结束部分
 	// 一般调用此函数时，程序接收到 os.Interrupt 信号
 	// 即将退出
 	// 在此处应该释放相应的资源或者对状态进行保存
 }
 
+// OnConfigChange 模块配置文件变更后重载本模块以应用新配置
+func (m *suki) OnConfigChange(*Config) {
+	bot.ReloadModuleAsync(ModuleName)
+}
+
 func (m *suki) checkKeywords(s string) bool {
 	// skip cmd
-	if len(s) > 0 && s[0] == common.CmdIdentifier {
+	if common.IsCmd(s) {
 		return false
 	}
 
@@ -132,7 +158,7 @@ func (m *suki) checkKeywords(s string) bool {
 	return false
 }
 
-func (m *suki) SendDdPic(qqClient *client.QQClient, groupId int64) {
+func (m *suki) SendDdPic(qqClient bot.Client, groupId int64) {
 	msg := message.NewSendingMessage()
 	selectedImg := m.ddImgPool[rand.Intn(len(m.ddImgPool))]
 	r := bytes.NewReader(selectedImg)
@@ -142,10 +168,10 @@ func (m *suki) SendDdPic(qqClient *client.QQClient, groupId int64) {
 		return
 	}
 	msg.Append(upImg)
-	qqClient.SendGroupMessage(groupId, msg)
+	bot.SendGroupMessage(groupId, msg, bot.PriorityNormal)
 }
 
-func (m *suki) handleGroupMessage(qqClient *client.QQClient, groupMessage *message.GroupMessage) {
+func (m *suki) handleGroupMessage(qqClient bot.Client, groupMessage *message.GroupMessage) {
 	// filter enabled groups
 	if _, ok := m.enabledGroupsMap[groupMessage.GroupCode]; !ok {
 		logger.Debugf("ignoring group message from group chat %s(%d)",
@@ -181,5 +207,5 @@ func (m *suki) handleGroupMessage(qqClient *client.QQClient, groupMessage *messa
 }
 
 func (m *suki) registerCallbacks(b *bot.Bot) {
-	b.GroupMessageEvent.Subscribe(m.handleGroupMessage)
+	b.GroupMessageEvent.Subscribe(ModuleName, m.handleGroupMessage)
 }
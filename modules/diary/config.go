@@ -1,8 +1,24 @@
 package diary
 
+import "errors"
+
 type Config struct {
 	EnabledGroups []int64 `yaml:"enabled_groups"`
 	RedisAddr     string  `yaml:"redis_addr"`
 	RedisPassword string  `yaml:"redis_password"`
 	RedisDb       int     `yaml:"redis_db"`
 }
+
+func (c *Config) SetDefaults() {
+	c.RedisAddr = "localhost:6379"
+}
+
+func (c *Config) Validate() error {
+	if c.RedisAddr == "" {
+		return errors.New("redis_addr must not be empty")
+	}
+	if c.RedisDb < 0 {
+		return errors.New("redis_db must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package diary
+
+import (
+	"time"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
+)
+
+// registerCommands 注册本模块的 shell 命令
+func (m *diary) registerCommands() {
+	err := shell.RegisterCommand(ModuleName, &shell.Command{
+		Name:        "diary",
+		Aliases:     []string{"日记"},
+		Description: "群友日记",
+		SubCmds: []*shell.Command{
+			{
+				Name:        "init",
+				Aliases:     []string{"初始化"},
+				Description: "初始化用户日记",
+				Examples:    []string{"diary init 100"},
+				Spec:        &shell.CmdSpec{Args: []shell.ArgSpec{{Name: "寿命", Type: shell.ArgInt}}},
+				Handler:     handleDiaryInit,
+			},
+			{Name: "show", Aliases: []string{"查看"}, Description: "显示当前属性值", Handler: handleDiaryShow},
+			{
+				Name:        "apply",
+				Aliases:     []string{"记录"},
+				Description: "记录事件",
+				Spec:        &shell.CmdSpec{Args: []shell.ArgSpec{{Name: "事件"}}},
+				Cooldown:    shell.Cooldown{User: 10 * time.Second},
+				Handler:     handleDiaryApply,
+			},
+			{Name: "events", Aliases: []string{"事件"}, Description: "显示事件列表", Handler: handleDiaryEvents},
+		},
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed to register commands")
+	}
+}
+
+func handleDiaryInit(ctx *shell.CmdContext) {
+	if !ctx.RequireGroup() {
+		return
+	}
+	ttl := ctx.ParsedCmd.IntArg(0)
+	if err := InitDiary(ctx.GroupId, ctx.UserId, ttl); err != nil {
+		ctx.Reply("初始化失败，未知错误")
+	} else {
+		ctx.Reply("初始化成功")
+	}
+}
+
+func handleDiaryShow(ctx *shell.CmdContext) {
+	if ctx.RequireGroup() {
+		ctx.Reply(QueryDiary(ctx.GroupId, ctx.UserId))
+	}
+}
+
+func handleDiaryApply(ctx *shell.CmdContext) {
+	if ctx.RequireGroup() {
+		ctx.Reply(ApplyEventToDiary(ctx.GroupId, ctx.UserId, ctx.ParsedCmd.Arg(0)))
+	}
+}
+
+func handleDiaryEvents(ctx *shell.CmdContext) {
+	ctx.Reply(ListEvents())
+}
@@ -8,8 +8,7 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
 	"github.com/zhouziqunzzq/MiraiGo-DD/config"
-	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
-	"gopkg.in/yaml.v2"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
 	"sync"
 	"time"
 )
@@ -22,6 +21,7 @@ const (
 type diary struct {
 	isEnabled     bool
 	config        Config
+	moduleConfig  *config.ModuleConfig[Config]
 	enabledGroups map[int64]bool
 
 	rdb            *redis.Client
@@ -51,10 +51,22 @@ func (m *diary) MiraiGoModule() bot.ModuleInfo {
 	return bot.ModuleInfo{
 		ID:       ModuleName,
 		Instance: instance,
+		// 命令注册在 shell 中
+		Dependencies: []bot.ModuleID{shell.ModuleName},
 	}
 }
 
+// IsEnabled 本模块是否已成功初始化并启用
+func (m *diary) IsEnabled() bool {
+	return m.isEnabled
+}
+
 func (m *diary) Init() {
+	// reset states in case of reloading
+	m.config = Config{}
+	m.enabledGroups = make(map[int64]bool)
+	m.initFinish = make(chan bool)
+
 	// check is_enabled
 	m.isEnabled = config.GlobalConfig.GetBool("modules." + ModuleName + ".is_enabled")
 	if !m.isEnabled {
@@ -63,18 +75,17 @@ func (m *diary) Init() {
 	}
 
 	// load module config
-	configPath := config.GlobalConfig.GetString("modules." + ModuleName + ".config_path")
-	if configPath == "" {
-		configPath = "./diary.yaml"
-	}
-	logger.Debugf("reading config from %s", configPath)
-	cb := utils.ReadFile(configPath)
-	err := yaml.Unmarshal(cb, &m.config)
+	m.moduleConfig = config.NewModuleConfig[Config](ModuleName, "./diary.yaml")
+	cfg, err := m.moduleConfig.Load()
 	if err != nil {
-		logger.WithError(err).Errorf("unable to read config file in %s", configPath)
+		logger.WithError(err).Error("unable to load module config")
 		m.isEnabled = false
 		return
 	}
+	m.config = *cfg
+	if err = m.moduleConfig.Watch(m.OnConfigChange); err != nil {
+		logger.WithError(err).Warn("unable to watch module config, hot reload disabled")
+	}
 
 	// init redis cli
 	m.rdb = redis.NewClient(&redis.Options{
@@ -94,7 +105,11 @@ func (m *diary) Init() {
 	}
 }
 
-func (m *diary) PostInit() {}
+func (m *diary) PostInit() {
+	if m.isEnabled {
+		m.registerCommands()
+	}
+}
 
 func (m *diary) Serve(b *bot.Bot) {
 	if m.isEnabled {
@@ -108,15 +123,15 @@ func (m *diary) Start(b *bot.Bot) {
 	}
 
 	// start local attributes init goroutine
+	m.workerWg.Add(1)
 	go func() {
-		m.workerWg.Add(1)
 		defer m.workerWg.Done()
 		m.initLocalAttributesCache()
 	}()
 
 	// start ttl tick-down goroutine
+	m.workerWg.Add(1)
 	go func() {
-		m.workerWg.Add(1)
 		defer m.workerWg.Done()
 		m.tickDownTtlMainLoop()
 	}()
@@ -125,6 +140,12 @@ func (m *diary) Start(b *bot.Bot) {
 func (m *diary) Stop(b *bot.Bot, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	// stop watching module config
+	if m.moduleConfig != nil {
+		m.moduleConfig.Close()
+	}
+	shell.UnregisterCommands(ModuleName)
+
 	if !m.isEnabled {
 		return
 	}
@@ -142,6 +163,11 @@ func (m *diary) Stop(b *bot.Bot, wg *sync.WaitGroup) {
 	m.workerWg.Wait()
 }
 
+// OnConfigChange 模块配置文件变更后重载本模块以应用新配置
+func (m *diary) OnConfigChange(*Config) {
+	bot.ReloadModuleAsync(ModuleName)
+}
+
 //func (m *diary) handleGroupMessage(qqClient *client.QQClient, groupMessage *message.GroupMessage) {
 //	//
 //}
@@ -240,9 +266,9 @@ func (m *diary) syncAttributeAll() (err error) {
 // initLocalAttributesCache fetches Attributes for all users
 // in each of the groups with diary module enabled.
 func (m *diary) initLocalAttributesCache() {
-	defer func() {
-		m.initFinish <- true
-	}()
+	// Note: close instead of send so that it never blocks even if
+	// tickDownTtlMainLoop has already quit
+	defer close(m.initFinish)
 
 	for groupId, _ := range m.enabledGroups {
 		// search for all keys in redis matching "groupId-*"
@@ -9,6 +9,8 @@ import (
 	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
 )
 
+const ModuleName = "internal.logging"
+
 func init() {
 	instance = &logging{}
 	bot.RegisterModule(instance)
@@ -19,8 +21,10 @@ type logging struct {
 
 func (m *logging) MiraiGoModule() bot.ModuleInfo {
 	return bot.ModuleInfo{
-		ID:       "internal.logging",
+		ID:       ModuleName,
 		Instance: instance,
+		// 日志应先于其他 Module 注册，以便记录完整的事件
+		Priority: 100,
 	}
 }
 
@@ -62,7 +66,7 @@ func (m *logging) Stop(b *bot.Bot, wg *sync.WaitGroup) {
 
 var instance *logging
 
-var logger = utils.GetModuleLogger("internal.logging")
+var logger = utils.GetModuleLogger(ModuleName)
 
 func logGroupMessage(msg *message.GroupMessage) {
 	logger.
@@ -120,27 +124,27 @@ func logDisconnect(event *client.ClientDisconnectedEvent) {
 }
 
 func registerLog(b *bot.Bot) {
-	b.GroupMessageRecalledEvent.Subscribe(func(qqClient *client.QQClient, event *client.GroupMessageRecalledEvent) {
+	b.GroupMessageRecalledEvent.Subscribe(ModuleName, func(_ bot.Client, event *client.GroupMessageRecalledEvent) {
 		logGroupMessageRecallEvent(event)
 	})
 
-	b.GroupMessageEvent.Subscribe(func(qqClient *client.QQClient, groupMessage *message.GroupMessage) {
+	b.GroupMessageEvent.Subscribe(ModuleName, func(_ bot.Client, groupMessage *message.GroupMessage) {
 		logGroupMessage(groupMessage)
 	})
 
-	b.GroupMuteEvent.Subscribe(func(qqClient *client.QQClient, event *client.GroupMuteEvent) {
+	b.GroupMuteEvent.Subscribe(ModuleName, func(_ bot.Client, event *client.GroupMuteEvent) {
 		logGroupMuteEvent(event)
 	})
 
-	b.PrivateMessageEvent.Subscribe(func(qqClient *client.QQClient, privateMessage *message.PrivateMessage) {
+	b.PrivateMessageEvent.Subscribe(ModuleName, func(_ bot.Client, privateMessage *message.PrivateMessage) {
 		logPrivateMessage(privateMessage)
 	})
 
-	b.FriendMessageRecalledEvent.Subscribe(func(qqClient *client.QQClient, event *client.FriendMessageRecalledEvent) {
+	b.FriendMessageRecalledEvent.Subscribe(ModuleName, func(_ bot.Client, event *client.FriendMessageRecalledEvent) {
 		logFriendMessageRecallEvent(event)
 	})
 
-	b.DisconnectedEvent.Subscribe(func(qqClient *client.QQClient, event *client.ClientDisconnectedEvent) {
+	b.DisconnectedEvent.Subscribe(ModuleName, func(_ bot.Client, event *client.ClientDisconnectedEvent) {
 		logDisconnect(event)
 	})
 }
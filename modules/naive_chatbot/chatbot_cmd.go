@@ -0,0 +1,61 @@
+package naive_chatbot
+
+import (
+	"fmt"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
+)
+
+// registerCommands 注册本模块的 shell 命令
+func (m *chatbot) registerCommands() {
+	err := shell.RegisterSubCommand(ModuleName, "ls", &shell.Command{
+		Name:        "chatbot",
+		Description: "显示本群聊天机器人的参数",
+		Handler:     handleLsChatbot,
+	})
+	if err == nil {
+		err = shell.RegisterSubCommand(ModuleName, "set", &shell.Command{
+			Name:        "chatbot",
+			Description: "设置本群聊天机器人的参数",
+			SubCmds: []*shell.Command{
+				{
+					Name:        "trigger_prob",
+					Description: "设置聊天机器人的触发概率",
+					Examples:    []string{"set chatbot trigger_prob 0.1"},
+					Spec:        &shell.CmdSpec{Args: []shell.ArgSpec{{Name: "概率", Type: shell.ArgFloat}}},
+					Handler:     handleSetChatbotTriggerProb,
+				},
+			},
+		})
+	}
+	if err != nil {
+		logger.WithError(err).Error("failed to register commands")
+	}
+}
+
+func handleLsChatbot(ctx *shell.CmdContext) {
+	if !ctx.RequireGroup() {
+		return
+	}
+	triggerProb, err := GetTriggerProb(ctx.GroupId)
+	if err != nil {
+		ctx.Reply("聊天机器人未启用")
+	} else {
+		rsp := "聊天机器人已启用\n"
+		rsp += fmt.Sprintf("触发概率：%f", triggerProb)
+		ctx.Reply(rsp)
+	}
+}
+
+func handleSetChatbotTriggerProb(ctx *shell.CmdContext) {
+	if !ctx.RequireGroup() {
+		return
+	}
+	newProb := ctx.ParsedCmd.FloatArg(0)
+	err := SetTriggerProb(ctx.GroupId, float32(newProb))
+	if err != nil {
+		ctx.Reply(fmt.Sprintf("无效的 value (%s): %v", ctx.ParsedCmd.Arg(0), err))
+		return
+	}
+	ctx.Reply("参数更新成功")
+}
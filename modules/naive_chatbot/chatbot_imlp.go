@@ -2,15 +2,13 @@ package naive_chatbot
 
 import (
 	"context"
-	"github.com/Mrs4s/MiraiGo/client"
 	"github.com/Mrs4s/MiraiGo/message"
 	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
 	"github.com/zhouziqunzzq/MiraiGo-DD/config"
 	"github.com/zhouziqunzzq/MiraiGo-DD/modules/common"
 	pb "github.com/zhouziqunzzq/MiraiGo-DD/modules/naive_chatbot/protos"
-	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/shell"
 	"google.golang.org/grpc"
-	"gopkg.in/yaml.v2"
 	"math/rand"
 	"sync"
 	"time"
@@ -21,8 +19,9 @@ const (
 )
 
 type chatbot struct {
-	isEnabled bool
-	config    Config
+	isEnabled    bool
+	config       Config
+	moduleConfig *config.ModuleConfig[Config]
 	//enabledGroupsMap map[int64]bool
 	groupTriggerProb map[int64]float32
 	conn             *grpc.ClientConn
@@ -43,10 +42,23 @@ func (m *chatbot) MiraiGoModule() bot.ModuleInfo {
 	return bot.ModuleInfo{
 		ID:       ModuleName,
 		Instance: instance,
+		// 命令注册在 shell 中
+		Dependencies: []bot.ModuleID{shell.ModuleName},
 	}
 }
 
+// IsEnabled 本模块是否已成功初始化并启用
+func (m *chatbot) IsEnabled() bool {
+	return m.isEnabled
+}
+
 func (m *chatbot) Init() {
+	// reset states in case of reloading
+	m.config = Config{}
+	m.groupTriggerProb = make(map[int64]float32)
+	m.conn = nil
+	m.client = nil
+
 	// check is_enabled
 	m.isEnabled = config.GlobalConfig.GetBool("modules." + ModuleName + ".is_enabled")
 	if !m.isEnabled {
@@ -55,25 +67,17 @@ func (m *chatbot) Init() {
 	}
 
 	// load module config
-	configPath := config.GlobalConfig.GetString("modules." + ModuleName + ".config_path")
-	if configPath == "" {
-		configPath = "./naive_chatbot.yaml"
-	}
-	logger.Debugf("reading config from %s", configPath)
-	cb := utils.ReadFile(configPath)
-	err := yaml.Unmarshal(cb, &m.config)
+	m.moduleConfig = config.NewModuleConfig[Config](ModuleName, "./naive_chatbot.yaml")
+	cfg, err := m.moduleConfig.Load()
 	if err != nil {
-		logger.WithError(err).Errorf("unable to read config file in %s", configPath)
+		logger.WithError(err).Error("unable to load module config")
 		m.isEnabled = false
 		return
 	}
-	// check trigger prob range
-	if m.config.TriggerProb < 0.0 || m.config.TriggerProb > 1.0 {
-		logger.WithError(err).Errorf("invalid trigger_prob %f provided in config", m.config.TriggerProb)
-		m.isEnabled = false
-		return
+	m.config = *cfg
+	if err = m.moduleConfig.Watch(m.OnConfigChange); err != nil {
+		logger.WithError(err).Warn("unable to watch module config, hot reload disabled")
 	}
-
 	// load enabled groups
 	for _, groupCode := range m.config.EnabledGroups {
 		m.groupTriggerProb[groupCode] = m.config.TriggerProb
@@ -95,7 +99,11 @@ func (m *chatbot) Init() {
 	m.client = pb.NewChatPredictorClient(m.conn)
 }
 
-func (m *chatbot) PostInit() {}
+func (m *chatbot) PostInit() {
+	if m.isEnabled {
+		m.registerCommands()
+	}
+}
 
 func (m *chatbot) Serve(b *bot.Bot) {
 	if m.isEnabled {
@@ -108,11 +116,23 @@ func (m *chatbot) Start(b *bot.Bot) {}
 func (m *chatbot) Stop(b *bot.Bot, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	// stop watching module config
+	if m.moduleConfig != nil {
+		m.moduleConfig.Close()
+	}
+	shell.UnregisterCommands(ModuleName)
+
 	if m.conn != nil {
 		_ = m.conn.Close()
+		m.conn = nil
 	}
 }
 
+// OnConfigChange 模块配置文件变更后重载本模块以应用新配置
+func (m *chatbot) OnConfigChange(*Config) {
+	bot.ReloadModuleAsync(ModuleName)
+}
+
 func (m *chatbot) PredictOne(msg string) []*pb.PredictReply_PredictReplyElem {
 	// prepare predict request
 	req := &pb.PredictRequest{
@@ -137,7 +157,7 @@ func (m *chatbot) PredictOne(msg string) []*pb.PredictReply_PredictReplyElem {
 	}
 }
 
-func (m *chatbot) handleGroupMessage(qqClient *client.QQClient, groupMessage *message.GroupMessage) {
+func (m *chatbot) handleGroupMessage(_ bot.Client, groupMessage *message.GroupMessage) {
 	// filter enabled groups
 	triggerProb := float32(0.0)
 	if tp, ok := m.groupTriggerProb[groupMessage.GroupCode]; !ok {
@@ -152,7 +172,7 @@ func (m *chatbot) handleGroupMessage(qqClient *client.QQClient, groupMessage *me
 
 	chatReq := groupMessage.ToString()
 	// ignore empty str and cmd
-	if len(chatReq) == 0 || chatReq[0] == common.CmdIdentifier {
+	if len(chatReq) == 0 || common.IsCmd(chatReq) {
 		return
 	}
 
@@ -168,7 +188,7 @@ func (m *chatbot) handleGroupMessage(qqClient *client.QQClient, groupMessage *me
 		chosenRsp := rsp[idx]
 		msg := message.NewSendingMessage()
 		msg.Append(message.NewText(*(chosenRsp.Msg)))
-		qqClient.SendGroupMessage(groupMessage.GroupCode, msg)
+		bot.SendGroupMessage(groupMessage.GroupCode, msg, bot.PriorityNormal)
 		logger.Infof(
 			"reply to group message \"%s\" from group %s(%d) with msg \"%s\" and sim %f",
 			chatReq,
@@ -181,5 +201,5 @@ func (m *chatbot) handleGroupMessage(qqClient *client.QQClient, groupMessage *me
 }
 
 func (m *chatbot) registerCallbacks(b *bot.Bot) {
-	b.GroupMessageEvent.Subscribe(m.handleGroupMessage)
+	b.GroupMessageEvent.Subscribe(ModuleName, m.handleGroupMessage)
 }
@@ -1,5 +1,10 @@
 package naive_chatbot
 
+import (
+	"errors"
+	"fmt"
+)
+
 type Config struct {
 	EnabledGroups     []int64 `yaml:"enabled_groups"`
 	NumPrediction     int64   `yaml:"n_prediction"`
@@ -8,3 +13,21 @@ type Config struct {
 	GrpcServerAddr    string  `yaml:"grpc_server_addr"`
 	TriggerProb       float32 `yaml:"trigger_prob"`
 }
+
+func (c *Config) SetDefaults() {
+	c.NumPrediction = 5
+	c.TimeOffsetSeconds = 300
+}
+
+func (c *Config) Validate() error {
+	if c.GrpcServerAddr == "" {
+		return errors.New("grpc_server_addr must not be empty")
+	}
+	if c.NumPrediction <= 0 {
+		return errors.New("n_prediction must be positive")
+	}
+	if c.TriggerProb < 0.0 || c.TriggerProb > 1.0 {
+		return fmt.Errorf("invalid trigger_prob %f, must be in range [0, 1]", c.TriggerProb)
+	}
+	return nil
+}
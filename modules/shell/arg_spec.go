@@ -0,0 +1,216 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/common"
+)
+
+// ArgType 参数类型
+type ArgType int
+
+const (
+	ArgString ArgType = iota
+	ArgInt
+	ArgFloat
+	ArgBool
+)
+
+func (t ArgType) String() string {
+	switch t {
+	case ArgInt:
+		return "整数"
+	case ArgFloat:
+		return "小数"
+	case ArgBool:
+		return "布尔值"
+	default:
+		return "文本"
+	}
+}
+
+func (t ArgType) check(v string) bool {
+	var err error
+	switch t {
+	case ArgInt:
+		_, err = strconv.ParseInt(v, 10, 64)
+	case ArgFloat:
+		_, err = strconv.ParseFloat(v, 64)
+	case ArgBool:
+		_, err = strconv.ParseBool(v)
+	}
+	return err == nil
+}
+
+// ArgSpec 位置参数的声明
+type ArgSpec struct {
+	// Name 参数名，用于生成用法说明
+	Name string
+	Type ArgType
+	// Optional 可选参数，只能位于必选参数之后
+	Optional bool
+	// Variadic 接收剩余的所有参数，只能是最后一个参数
+	Variadic bool
+	// Choices 非空时，参数只能取其中之一
+	Choices []string
+}
+
+func (a *ArgSpec) usage() string {
+	s := a.Name
+	if len(a.Choices) > 0 {
+		s = strings.Join(a.Choices, "|")
+	}
+	if a.Optional {
+		s = "[" + s + "]"
+	} else {
+		s = "<" + s + ">"
+	}
+	if a.Variadic {
+		s += "..."
+	}
+	return s
+}
+
+func (a *ArgSpec) check(v string) error {
+	if len(a.Choices) > 0 {
+		for _, c := range a.Choices {
+			if v == c {
+				return nil
+			}
+		}
+		return fmt.Errorf("<%s> 应为 %s 之一", a.Name, strings.Join(a.Choices, ", "))
+	}
+	if !a.Type.check(v) {
+		return fmt.Errorf("<%s> 应为%s", a.Name, a.Type)
+	}
+	return nil
+}
+
+// FlagSpec --key=value 形式的选项的声明
+// ArgBool 类型的选项可省略值，如 --all
+type FlagSpec struct {
+	Name  string
+	Type  ArgType
+	Usage string
+}
+
+func (f *FlagSpec) usage() string {
+	if f.Type == ArgBool {
+		return "[--" + f.Name + "]"
+	}
+	return fmt.Sprintf("[--%s=<%s>]", f.Name, f.Type)
+}
+
+// CmdSpec 命令参数的声明，用于校验参数及生成用法说明
+type CmdSpec struct {
+	Args  []ArgSpec
+	Flags []FlagSpec
+}
+
+// globalFlags 所有命令均支持的选项
+var globalFlags = []FlagSpec{
+	{Name: "group", Type: ArgInt, Usage: "指定命令作用的群，仅限私聊与临时会话"},
+}
+
+// Usage 生成用法说明，path 为命令名及子命令，如 "diary init"
+func (s *CmdSpec) Usage(path string) string {
+	sb := strings.Builder{}
+	sb.WriteString("用法：")
+	sb.WriteString(common.CmdPrefix())
+	sb.WriteString(path)
+	for i := range s.Args {
+		sb.WriteRune(' ')
+		sb.WriteString(s.Args[i].usage())
+	}
+	for i := range s.Flags {
+		sb.WriteRune(' ')
+		sb.WriteString(s.Flags[i].usage())
+	}
+	return sb.String()
+}
+
+// flagSpec 查找选项的声明，包括全局选项
+func (s *CmdSpec) flagSpec(name string) *FlagSpec {
+	for _, flags := range [][]FlagSpec{s.Flags, globalFlags} {
+		for i := range flags {
+			if flags[i].Name == name {
+				return &flags[i]
+			}
+		}
+	}
+	return nil
+}
+
+// valueFlags 需要取值的选项，即 --key value 中的 key
+func (s *CmdSpec) valueFlags() map[string]bool {
+	rst := make(map[string]bool)
+	for _, flags := range [][]FlagSpec{s.Flags, globalFlags} {
+		for _, f := range flags {
+			if f.Type != ArgBool {
+				rst[f.Name] = true
+			}
+		}
+	}
+	return rst
+}
+
+// validateArgs 校验位置参数的个数与类型
+func (s *CmdSpec) validateArgs(args []string) error {
+	for i := range s.Args {
+		spec := &s.Args[i]
+		if i >= len(args) {
+			if spec.Optional {
+				return nil
+			}
+			return fmt.Errorf("缺少参数 <%s>", spec.Name)
+		}
+		values := args[i : i+1]
+		if spec.Variadic {
+			values = args[i:]
+		}
+		for _, v := range values {
+			if err := spec.check(v); err != nil {
+				return err
+			}
+		}
+		if spec.Variadic {
+			return nil
+		}
+	}
+	if len(args) > len(s.Args) {
+		return fmt.Errorf("参数过多：%s", strings.Join(args[len(s.Args):], " "))
+	}
+	return nil
+}
+
+// validateFlags 校验选项是否已声明及其类型
+func (s *CmdSpec) validateFlags(kwArgs map[string]string) error {
+	for k, v := range kwArgs {
+		spec := s.flagSpec(k)
+		if spec == nil {
+			return fmt.Errorf("未知选项 --%s", k)
+		}
+		if !spec.Type.check(v) {
+			return fmt.Errorf("选项 --%s 应为%s", k, spec.Type)
+		}
+	}
+	return nil
+}
+
+// bind 依照声明重新解析并校验命令的参数与选项
+// 前 skip 个位置参数为子命令名，将被移除
+func (s *CmdSpec) bind(pc *ParsedCmd, skip int) error {
+	if err := pc.bind(s.valueFlags()); err != nil {
+		return err
+	}
+	if err := s.validateFlags(pc.KwArgs); err != nil {
+		return err
+	}
+	if skip > len(pc.Args) {
+		skip = len(pc.Args)
+	}
+	pc.Args = pc.Args[skip:]
+	return s.validateArgs(pc.Args)
+}
@@ -0,0 +1,114 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCmdSpecBind(t *testing.T) {
+	spec := &CmdSpec{
+		Args: []ArgSpec{
+			{Name: "uid", Type: ArgInt},
+			{Name: "type", Choices: []string{"live", "dynamic"}},
+			{Name: "ratio", Type: ArgFloat, Optional: true},
+			{Name: "note", Optional: true, Variadic: true},
+		},
+		Flags: []FlagSpec{
+			{Name: "all", Type: ArgBool},
+			{Name: "limit", Type: ArgInt},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		s          string
+		skip       int
+		wantArgs   []string
+		wantKwArgs map[string]string
+		wantErr    bool
+	}{
+		{name: "required only", s: "/sub 1 live",
+			wantArgs: []string{"1", "live"}, wantKwArgs: map[string]string{}},
+		{name: "optional and variadic", s: "/sub 1 dynamic 0.5 a b",
+			wantArgs: []string{"1", "dynamic", "0.5", "a", "b"}, wantKwArgs: map[string]string{}},
+		{name: "skip subcommand", s: "/sub add 1 live", skip: 1,
+			wantArgs: []string{"1", "live"}, wantKwArgs: map[string]string{}},
+		{name: "value flag rebound", s: "/sub --limit 3 1 live",
+			wantArgs: []string{"1", "live"}, wantKwArgs: map[string]string{"limit": "3"}},
+		{name: "bool flag", s: "/sub 1 live --all",
+			wantArgs: []string{"1", "live"}, wantKwArgs: map[string]string{"all": "true"}},
+		{name: "global flag", s: "/sub 1 live --group=123",
+			wantArgs: []string{"1", "live"}, wantKwArgs: map[string]string{"group": "123"}},
+		{name: "missing arg", s: "/sub 1", wantErr: true},
+		{name: "not an int", s: "/sub a live", wantErr: true},
+		{name: "not a choice", s: "/sub 1 video", wantErr: true},
+		{name: "not a float", s: "/sub 1 live x", wantErr: true},
+		{name: "unknown flag", s: "/sub 1 live --foo", wantErr: true},
+		{name: "bad flag value", s: "/sub 1 live --limit=x", wantErr: true},
+		{name: "bad bool flag value", s: "/sub 1 live --all=maybe", wantErr: true},
+		{name: "bad global flag value", s: "/sub 1 live --group=abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc, err := parseCmd(tt.s, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = spec.bind(pc, tt.skip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bind(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(pc.Args, tt.wantArgs) {
+				t.Fatalf("bind(%q).Args = %q, want %q", tt.s, pc.Args, tt.wantArgs)
+			}
+			if !reflect.DeepEqual(pc.KwArgs, tt.wantKwArgs) {
+				t.Fatalf("bind(%q).KwArgs = %v, want %v", tt.s, pc.KwArgs, tt.wantKwArgs)
+			}
+		})
+	}
+}
+
+func TestCmdSpecValidateArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    CmdSpec
+		args    []string
+		wantErr bool
+	}{
+		{"no spec no args", CmdSpec{}, nil, false},
+		{"no spec extra args", CmdSpec{}, []string{"a"}, true},
+		{"too many args", CmdSpec{Args: []ArgSpec{{Name: "a"}}}, []string{"a", "b"}, true},
+		{"bool arg", CmdSpec{Args: []ArgSpec{{Name: "on", Type: ArgBool}}}, []string{"true"}, false},
+		{"bad bool arg", CmdSpec{Args: []ArgSpec{{Name: "on", Type: ArgBool}}}, []string{"yes"}, true},
+		{"variadic empty", CmdSpec{Args: []ArgSpec{{Name: "a", Optional: true, Variadic: true}}}, nil, false},
+		{"variadic typed", CmdSpec{Args: []ArgSpec{{Name: "a", Type: ArgInt, Variadic: true}}}, []string{"1", "x"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.spec.validateArgs(tt.args); (err != nil) != tt.wantErr {
+				t.Fatalf("validateArgs(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCmdSpecUsage(t *testing.T) {
+	spec := &CmdSpec{
+		Args: []ArgSpec{
+			{Name: "uid", Type: ArgInt},
+			{Name: "type", Choices: []string{"live", "dynamic"}, Optional: true},
+			{Name: "note", Optional: true, Variadic: true},
+		},
+		Flags: []FlagSpec{
+			{Name: "all", Type: ArgBool},
+			{Name: "limit", Type: ArgInt},
+		},
+	}
+	want := "用法：/bili sub <uid> [live|dynamic] [note]... [--all] [--limit=<整数>]"
+	if got := spec.Usage("bili sub"); got != want {
+		t.Fatalf("Usage() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,192 @@
+package shell
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditOutcome 命令调用的结果
+type auditOutcome string
+
+const (
+	outcomeOk           auditOutcome = "ok"
+	outcomeParseError   auditOutcome = "parse_error"
+	outcomeInvalidArgs  auditOutcome = "invalid_args"
+	outcomeNotMember    auditOutcome = "not_member"
+	outcomeWrongContext auditOutcome = "wrong_context"
+	outcomeUnauthorized auditOutcome = "unauthorized"
+	outcomeCooldown     auditOutcome = "cooldown"
+	outcomeBusy         auditOutcome = "busy"
+	outcomePanic        auditOutcome = "panic"
+)
+
+// auditRecord 审计日志中的一条记录，每条记录占一行 JSON
+type auditRecord struct {
+	Time    time.Time `json:"time"`
+	UserId  int64     `json:"user_id"`
+	GroupId int64     `json:"group_id,omitempty"`
+	Source  string    `json:"source"`
+	Raw     string    `json:"raw"`
+	// Cmd 处理本次调用的命令路径，参数错误时可能为空
+	Cmd     string       `json:"cmd,omitempty"`
+	Outcome auditOutcome `json:"outcome"`
+	// LatencyMs 从收到消息到命令处理完毕（或被拒绝）的毫秒数
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+func sourceName(source MsgContext) string {
+	switch source {
+	case GroupContext:
+		return "group"
+	case PrivateContext:
+		return "private"
+	case TempContext:
+		return "temp"
+	default:
+		return "unknown"
+	}
+}
+
+// auditLog 只追加的审计日志，以 JSON lines 格式保存在文件中
+// path 为空时不记录
+type auditLog struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File // mu protected
+}
+
+func newAuditLog(path string) *auditLog {
+	return &auditLog{path: path}
+}
+
+func (l *auditLog) open() error {
+	if len(l.path) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.file = f
+	return nil
+}
+
+func (l *auditLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		_ = l.file.Close()
+		l.file = nil
+	}
+}
+
+func (l *auditLog) append(rec *auditRecord) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		logger.WithError(err).Error("failed to marshal audit record")
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		// disabled, or closed while the cmd was running
+		return
+	}
+	if _, err = l.file.Write(append(b, '\n')); err != nil {
+		logger.WithError(err).Errorf("failed to write audit record to %s", l.path)
+	}
+}
+
+// auditFilter 查询审计日志的条件，零值字段表示不限制
+type auditFilter struct {
+	UserId  int64
+	GroupId int64
+	// Cmd 命令路径前缀，如 "set" 同时匹配 "set chatbot trigger_prob"
+	Cmd   string
+	Since time.Time
+}
+
+func (f *auditFilter) match(rec *auditRecord) bool {
+	if f.UserId != 0 && rec.UserId != f.UserId {
+		return false
+	}
+	if f.GroupId != 0 && rec.GroupId != f.GroupId {
+		return false
+	}
+	if len(f.Cmd) > 0 && rec.Cmd != f.Cmd && !strings.HasPrefix(rec.Cmd, f.Cmd+" ") {
+		return false
+	}
+	return !rec.Time.Before(f.Since)
+}
+
+// query 返回满足 filter 的最近 limit 条记录，按时间先后排列
+func (l *auditLog) query(filter *auditFilter, limit int) ([]*auditRecord, error) {
+	if len(l.path) == 0 {
+		return nil, errors.New("audit log is disabled")
+	}
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// keep the last limit matches in a ring
+	ring := make([]*auditRecord, limit)
+	n := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		rec := &auditRecord{}
+		if err = json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			// skip lines broken by a crash while writing
+			continue
+		}
+		if filter.match(rec) {
+			ring[n%limit] = rec
+			n++
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if n < limit {
+		return ring[:n], nil
+	}
+	return append(ring[n%limit:], ring[:n%limit]...), nil
+}
+
+// parseSince 解析查询的起始时间，支持 "30m"、"24h" 等时长，"7d" 等天数，以及 "2006-01-02" 等日期
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && strings.HasSuffix(s, "d") {
+		return now.AddDate(0, 0, -days), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法识别的时间 %s", s)
+}
@@ -0,0 +1,199 @@
+package shell
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var auditT0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestAuditLog 在临时目录中打开审计日志，测试结束后关闭
+func newTestAuditLog(t *testing.T) *auditLog {
+	t.Helper()
+	l := newAuditLog(filepath.Join(t.TempDir(), "audit", "shell_audit.jsonl"))
+	if err := l.open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(l.close)
+	return l
+}
+
+// readAuditLines 读取审计日志的每一行
+func readAuditLines(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func TestAuditLogAppend(t *testing.T) {
+	l := newTestAuditLog(t)
+	l.append(&auditRecord{Time: auditT0, UserId: 1, GroupId: 100, Source: "group", Raw: "/ping", Cmd: "ping", Outcome: outcomeOk})
+	l.append(&auditRecord{Time: auditT0, UserId: 2, Source: "private", Raw: "/ping --x", Outcome: outcomeInvalidArgs, Error: "bad"})
+
+	// reopening appends instead of truncating
+	l.close()
+	l.append(&auditRecord{Time: auditT0, UserId: 3, Outcome: outcomeOk}) // dropped while closed
+	if err := l.open(); err != nil {
+		t.Fatal(err)
+	}
+	l.append(&auditRecord{Time: auditT0, UserId: 4, Outcome: outcomeOk})
+
+	lines := readAuditLines(t, l.path)
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %q", len(lines), lines)
+	}
+	rec := &auditRecord{}
+	if err := json.Unmarshal([]byte(lines[1]), rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.UserId != 2 || rec.GroupId != 0 || rec.Outcome != outcomeInvalidArgs || rec.Error != "bad" || !rec.Time.Equal(auditT0) {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["group_id"]; ok {
+		t.Fatalf("expected group_id to be omitted, got %s", lines[1])
+	}
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	l := newAuditLog("")
+	if err := l.open(); err != nil {
+		t.Fatal(err)
+	}
+	l.append(&auditRecord{UserId: 1})
+	if _, err := l.query(&auditFilter{}, 10); err == nil {
+		t.Fatal("expected querying a disabled audit log to fail")
+	}
+}
+
+func TestAuditLogQuery(t *testing.T) {
+	l := newTestAuditLog(t)
+	recs := []*auditRecord{
+		{UserId: 1, GroupId: 100, Cmd: "ping"},
+		{UserId: 2, GroupId: 100, Cmd: "set chatbot trigger_prob"},
+		{UserId: 1, GroupId: 101, Cmd: "set"},
+		{UserId: 1, GroupId: 100, Cmd: "settings"},
+		{UserId: 2, Cmd: "ping"},
+		{UserId: 1, GroupId: 100, Cmd: "ping"},
+	}
+	for i, rec := range recs {
+		rec.Time = auditT0.Add(time.Duration(i) * time.Hour)
+		rec.Raw = "/" + rec.Cmd
+		rec.Outcome = outcomeOk
+		l.append(rec)
+	}
+	// a line broken by a crash is skipped
+	if _, err := l.file.WriteString("{\"time\":\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter auditFilter
+		limit  int
+		want   []int // indexes of recs
+	}{
+		{"all", auditFilter{}, 10, []int{0, 1, 2, 3, 4, 5}},
+		{"limit keeps the latest", auditFilter{}, 2, []int{4, 5}},
+		{"limit equal to matches", auditFilter{UserId: 2}, 2, []int{1, 4}},
+		{"user", auditFilter{UserId: 1}, 10, []int{0, 2, 3, 5}},
+		{"group", auditFilter{GroupId: 100}, 10, []int{0, 1, 3, 5}},
+		{"cmd prefix", auditFilter{Cmd: "set"}, 10, []int{1, 2}},
+		{"full cmd path", auditFilter{Cmd: "set chatbot trigger_prob"}, 10, []int{1}},
+		{"since", auditFilter{Since: auditT0.Add(4 * time.Hour)}, 10, []int{4, 5}},
+		{"combined", auditFilter{UserId: 1, GroupId: 100, Cmd: "ping"}, 1, []int{5}},
+		{"no match", auditFilter{UserId: 3}, 10, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.query(&tt.filter, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d records, got %d", len(tt.want), len(got))
+			}
+			for i, rec := range got {
+				if !rec.Time.Equal(recs[tt.want[i]].Time) {
+					t.Fatalf("record %d: expected rec %d at %v, got %v", i, tt.want[i], recs[tt.want[i]].Time, rec.Time)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditLogQueryMissingFile(t *testing.T) {
+	l := newAuditLog(filepath.Join(t.TempDir(), "missing.jsonl"))
+	recs, err := l.query(&auditFilter{}, 10)
+	if err != nil || len(recs) != 0 {
+		t.Fatalf("expected no record and no error, got %v, %v", recs, err)
+	}
+}
+
+func TestAuditLimit(t *testing.T) {
+	tests := []struct {
+		limit int64
+		want  int
+	}{
+		{0, auditDefaultLimit},
+		{-5, auditDefaultLimit},
+		{1, 1},
+		{auditMaxLimit, auditMaxLimit},
+		{auditMaxLimit + 1, auditMaxLimit},
+	}
+	for _, tt := range tests {
+		if got := auditLimit(tt.limit); got != tt.want {
+			t.Errorf("auditLimit(%d) = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2024, 3, 10, 12, 30, 0, 0, loc)
+
+	tests := []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"30m", now.Add(-30 * time.Minute), false},
+		{"24h", now.Add(-24 * time.Hour), false},
+		{"1h30m", now.Add(-90 * time.Minute), false},
+		{"7d", now.AddDate(0, 0, -7), false},
+		{"0d", now, false},
+		{"2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, loc), false},
+		{"2024-01-01T08:15", time.Date(2024, 1, 1, 8, 15, 0, 0, loc), false},
+		{"2024-01-01T08:15:30", time.Date(2024, 1, 1, 8, 15, 30, 0, loc), false},
+		{"d", time.Time{}, true},
+		{"7days", time.Time{}, true},
+		{"2024/01/01", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.s, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSince(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -1,17 +1,71 @@
 package shell
 
-import "github.com/Mrs4s/MiraiGo/client"
+import (
+	"github.com/Mrs4s/MiraiGo/message"
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+)
+
+// MsgContext 命令来源的消息类型，可按位组合
+type MsgContext uint8
+
+const (
+	GroupContext MsgContext = 1 << iota
+	PrivateContext
+	TempContext
+
+	AnyContext = GroupContext | PrivateContext | TempContext
+)
+
+func (c MsgContext) String() string {
+	switch c {
+	case GroupContext:
+		return "群聊"
+	case PrivateContext:
+		return "私聊"
+	case TempContext:
+		return "临时会话"
+	default:
+		return "未知"
+	}
+}
 
 type CmdContext struct {
+	// Cmd 处理本次调用的命令，ParsedCmd.Args 不含子命令名
+	Cmd       *Command
 	ParsedCmd *ParsedCmd
-	Client    *client.QQClient
+	Client    bot.Client
 	OriginMsg interface{}
+	// Source 命令来源的消息类型
+	Source MsgContext
+	// GroupId 命令作用的群号
+	// 群聊与临时会话中默认为来源群，私聊中可通过 --group 指定，未指定时为 0
+	GroupId int64
+	// UserId 发送命令的用户
+	UserId int64
+	// Priority 回复消息的发送优先级
+	Priority bot.Priority
 }
 
-func NewCmdContext(parsedCmd *ParsedCmd, client *client.QQClient, originMsg interface{}) *CmdContext {
+func NewCmdContext(parsedCmd *ParsedCmd, client bot.Client, originMsg interface{}) *CmdContext {
 	return &CmdContext{
 		ParsedCmd: parsedCmd,
 		Client:    client,
 		OriginMsg: originMsg,
+		Priority:  bot.PriorityNormal,
 	}
 }
+
+// Reply 向命令的来源回复文本消息
+func (ctx *CmdContext) Reply(rsp string) {
+	sendTextRsp(rsp, ctx)
+}
+
+// ReplyMessage 向命令的来源回复消息
+func (ctx *CmdContext) ReplyMessage(rspMsg *message.SendingMessage) {
+	sendRsp(rspMsg, ctx)
+}
+
+// RequireGroup 检查命令是否作用于某个群，否则提示用户通过 --group 指定
+func (ctx *CmdContext) RequireGroup() bool {
+	return requireGroup(ctx)
+}
@@ -0,0 +1,218 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/common"
+)
+
+// Command 命令树中的一个节点
+// 有子命令的节点可以没有 Handler，此时调用该节点将显示其帮助信息
+type Command struct {
+	Name string
+	// Aliases 命令的别名，如 "日记"，可通过配置文件中的 aliases 添加更多
+	Aliases []string
+	// Description 一句话说明，显示在命令列表中
+	Description string
+	// Examples 使用示例，不含命令前缀，如 "diary init 100"
+	Examples []string
+	// RequiredRole 执行命令所需的角色，未指定时继承父命令，顶层命令默认为 RoleMember
+	// 可通过配置文件中的 command_roles 覆盖
+	RequiredRole Role
+	// Contexts 命令支持的消息类型，未指定时继承父命令，顶层命令默认为 AnyContext
+	Contexts MsgContext
+	// Cooldown 冷却时间，未指定时继承父命令并与之共享冷却
+	// 可通过配置文件中的 cooldowns 覆盖
+	Cooldown Cooldown
+	// Spec 参数声明，未指定时命令不接受参数
+	Spec    *CmdSpec
+	Handler func(*CmdContext)
+	SubCmds []*Command
+
+	parent *Command
+	// owner 注册命令的模块
+	owner bot.ModuleID
+}
+
+// link 设置子命令的父节点，并检查子命令是否重名
+func (c *Command) link() error {
+	names := make(map[string]bool)
+	for _, sub := range c.SubCmds {
+		for _, name := range sub.names() {
+			if !isValidCmdName(name) {
+				return fmt.Errorf("invalid sub command name %q of %s", name, c.path())
+			}
+			if names[name] {
+				return fmt.Errorf("duplicated sub command %s of %s", name, c.path())
+			}
+			if name == helpCmdName {
+				return fmt.Errorf("sub command name %s of %s is reserved", name, c.path())
+			}
+			names[name] = true
+		}
+		sub.parent = c
+		if len(sub.owner) == 0 {
+			sub.owner = c.owner
+		}
+		if err := sub.link(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// names 命令名及其别名
+func (c *Command) names() []string {
+	return append([]string{c.Name}, c.Aliases...)
+}
+
+// matches 命令名或别名是否为 name
+func (c *Command) matches(name string) bool {
+	if c.Name == name {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+	return false
+}
+
+// displayName 命令列表中显示的名称，如 "diary（日记）"
+func (c *Command) displayName() string {
+	if len(c.Aliases) == 0 {
+		return c.Name
+	}
+	return fmt.Sprintf("%s（%s）", c.Name, strings.Join(c.Aliases, "，"))
+}
+
+// path 命令的完整路径，如 "diary init"
+func (c *Command) path() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.path() + " " + c.Name
+}
+
+func (c *Command) contexts() MsgContext {
+	if c.Contexts != 0 {
+		return c.Contexts
+	}
+	if c.parent == nil {
+		return AnyContext
+	}
+	return c.parent.contexts()
+}
+
+// spec 获取参数声明
+// 没有 Handler 的节点只接受子命令名作为参数
+func (c *Command) spec() *CmdSpec {
+	if c.Handler == nil {
+		names := make([]string, 0, len(c.SubCmds))
+		for _, sub := range c.SubCmds {
+			names = append(names, sub.Name)
+		}
+		return &CmdSpec{Args: []ArgSpec{{Name: "子命令", Choices: names}}}
+	}
+	if c.Spec == nil {
+		return &CmdSpec{}
+	}
+	return c.Spec
+}
+
+// removeSubCmdsOf 递归移除 owner 注册的子命令
+func (c *Command) removeSubCmdsOf(owner bot.ModuleID) {
+	subCmds := make([]*Command, 0, len(c.SubCmds))
+	for _, sub := range c.SubCmds {
+		if sub.owner != owner {
+			sub.removeSubCmdsOf(owner)
+			subCmds = append(subCmds, sub)
+		}
+	}
+	c.SubCmds = subCmds
+}
+
+func (c *Command) findSubCmd(name string) *Command {
+	for _, sub := range c.SubCmds {
+		if sub.matches(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// resolve 沿着参数找到最深的子命令，返回该子命令及消耗的参数个数
+func (c *Command) resolve(args []string) (*Command, int) {
+	cmd, depth := c, 0
+	for depth < len(args) {
+		sub := cmd.findSubCmd(args[depth])
+		if sub == nil {
+			break
+		}
+		cmd, depth = sub, depth+1
+	}
+	return cmd, depth
+}
+
+// helpLines 生成命令的帮助信息，仅列出 visible 的子命令
+func (c *Command) helpLines(visible func(*Command) bool) []string {
+	lines := make([]string, 0)
+	if len(c.Description) > 0 {
+		lines = append(lines, c.Description)
+	}
+	if len(c.Aliases) > 0 {
+		lines = append(lines, "别名："+strings.Join(c.Aliases, ", "))
+	}
+	if c.Handler != nil {
+		lines = append(lines, c.spec().Usage(c.path()))
+		for _, f := range c.spec().Flags {
+			lines = append(lines, fmt.Sprintf("  --%s: %s", f.Name, f.Usage))
+		}
+	}
+
+	subs := make([]*Command, 0, len(c.SubCmds))
+	for _, sub := range c.SubCmds {
+		if visible(sub) {
+			subs = append(subs, sub)
+		}
+	}
+	if len(subs) > 0 {
+		if c.Handler == nil {
+			names := make([]string, 0, len(subs))
+			for _, sub := range subs {
+				names = append(names, sub.Name)
+			}
+			lines = append(lines, fmt.Sprintf(
+				"用法：%s%s <%s> ...", common.CmdPrefix(), c.path(), strings.Join(names, "|"),
+			))
+		}
+		lines = append(lines, "子命令：")
+		for _, sub := range subs {
+			lines = append(lines, fmt.Sprintf("  %s - %s", sub.displayName(), sub.Description))
+		}
+	}
+
+	if len(c.Examples) > 0 {
+		lines = append(lines, "示例：")
+		for _, e := range c.Examples {
+			lines = append(lines, fmt.Sprintf("  %s%s", common.CmdPrefix(), e))
+		}
+	}
+	return lines
+}
+
+// sortedCmds 按名称排序的命令列表
+func sortedCmds(cmdMap map[string]*Command) []*Command {
+	rst := make([]*Command, 0, len(cmdMap))
+	for _, cmd := range cmdMap {
+		rst = append(rst, cmd)
+	}
+	sort.Slice(rst, func(i, j int) bool {
+		return rst[i].Name < rst[j].Name
+	})
+	return rst
+}
@@ -0,0 +1,131 @@
+package shell
+
+import (
+	"fmt"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+)
+
+const helpCmdName = "help"
+
+// builtinCmds 内置的命令树
+// 其他模块的命令由其自行注册，如 "ls bili" 与 "set chatbot"
+func builtinCmds() []*Command {
+	return []*Command{
+		{
+			Name:        helpCmdName,
+			Aliases:     []string{"帮助"},
+			Description: "显示命令列表或命令的详细说明",
+			Examples:    []string{"help", "help diary", "help diary init", "help --page=2"},
+			Spec: &CmdSpec{
+				Args:  []ArgSpec{{Name: "命令", Optional: true, Variadic: true}},
+				Flags: []FlagSpec{{Name: "page", Type: ArgInt, Usage: "页码"}},
+			},
+			Handler: handleHelp,
+		},
+		{
+			Name:        "ping",
+			Description: "检查 Bot 是否在线",
+			Handler:     handlePing,
+		},
+		{
+			Name:         "persecute",
+			Aliases:      []string{"迫害"},
+			Description:  "迫害群友",
+			Examples:     []string{`persecute "某 群友"`},
+			RequiredRole: RoleAdmin,
+			Spec:         &CmdSpec{Args: []ArgSpec{{Name: "对象"}}},
+			Handler:      handlePersecute,
+		},
+		{
+			Name:        "ls",
+			Description: "查询信息",
+			SubCmds: []*Command{
+				{
+					Name:         "sender",
+					Description:  "显示消息发送统计",
+					RequiredRole: RoleSuperAdmin,
+					Handler:      handleLsSender,
+				},
+			},
+		},
+		{
+			Name:         "set",
+			Description:  "设置参数",
+			RequiredRole: RoleAdmin,
+		},
+		{
+			Name:         "module",
+			Description:  "管理模块",
+			RequiredRole: RoleSuperAdmin,
+			SubCmds: []*Command{
+				{Name: "ls", Description: "显示模块列表及运行状态", Handler: handleModuleLs},
+				{
+					Name:        "enable",
+					Description: "启用模块",
+					Spec:        moduleNameSpec,
+					Handler:     moduleOpHandler(bot.EnableModule),
+				},
+				{
+					Name:        "disable",
+					Description: "停用模块",
+					Spec:        moduleNameSpec,
+					Handler:     moduleOpHandler(disableModule),
+				},
+				{
+					Name:        "reload",
+					Description: "重新读取配置并重启模块",
+					Examples:    []string{"module reload bili"},
+					Spec:        moduleNameSpec,
+					Handler:     moduleOpHandler(bot.ReloadModule),
+				},
+			},
+		},
+		{
+			Name:         "perm",
+			Description:  "管理本群的角色",
+			RequiredRole: RoleAdmin,
+			SubCmds: []*Command{
+				{Name: "ls", Description: "显示本群授予的角色", Handler: handlePermLs},
+				{
+					Name:        "grant",
+					Description: "授予角色",
+					Examples:    []string{"perm grant 123456789 admin"},
+					Spec: &CmdSpec{Args: []ArgSpec{
+						{Name: "QQ号", Type: ArgInt},
+						{Name: "角色", Choices: []string{"owner", "admin", "member", "banned"}},
+					}},
+					Handler: handlePermGrant,
+				},
+				{
+					Name:        "revoke",
+					Description: "撤销授予的角色",
+					Spec:        &CmdSpec{Args: []ArgSpec{{Name: "QQ号", Type: ArgInt}}},
+					Handler:     handlePermRevoke,
+				},
+			},
+		},
+		{
+			Name:         "audit",
+			Description:  "查询命令调用记录",
+			Examples:     []string{"audit", "audit 123456789", `audit * "set chatbot" 7d`, "audit * * 2024-01-01 --json"},
+			RequiredRole: RoleAdmin,
+			Spec: &CmdSpec{
+				Args: []ArgSpec{
+					{Name: "用户", Optional: true},
+					{Name: "命令", Optional: true},
+					{Name: "起始时间", Optional: true},
+				},
+				Flags: []FlagSpec{
+					{Name: "limit", Type: ArgInt, Usage: fmt.Sprintf("最多显示的记录数，默认 %d", auditDefaultLimit)},
+					{Name: "json", Type: ArgBool, Usage: "以 JSON lines 格式导出"},
+				},
+			},
+			Handler: handleAudit,
+		},
+	}
+}
+
+var moduleNameSpec = &CmdSpec{
+	Args: []ArgSpec{{Name: "模块名"}},
+}
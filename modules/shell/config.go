@@ -1,5 +1,62 @@
 package shell
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/common"
+)
+
 type Config struct {
-	AdminIdList []int64  `yaml:"admin_id_list"`
+	// AdminIdList 超级管理员，在所有群内均视为 owner
+	AdminIdList []int64 `yaml:"admin_id_list"`
+	// PermStorePath 按群授予角色的持久化文件
+	PermStorePath string `yaml:"perm_store_path"`
+	// CommandRoles 覆盖命令所需的角色，例如 { persecute: admin }
+	CommandRoles map[string]Role `yaml:"command_roles"`
+	// AuditLogPath 审计日志文件，以 JSON lines 格式记录每次命令调用，为空时不记录
+	AuditLogPath string `yaml:"audit_log_path"`
+	// CmdPrefixes 命令前缀，第一个前缀用于帮助信息中的展示
+	CmdPrefixes []string `yaml:"cmd_prefixes"`
+	// Aliases 命令别名，以别名为键，值为命令路径，可附带参数，例如 { 日记: diary, 签到: "diary apply 签到" }
+	Aliases map[string]string `yaml:"aliases"`
+	// MentionTrigger 是否允许在群聊中通过 @Bot 触发命令，此时可省略命令前缀
+	MentionTrigger bool `yaml:"mention_trigger"`
+	// Cooldowns 覆盖命令的冷却时间，例如 { dd: { user: 30s, group: 10s } }
+	Cooldowns map[string]Cooldown `yaml:"cooldowns"`
+	// MaxConcurrentHandlers 同时执行的命令数上限，超出时拒绝新的命令
+	MaxConcurrentHandlers int `yaml:"max_concurrent_handlers"`
+	// ThrottleNoticeInterval 每个群（或私聊用户）收到冷却与繁忙提示的最小间隔
+	ThrottleNoticeInterval time.Duration `yaml:"throttle_notice_interval"`
+}
+
+func (c *Config) SetDefaults() {
+	c.PermStorePath = "./shell_perm.json"
+	c.AuditLogPath = "./shell_audit.jsonl"
+	c.CmdPrefixes = []string{common.DefaultCmdPrefix}
+	c.MaxConcurrentHandlers = 16
+	c.ThrottleNoticeInterval = 30 * time.Second
+}
+
+func (c *Config) Validate() error {
+	for _, p := range c.CmdPrefixes {
+		if len(p) == 0 || strings.IndexFunc(p, unicode.IsSpace) >= 0 {
+			return fmt.Errorf("invalid cmd prefix %q", p)
+		}
+	}
+	for alias, target := range c.Aliases {
+		if !isValidCmdName(alias) {
+			return fmt.Errorf("invalid alias %q", alias)
+		}
+		if len(strings.Fields(target)) == 0 {
+			return fmt.Errorf("empty target of alias %s", alias)
+		}
+	}
+	if c.MaxConcurrentHandlers <= 0 {
+		return errors.New("max_concurrent_handlers must be positive")
+	}
+	return nil
 }
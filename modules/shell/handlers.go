@@ -1,183 +1,310 @@
 package shell
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/zhouziqunzzq/MiraiGo-DD/modules/bili"
-	suki "github.com/zhouziqunzzq/MiraiGo-DD/modules/daredemo_suki"
-	"github.com/zhouziqunzzq/MiraiGo-DD/modules/diary"
-	"github.com/zhouziqunzzq/MiraiGo-DD/modules/naive_chatbot"
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/common"
 	"strconv"
 	"strings"
+	"time"
 )
 import "github.com/Mrs4s/MiraiGo/message"
 
-const diaryHelpInfo = "用法：/diary [init|show|apply|events] [参数1] [参数2] ...\n" +
-	"init: 初始化用户日记\n" +
-	"show: 显示当前属性值\n" +
-	"apply: 记录事件\n" +
-	"events: 显示事件列表\n" +
-	"help: 显示帮助信息"
-
 func handlePing(ctx *CmdContext) {
 	sendTextRsp("pong", ctx)
 }
 
 func handlePersecute(ctx *CmdContext) {
-	if len(ctx.ParsedCmd.Args) != 1 {
-		sendTextRsp("请提供唯一的参数", ctx)
-	} else {
-		sendTextRsp("今天也在迫害"+ctx.ParsedCmd.Args[0]+"嘛", ctx)
+	sendTextRsp("今天也在迫害"+ctx.ParsedCmd.Arg(0)+"嘛", ctx)
+}
+
+func handleLsSender(ctx *CmdContext) {
+	st := bot.Instance.Sender().Stats()
+	sendTextRsp(fmt.Sprintf(
+		"消息发送统计：\n已发送：%d\n重试：%d\n失败：%d\n丢弃：%d\n排队中（高/中/低）：%d/%d/%d",
+		st.Sent, st.Retried, st.Failed, st.Dropped,
+		st.Queued[bot.PriorityHigh], st.Queued[bot.PriorityNormal], st.Queued[bot.PriorityLow],
+	), ctx)
+}
+
+func handleModuleLs(ctx *CmdContext) {
+	sb := strings.Builder{}
+	sb.WriteString("模块列表：")
+	for _, ms := range bot.ListModules() {
+		sb.WriteString(fmt.Sprintf("\n%s - ", ms.Info.ID))
+		if ms.Running {
+			sb.WriteString("运行中")
+		} else {
+			sb.WriteString("已停止")
+		}
+	}
+	sendTextRsp(sb.String(), ctx)
+}
+
+// moduleOpHandler 生成对模块进行操作的命令处理函数
+func moduleOpHandler(op func(string) error) func(*CmdContext) {
+	return func(ctx *CmdContext) {
+		if err := op(ctx.ParsedCmd.Arg(0)); err != nil {
+			sendTextRsp(fmt.Sprintf("操作失败：%v", err), ctx)
+		} else {
+			sendTextRsp("操作成功", ctx)
+		}
 	}
 }
 
-func handleDd(ctx *CmdContext) {
-	if originMsg, ok := ctx.OriginMsg.(*message.GroupMessage); ok {
-		suki.SendDdPic(ctx.Client, originMsg.GroupCode)
+// disableModule 停用模块，提供管理命令的 shell 自身不能被停用，否则无法再通过命令启用
+func disableModule(name string) error {
+	if name == ModuleName {
+		return fmt.Errorf("模块 %s 提供了管理命令，不能停用", name)
 	}
+	return bot.DisableModule(name)
 }
 
-func handleLs(ctx *CmdContext) {
-	if len(ctx.ParsedCmd.Args) == 0 {
-		sendTextRsp("参数错误", ctx)
+func handlePermLs(ctx *CmdContext) {
+	if !requireGroup(ctx) {
+		return
+	}
+	grants := instance.permStore.list(ctx.GroupId)
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("您的角色：%s", instance.roleOf(ctx.Client, ctx.GroupId, ctx.UserId)))
+	if len(grants) == 0 {
+		sb.WriteString("\n本群暂无授予的角色")
 	} else {
-		switch ctx.ParsedCmd.Args[0] {
-		case "bili":
-			if gMsg, ok := ctx.OriginMsg.(*message.GroupMessage); ok {
-				userInfoList := bili.GetSubscriptionByGroupId(gMsg.GroupCode)
-				if userInfoList == nil || len(userInfoList) == 0 {
-					sendTextRsp("暂无订阅的主播", ctx)
-				} else {
-					sb := strings.Builder{}
-					sb.WriteString("当前订阅的主播信息如下：\n")
-					for _, userInfo := range userInfoList {
-						if len(userInfo.Name) == 0 {
-							sb.WriteString(fmt.Sprintf("UID: %d", userInfo.Mid))
-						} else {
-							sb.WriteString(fmt.Sprintf("UID: %d - %s - ", userInfo.Mid, userInfo.Name))
-							if userInfo.LiveRoom.LiveStatus == bili.Streaming {
-								sb.WriteString("已开播")
-							} else {
-								sb.WriteString("未开播")
-							}
-						}
-						sb.WriteRune('\n')
-					}
-					sb.WriteString("（注：信息拉取存在延时，未显示主播昵称表明尚未拉取，请稍后重试）")
-					sendTextRsp(sb.String(), ctx)
-				}
-			} else {
-				sendTextRsp("暂时仅支持群内查询订阅主播信息", ctx)
-			}
-		case "chatbot":
-			if gMsg, ok := ctx.OriginMsg.(*message.GroupMessage); ok {
-				triggerProb, err := naive_chatbot.GetTriggerProb(gMsg.GroupCode)
-				if err != nil {
-					sendTextRsp("聊天机器人未启用", ctx)
-				} else {
-					rsp := "聊天机器人已启用\n"
-					rsp += fmt.Sprintf("触发概率：%f", triggerProb)
-					sendTextRsp(rsp, ctx)
-				}
-			} else {
-				sendTextRsp("暂时仅支持群内查询聊天机器人信息", ctx)
-			}
-		default:
-			sendTextRsp(fmt.Sprintf("对象%s暂不支持 ls 命令", ctx.ParsedCmd.Args[0]), ctx)
+		sb.WriteString("\n本群授予的角色如下：")
+		for _, g := range grants {
+			sb.WriteString(fmt.Sprintf("\n%d - %s", g.UserId, g.Role))
 		}
 	}
+	sendTextRsp(sb.String(), ctx)
 }
 
-func handleSet(ctx *CmdContext) {
-	if len(ctx.ParsedCmd.Args) == 0 {
-		sendTextRsp("参数错误", ctx)
+func handlePermGrant(ctx *CmdContext) {
+	if !requireGroup(ctx) {
+		return
+	}
+	gid := ctx.GroupId
+	callerRole := instance.roleOf(ctx.Client, gid, ctx.UserId)
+	target := ctx.ParsedCmd.IntArg(0)
+	role, _ := ParseRole(ctx.ParsedCmd.Arg(1))
+	// one can neither grant a role higher than their own, nor touch someone with a higher role
+	if role > callerRole || instance.roleOf(ctx.Client, gid, target) > callerRole {
+		sendTextRsp(unauthorizedRsp, ctx)
+		return
+	}
+	if err := instance.permStore.grant(gid, target, role); err != nil {
+		logger.WithError(err).Errorf("failed to grant role %s to %d in group %d", role, target, gid)
+		sendTextRsp("授权失败，未知错误", ctx)
+		return
+	}
+	sendTextRsp(fmt.Sprintf("已授予 %d 角色 %s", target, role), ctx)
+}
+
+func handlePermRevoke(ctx *CmdContext) {
+	if !requireGroup(ctx) {
+		return
+	}
+	gid := ctx.GroupId
+	target := ctx.ParsedCmd.IntArg(0)
+	if instance.roleOf(ctx.Client, gid, target) > instance.roleOf(ctx.Client, gid, ctx.UserId) {
+		sendTextRsp(unauthorizedRsp, ctx)
+		return
+	}
+	revoked, err := instance.permStore.revoke(gid, target)
+	switch {
+	case err != nil:
+		logger.WithError(err).Errorf("failed to revoke role of %d in group %d", target, gid)
+		sendTextRsp("撤销失败，未知错误", ctx)
+	case !revoked:
+		sendTextRsp(fmt.Sprintf("%d 在本群没有被授予的角色", target), ctx)
+	default:
+		sendTextRsp(fmt.Sprintf("已撤销 %d 被授予的角色", target), ctx)
+	}
+}
+
+const (
+	// auditWildcard 查询审计日志时表示不限制的参数
+	auditWildcard     = "*"
+	auditDefaultLimit = 10
+	auditMaxLimit     = 50
+)
+
+// handleAudit 查询审计日志
+// 群内（或通过 --group 指定群时）只能查询该群的记录，超级管理员私聊时可查询所有记录
+func handleAudit(ctx *CmdContext) {
+	filter := &auditFilter{GroupId: ctx.GroupId}
+	if u := ctx.ParsedCmd.Arg(0); len(u) > 0 && u != auditWildcard {
+		uid, err := strconv.ParseInt(u, 10, 64)
+		if err != nil {
+			sendTextRsp(fmt.Sprintf("<用户> 应为 QQ 号或 %s", auditWildcard), ctx)
+			return
+		}
+		filter.UserId = uid
+	}
+	if c := ctx.ParsedCmd.Arg(1); c != auditWildcard {
+		filter.Cmd = strings.Join(strings.Fields(c), " ")
+	}
+	if s := ctx.ParsedCmd.Arg(2); len(s) > 0 && s != auditWildcard {
+		since, err := parseSince(s, time.Now())
+		if err != nil {
+			sendTextRsp(err.Error(), ctx)
+			return
+		}
+		filter.Since = since
+	}
+	// an unparsable --limit is 0, i.e. the default
+	limit, _ := ctx.ParsedCmd.IntFlag("limit")
+
+	recs, err := instance.auditLog.query(filter, auditLimit(limit))
+	if err != nil {
+		logger.WithError(err).Error("failed to query audit log")
+		sendTextRsp("查询失败，未知错误", ctx)
+		return
+	}
+	if len(recs) == 0 {
+		sendTextRsp("没有符合条件的记录", ctx)
+		return
+	}
+
+	lines := make([]string, 0, len(recs)+1)
+	if ctx.ParsedCmd.BoolFlag("json") {
+		for _, rec := range recs {
+			b, _ := json.Marshal(rec)
+			lines = append(lines, string(b))
+		}
 	} else {
-		switch ctx.ParsedCmd.Args[0] {
-		case "chatbot":
-			if gMsg, ok := ctx.OriginMsg.(*message.GroupMessage); ok {
-				// set chatbot <key> <value>
-				if len(ctx.ParsedCmd.Args) < 3 {
-					sendTextRsp("参数错误！命令格式：set chatbot <key> <value>", ctx)
-					return
-				}
-				switch ctx.ParsedCmd.Args[1] {
-				case "trigger_prob":
-					newProb, err := strconv.ParseFloat(ctx.ParsedCmd.Args[2], 32)
-					if err != nil {
-						sendTextRsp(fmt.Sprintf("无效的 value (%s): %v", ctx.ParsedCmd.Args[2], err), ctx)
-						return
-					}
-					err = naive_chatbot.SetTriggerProb(gMsg.GroupCode, float32(newProb))
-					if err != nil {
-						sendTextRsp(fmt.Sprintf("无效的 value (%s): %v", ctx.ParsedCmd.Args[2], err), ctx)
-						return
-					}
-					sendTextRsp("参数更新成功", ctx)
-				default:
-					sendTextRsp(fmt.Sprintf("无效的 key (%s)", ctx.ParsedCmd.Args[1]), ctx)
-				}
-			} else {
-				sendTextRsp("暂时仅支持群内设置聊天机器人参数", ctx)
+		lines = append(lines, fmt.Sprintf("最近 %d 条记录：", len(recs)))
+		for _, rec := range recs {
+			line := fmt.Sprintf("%s %d", rec.Time.Format("01-02 15:04:05"), rec.UserId)
+			if filter.GroupId == 0 && rec.GroupId != 0 {
+				line += fmt.Sprintf("@%d", rec.GroupId)
 			}
-		default:
-			sendTextRsp(fmt.Sprintf("对象%s暂不支持 set 命令", ctx.ParsedCmd.Args[0]), ctx)
+			lines = append(lines, fmt.Sprintf("%s：%s → %s（%dms）", line, rec.Raw, rec.Outcome, rec.LatencyMs))
 		}
 	}
+	sendTextRsp(strings.Join(lines, "\n"), ctx)
 }
 
-func handleDiary(ctx *CmdContext) {
-	gMsg, ok := ctx.OriginMsg.(*message.GroupMessage)
+// auditLimit 查询的记录数，未指定时为默认值，且不超过 auditMaxLimit
+func auditLimit(limit int64) int {
+	if limit <= 0 {
+		return auditDefaultLimit
+	} else if limit > auditMaxLimit {
+		return auditMaxLimit
+	}
+	return int(limit)
+}
+
+// helpPageSize 帮助信息每页的行数
+const helpPageSize = 15
+
+func handleHelp(ctx *CmdContext) {
+	role := instance.roleOf(ctx.Client, ctx.GroupId, ctx.UserId)
+	visible := func(cmd *Command) bool {
+		return instance.cmdVisibleTo(cmd, role, ctx.Source)
+	}
+
+	args := ctx.ParsedCmd.Args
+	lines, ok := helpLinesOf(args, visible)
+	if len(args) == 1 && !ok {
+		// "/help 签到" shows the help of the cmd that the alias stands for,
+		// ignoring the args it may carry, e.g. "diary apply 签到"
+		if path, isAlias := instance.aliasOf(args[0]); isAlias {
+			for i := len(path); i > 0 && !ok; i-- {
+				lines, ok = helpLinesOf(path[:i], visible)
+			}
+		}
+	}
 	if !ok {
-		sendTextRsp("暂时仅支持群内设置聊天机器人参数", ctx)
+		sendTextRsp(fmt.Sprintf("没有找到命令 %s，或您的权限不足", strings.Join(args, " ")), ctx)
 		return
 	}
-	gid, uid := gMsg.GroupCode, gMsg.Sender.Uin
 
-	if len(ctx.ParsedCmd.Args) == 0 {
-		sendTextRsp("参数错误", ctx)
-	} else {
-		switch ctx.ParsedCmd.Args[0] {
-		case "init":
-			if len(ctx.ParsedCmd.Args) != 2 {
-				sendTextRsp("参数错误，用法：/diary init <寿命>", ctx)
-			} else {
-				ttl, err := strconv.Atoi(ctx.ParsedCmd.Args[1])
-				if err != nil {
-					sendTextRsp("参数错误，<寿命>不是整数，用法：/diary init <寿命>", ctx)
-				} else if err = diary.InitDiary(gid, uid, int64(ttl)); err != nil {
-					sendTextRsp("初始化失败，未知错误", ctx)
-				} else {
-					sendTextRsp("初始化成功", ctx)
-				}
-			}
-		case "show":
-			sendTextRsp(diary.QueryDiary(gid, uid), ctx)
-		case "apply":
-			if len(ctx.ParsedCmd.Args) != 2 {
-				sendTextRsp("参数错误，用法：/diary apply <事件>", ctx)
-			} else {
-				sendTextRsp(diary.ApplyEventToDiary(gid, uid, ctx.ParsedCmd.Args[1]), ctx)
+	page, ok := ctx.ParsedCmd.IntFlag("page")
+	if !ok {
+		page = 1
+	}
+	sendTextRsp(paginate(lines, int(page), strings.Join(append([]string{helpCmdName}, args...), " ")), ctx)
+}
+
+// helpLinesOf 生成命令 path 的帮助信息，path 为空时生成命令列表
+// 命令不存在或不可见时返回 false
+func helpLinesOf(path []string, visible func(*Command) bool) ([]string, bool) {
+	registry.rwMu.RLock()
+	defer registry.rwMu.RUnlock()
+
+	if len(path) == 0 {
+		lines := []string{"可用命令："}
+		for _, cmd := range sortedCmds(registry.cmds) {
+			if visible(cmd) {
+				lines = append(lines, fmt.Sprintf("  %s - %s", cmd.displayName(), cmd.Description))
 			}
-		case "events":
-			sendTextRsp(diary.ListEvents(), ctx)
-		case "help":
-			sendTextRsp(diaryHelpInfo, ctx)
-		default:
-			sendTextRsp(fmt.Sprintf("未知参数，%s", diaryHelpInfo), ctx)
 		}
+		return append(lines, fmt.Sprintf("使用 %s%s <命令> 查看命令的详细说明", common.CmdPrefix(), helpCmdName)), true
+	}
+
+	root, ok := registry.get(path[0])
+	if !ok {
+		return nil, false
+	}
+	cmd, depth := root.resolve(path[1:])
+	if depth != len(path)-1 || !visible(cmd) {
+		return nil, false
 	}
+	return cmd.helpLines(visible), true
+}
+
+// paginate 将 lines 分页，返回第 page 页的内容
+// cmdLine 为查看下一页时使用的命令
+func paginate(lines []string, page int, cmdLine string) string {
+	totalPages := (len(lines) + helpPageSize - 1) / helpPageSize
+	if totalPages <= 1 {
+		return strings.Join(lines, "\n")
+	}
+	if page < 1 {
+		page = 1
+	} else if page > totalPages {
+		page = totalPages
+	}
+
+	start := (page - 1) * helpPageSize
+	end := start + helpPageSize
+	if end > len(lines) {
+		end = len(lines)
+	}
+	rst := strings.Join(lines[start:end], "\n")
+	if page < totalPages {
+		rst += fmt.Sprintf("\n（第 %d/%d 页，使用 %s%s --page=%d 查看下一页）", page, totalPages, common.CmdPrefix(), cmdLine, page+1)
+	} else {
+		rst += fmt.Sprintf("\n（第 %d/%d 页）", page, totalPages)
+	}
+	return rst
+}
+
+// requireGroup 检查命令是否作用于某个群，私聊中未通过 --group 指定时提示用户
+func requireGroup(ctx *CmdContext) bool {
+	if ctx.GroupId == 0 {
+		sendTextRsp("请在群内使用，或通过 --group <群号> 指定群", ctx)
+		return false
+	}
+	return true
 }
 
 func sendTextRsp(rsp string, ctx *CmdContext) {
 	rspMsg := message.NewSendingMessage()
 	rspMsg.Append(message.NewText(rsp))
+	sendRsp(rspMsg, ctx)
+}
 
-	qqClient := ctx.Client
+func sendRsp(rspMsg *message.SendingMessage, ctx *CmdContext) {
 	switch originMsg := ctx.OriginMsg.(type) {
 	case *message.PrivateMessage:
-		qqClient.SendPrivateMessage(originMsg.Sender.Uin, rspMsg)
+		bot.SendPrivateMessage(originMsg.Sender.Uin, rspMsg, ctx.Priority)
 	case *message.GroupMessage:
-		qqClient.SendGroupMessage(originMsg.GroupCode, rspMsg)
+		bot.SendGroupMessage(originMsg.GroupCode, rspMsg, ctx.Priority)
+	case *message.TempMessage:
+		bot.SendGroupTempMessage(originMsg.GroupCode, originMsg.Sender.Uin, rspMsg, ctx.Priority)
 	default:
-		logger.Warnf("unhandled origin msg type for outgoing msg: %s", rsp)
+		logger.Warnf("unhandled origin msg type %T for outgoing msg", ctx.OriginMsg)
 	}
 }
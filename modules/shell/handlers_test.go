@@ -0,0 +1,125 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// registerTestCmd 注册测试用的命令，测试结束后注销
+func registerTestCmd(t *testing.T, cmd *Command) {
+	t.Helper()
+	const owner = "shell_test"
+	if err := registry.register(owner, "", cmd); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { registry.unregister(owner) })
+}
+
+func TestHelpLinesOf(t *testing.T) {
+	noop := func(*CmdContext) {}
+	registerTestCmd(t, &Command{
+		Name:        "diarytest",
+		Aliases:     []string{"日记测试"},
+		Description: "日记",
+		SubCmds: []*Command{
+			{Name: "apply", Aliases: []string{"签到"}, Description: "签到", Handler: noop},
+			{Name: "reset", Description: "重置", RequiredRole: RoleAdmin, Handler: noop},
+		},
+	})
+	// only reset is hidden, as a member can't run it
+	visible := func(cmd *Command) bool {
+		return cmd.RequiredRole <= RoleMember
+	}
+
+	tests := []struct {
+		name    string
+		path    []string
+		wantOk  bool
+		want    []string
+		notWant []string
+	}{
+		{name: "cmd list", path: nil, wantOk: true,
+			want: []string{"diarytest（日记测试） - 日记"}},
+		{name: "hidden sub cmd not listed", path: []string{"diarytest"}, wantOk: true,
+			want: []string{"用法：/diarytest <apply> ...", "apply（签到） - 签到"}, notWant: []string{"reset"}},
+		{name: "hidden sub cmd", path: []string{"diarytest", "reset"}, wantOk: false},
+		{name: "cmd alias", path: []string{"日记测试"}, wantOk: true,
+			want: []string{"别名：日记测试", "apply（签到）"}},
+		{name: "sub cmd alias", path: []string{"日记测试", "签到"}, wantOk: true,
+			want: []string{"别名：签到", "用法：/diarytest apply"}},
+		{name: "unknown sub cmd", path: []string{"diarytest", "foo"}, wantOk: false},
+		{name: "unknown cmd", path: []string{"nosuchcmd"}, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, ok := helpLinesOf(tt.path, visible)
+			if ok != tt.wantOk {
+				t.Fatalf("helpLinesOf(%q) ok = %v, want %v", tt.path, ok, tt.wantOk)
+			}
+			text := strings.Join(lines, "\n")
+			for _, s := range tt.want {
+				if !strings.Contains(text, s) {
+					t.Errorf("helpLinesOf(%q) = %q, want it to contain %q", tt.path, text, s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(text, s) {
+					t.Errorf("helpLinesOf(%q) = %q, want it not to contain %q", tt.path, text, s)
+				}
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	linesOf := func(n int) []string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = fmt.Sprintf("line%d", i+1)
+		}
+		return lines
+	}
+
+	tests := []struct {
+		name      string
+		n         int
+		page      int
+		wantFirst string
+		wantLast  string
+		wantLines int
+		footer    string
+	}{
+		{name: "one full page", n: helpPageSize, page: 1,
+			wantFirst: "line1", wantLast: fmt.Sprintf("line%d", helpPageSize), wantLines: helpPageSize},
+		{name: "first of two pages", n: helpPageSize + 1, page: 1,
+			wantFirst: "line1", wantLines: helpPageSize + 1, footer: "（第 1/2 页，使用 /help diary --page=2 查看下一页）"},
+		{name: "last page", n: helpPageSize + 1, page: 2,
+			wantFirst: fmt.Sprintf("line%d", helpPageSize+1), wantLines: 2, footer: "（第 2/2 页）"},
+		{name: "page beyond the last", n: helpPageSize + 1, page: 9,
+			wantFirst: fmt.Sprintf("line%d", helpPageSize+1), wantLines: 2, footer: "（第 2/2 页）"},
+		{name: "page before the first", n: helpPageSize*2 + 1, page: 0,
+			wantFirst: "line1", wantLines: helpPageSize + 1, footer: "（第 1/3 页，使用 /help diary --page=2 查看下一页）"},
+		{name: "full last page", n: helpPageSize * 2, page: 2,
+			wantFirst: fmt.Sprintf("line%d", helpPageSize+1), wantLines: helpPageSize + 1, footer: "（第 2/2 页）"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rst := strings.Split(paginate(linesOf(tt.n), tt.page, "help diary"), "\n")
+			if len(rst) != tt.wantLines {
+				t.Fatalf("expected %d lines, got %d: %q", tt.wantLines, len(rst), rst)
+			}
+			if rst[0] != tt.wantFirst {
+				t.Fatalf("expected the first line %q, got %q", tt.wantFirst, rst[0])
+			}
+			last := rst[len(rst)-1]
+			if len(tt.footer) > 0 {
+				if last != tt.footer {
+					t.Fatalf("expected the footer %q, got %q", tt.footer, last)
+				}
+			} else if last != tt.wantLast {
+				t.Fatalf("expected the last line %q, got %q", tt.wantLast, last)
+			}
+		})
+	}
+}
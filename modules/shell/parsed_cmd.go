@@ -1,20 +1,35 @@
 package shell
 
-import "errors"
-import "strings"
-import "github.com/zhouziqunzzq/MiraiGo-DD/modules/common"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/common"
+)
 
 type ParsedCmd struct {
-	Name string
-	Args []string
-	//KwArgs map[string]string
+	Name   string
+	Args   []string
+	KwArgs map[string]string
+	// tokens are the raw tokens after cmd name, kept to rebind flags with a spec
+	tokens []cmdToken
+}
+
+type cmdToken struct {
+	text string
+	// quoted tokens are always positional, even if they look like a flag
+	quoted bool
 }
 
 func NewParsedCmd(name string) *ParsedCmd {
 	return &ParsedCmd{
-		Name: name,
-		Args: make([]string, 0),
-		//KwArgs: make(map[string]string),
+		Name:   name,
+		Args:   make([]string, 0),
+		KwArgs: make(map[string]string),
 	}
 }
 
@@ -22,43 +37,201 @@ func (pc *ParsedCmd) AppendArg(arg string) {
 	pc.Args = append(pc.Args, arg)
 }
 
-//func (pc *ParsedCmd) AppendKwArg(kw, arg string) error {
-//	if _, ok := pc.KwArgs[kw]; ok {
-//		return errors.New("Keyword " + kw + " already exist")
-//	}
-//	pc.KwArgs[kw] = arg
-//	return nil
-//}
+func (pc *ParsedCmd) AppendKwArg(kw, arg string) error {
+	if _, ok := pc.KwArgs[kw]; ok {
+		return errors.New("Keyword " + kw + " already exist")
+	}
+	pc.KwArgs[kw] = arg
+	return nil
+}
+
+// expand replaces the cmd name with path, e.g. an alias "签到" with "diary apply 签到",
+// and rebinds the args with global flags only
+func (pc *ParsedCmd) expand(path []string) error {
+	tokens := make([]cmdToken, 0, len(path)-1+len(pc.tokens))
+	for _, p := range path[1:] {
+		// path elements are always positional
+		tokens = append(tokens, cmdToken{text: p, quoted: true})
+	}
+	pc.Name = path[0]
+	pc.tokens = append(tokens, pc.tokens...)
+	return pc.bind((&CmdSpec{}).valueFlags())
+}
+
+// Arg returns the i-th positional arg, or an empty string if absent
+func (pc *ParsedCmd) Arg(i int) string {
+	if i < 0 || i >= len(pc.Args) {
+		return ""
+	}
+	return pc.Args[i]
+}
+
+// IntArg returns the i-th positional arg as an integer.
+// Args validated by a CmdSpec are guaranteed to be parsable.
+func (pc *ParsedCmd) IntArg(i int) int64 {
+	v, _ := strconv.ParseInt(pc.Arg(i), 10, 64)
+	return v
+}
+
+// FloatArg returns the i-th positional arg as a float.
+// Args validated by a CmdSpec are guaranteed to be parsable.
+func (pc *ParsedCmd) FloatArg(i int) float64 {
+	v, _ := strconv.ParseFloat(pc.Arg(i), 64)
+	return v
+}
+
+// Flag returns the value of flag --name, if specified
+func (pc *ParsedCmd) Flag(name string) (string, bool) {
+	v, ok := pc.KwArgs[name]
+	return v, ok
+}
+
+// IntFlag returns the value of flag --name as an integer, if specified
+func (pc *ParsedCmd) IntFlag(name string) (int64, bool) {
+	v, ok := pc.KwArgs[name]
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	return i, err == nil
+}
+
+// BoolFlag reports whether flag --name is specified and true
+func (pc *ParsedCmd) BoolFlag(name string) bool {
+	b, _ := strconv.ParseBool(pc.KwArgs[name])
+	return b
+}
+
+// bind splits tokens into positional args and flags.
+// Flags are either `--key=value`, or `--key value` if key is in valueFlags,
+// otherwise a bare `--key` is a boolean flag set to "true".
+// A bare `--` ends flag parsing, and all following tokens are positional.
+func (pc *ParsedCmd) bind(valueFlags map[string]bool) error {
+	pc.Args = make([]string, 0, len(pc.tokens))
+	pc.KwArgs = make(map[string]string)
+
+	endOfFlags := false
+	for i := 0; i < len(pc.tokens); i++ {
+		t := pc.tokens[i]
+		if endOfFlags || t.quoted || !strings.HasPrefix(t.text, "--") {
+			pc.AppendArg(t.text)
+			continue
+		}
+		if t.text == "--" {
+			endOfFlags = true
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(t.text[2:], "=")
+		if len(key) == 0 {
+			return fmt.Errorf("invalid flag %s", t.text)
+		}
+		if !hasValue {
+			if valueFlags[key] {
+				if i+1 < len(pc.tokens) {
+					i++
+					value = pc.tokens[i].text
+				}
+			} else {
+				value = "true"
+			}
+		}
+		if err := pc.AppendKwArg(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tokenize splits s by whitespaces, honoring quotes in quotePairs and backslash escapes
+func tokenize(s string) ([]cmdToken, error) {
+	tokens := make([]cmdToken, 0)
+	sb := strings.Builder{}
+	inToken, quoted, escaped := false, false, false
+	var closingQuote rune
+
+	flush := func() {
+		if inToken {
+			tokens = append(tokens, cmdToken{text: sb.String(), quoted: quoted})
+		}
+		sb.Reset()
+		inToken, quoted = false, false
+	}
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			sb.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inToken = true, true
+		case closingQuote != 0:
+			if r == closingQuote {
+				closingQuote = 0
+			} else {
+				sb.WriteRune(r)
+			}
+		case quotePairs[r] != 0:
+			closingQuote = quotePairs[r]
+			inToken, quoted = true, true
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			sb.WriteRune(r)
+			inToken = true
+		}
+	}
+
+	if escaped {
+		return nil, errors.New("unfinished escape at the end of command")
+	}
+	if closingQuote != 0 {
+		return nil, fmt.Errorf("missing closing quote %c", closingQuote)
+	}
+	flush()
+	return tokens, nil
+}
+
+var quotePairs = map[rune]rune{
+	'"':  '"',
+	'\'': '\'',
+	'“':  '”',
+	'‘':  '’',
+}
 
-// try parsing cmd from a string
+// try parsing cmd from a string starting with a cmd prefix, the prefix can be
+// omitted if prefixOptional, e.g. right after @-mentioning the bot
 // return
 // 	- nil if s is not a cmd, or *ParsedCmd for a successful parsing
-// 	- an error indicating the error in the parsing process, if any
-func parseCmd(s string) (*ParsedCmd, error) {
+// 	- an error indicating the error in the parsing process, if any. The returned
+// 	  *ParsedCmd still carries the cmd name in this case, if it can be told.
+func parseCmd(s string, prefixOptional bool) (*ParsedCmd, error) {
 	s = strings.TrimSpace(s)
-	if len(s) == 0 || s[0] != common.CmdIdentifier {
+	s, hasPrefix := common.TrimCmdPrefix(s)
+	if !hasPrefix && !prefixOptional {
 		return nil, nil
 	}
 
-	s = s[1:]
-	ss := strings.Split(s, " ")
-	if len(ss) == 0 {
-		return nil, errors.New("command name not specified")
+	// a space right after the prefix is not a cmd, e.g. "/ 2"
+	if r, _ := utf8.DecodeRuneInString(s); len(s) == 0 || unicode.IsSpace(r) {
+		return nil, nil
 	}
 
 	// parse cmd name
-	pc := NewParsedCmd(ss[0])
-	ss = ss[1:]
-
-	// parse args
-	for _, rawStr := range ss {
-		// skip spaces
-		rawStr = strings.TrimSpace(rawStr)
-		if len(rawStr) == 0 {
-			continue
-		}
+	name := strings.FieldsFunc(s, unicode.IsSpace)[0]
+	tokens, err := tokenize(s)
+	if err != nil {
+		return NewParsedCmd(name), err
+	}
+	if tokens[0].quoted {
+		return NewParsedCmd(name), errors.New("command name should not be quoted")
+	}
+	pc := NewParsedCmd(tokens[0].text)
+	pc.tokens = tokens[1:]
 
-		pc.AppendArg(rawStr)
+	// parse args with global flags only, until the spec of the cmd is known
+	if err = pc.bind((&CmdSpec{}).valueFlags()); err != nil {
+		return pc, err
 	}
 
 	return pc, nil
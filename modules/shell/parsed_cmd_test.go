@@ -0,0 +1,146 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []cmdToken
+		wantErr bool
+	}{
+		{"spaces", "  a  b\tc ", []cmdToken{{"a", false}, {"b", false}, {"c", false}}, false},
+		{"double quotes", `a "b c" d`, []cmdToken{{"a", false}, {"b c", true}, {"d", false}}, false},
+		{"single quotes", `'b "c"'`, []cmdToken{{`b "c"`, true}}, false},
+		{"chinese quotes", "“你 好” ‘再见’", []cmdToken{{"你 好", true}, {"再见", true}}, false},
+		{"empty quotes", `a ""`, []cmdToken{{"a", false}, {"", true}}, false},
+		{"quote inside token", `a"b c"d`, []cmdToken{{"ab cd", true}}, false},
+		{"escaped space", `a\ b c`, []cmdToken{{"a b", false}, {"c", false}}, false},
+		{"escaped quote", `\"a`, []cmdToken{{`"a`, false}}, false},
+		{"escaped backslash", `a\\b`, []cmdToken{{`a\b`, false}}, false},
+		{"flag", "--group=123", []cmdToken{{"--group=123", false}}, false},
+		{"quoted flag", `"--group=123"`, []cmdToken{{"--group=123", true}}, false},
+		{"unfinished escape", `a\`, nil, true},
+		{"missing closing quote", `a "b`, nil, true},
+		{"missing chinese closing quote", "“a", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tokenize(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tokenize(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("tokenize(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCmd(t *testing.T) {
+	tests := []struct {
+		name           string
+		s              string
+		prefixOptional bool
+		wantNil        bool
+		wantName       string
+		wantArgs       []string
+		wantKwArgs     map[string]string
+		wantErr        bool
+	}{
+		{name: "not a cmd", s: "hello", wantNil: true},
+		{name: "space after prefix", s: "/ 2", wantNil: true},
+		{name: "prefix only", s: "/", wantNil: true},
+		{name: "prefix optional", s: "ping", prefixOptional: true, wantName: "ping",
+			wantArgs: []string{}, wantKwArgs: map[string]string{}},
+		{name: "args", s: `/echo a "b c"`, wantName: "echo",
+			wantArgs: []string{"a", "b c"}, wantKwArgs: map[string]string{}},
+		{name: "flag with equal sign", s: "/echo --group=123 a", wantName: "echo",
+			wantArgs: []string{"a"}, wantKwArgs: map[string]string{"group": "123"}},
+		{name: "global value flag", s: "/echo --group 123 a", wantName: "echo",
+			wantArgs: []string{"a"}, wantKwArgs: map[string]string{"group": "123"}},
+		{name: "bool flag", s: "/echo --all a", wantName: "echo",
+			wantArgs: []string{"a"}, wantKwArgs: map[string]string{"all": "true"}},
+		{name: "empty value", s: "/echo --note=", wantName: "echo",
+			wantArgs: []string{}, wantKwArgs: map[string]string{"note": ""}},
+		{name: "end of flags", s: "/echo -- --all", wantName: "echo",
+			wantArgs: []string{"--all"}, wantKwArgs: map[string]string{}},
+		{name: "quoted flag is positional", s: `/echo "--all"`, wantName: "echo",
+			wantArgs: []string{"--all"}, wantKwArgs: map[string]string{}},
+		{name: "duplicated flag", s: "/echo --a=1 --a=2", wantName: "echo", wantErr: true},
+		{name: "empty flag name", s: "/echo --=1", wantName: "echo", wantErr: true},
+		{name: "quoted cmd name", s: `/"echo" a`, wantName: `"echo"`, wantErr: true},
+		{name: "missing closing quote", s: `/echo "a`, wantName: "echo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc, err := parseCmd(tt.s, tt.prefixOptional)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCmd(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if tt.wantNil {
+				if pc != nil {
+					t.Fatalf("parseCmd(%q) = %+v, want nil", tt.s, pc)
+				}
+				return
+			}
+			if pc == nil {
+				t.Fatalf("parseCmd(%q) = nil", tt.s)
+			}
+			if pc.Name != tt.wantName {
+				t.Fatalf("parseCmd(%q).Name = %q, want %q", tt.s, pc.Name, tt.wantName)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(pc.Args, tt.wantArgs) {
+				t.Fatalf("parseCmd(%q).Args = %q, want %q", tt.s, pc.Args, tt.wantArgs)
+			}
+			if !reflect.DeepEqual(pc.KwArgs, tt.wantKwArgs) {
+				t.Fatalf("parseCmd(%q).KwArgs = %v, want %v", tt.s, pc.KwArgs, tt.wantKwArgs)
+			}
+		})
+	}
+}
+
+func TestNumberArgs(t *testing.T) {
+	pc := NewParsedCmd("calc")
+	pc.Args = []string{"42", "-7", "3.5", "abc"}
+
+	intTests := []struct {
+		i    int
+		want int64
+	}{
+		{0, 42},
+		{1, -7},
+		{2, 0}, // not an integer
+		{3, 0},
+		{4, 0}, // out of range
+		{-1, 0},
+	}
+	for _, tt := range intTests {
+		if got := pc.IntArg(tt.i); got != tt.want {
+			t.Errorf("IntArg(%d) = %d, want %d", tt.i, got, tt.want)
+		}
+	}
+
+	floatTests := []struct {
+		i    int
+		want float64
+	}{
+		{0, 42},
+		{1, -7},
+		{2, 3.5},
+		{3, 0},
+		{4, 0},
+		{-1, 0},
+	}
+	for _, tt := range floatTests {
+		if got := pc.FloatArg(tt.i); got != tt.want {
+			t.Errorf("FloatArg(%d) = %v, want %v", tt.i, got, tt.want)
+		}
+	}
+}
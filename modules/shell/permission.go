@@ -0,0 +1,241 @@
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/Mrs4s/MiraiGo/client"
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
+)
+
+// Role 用户在群内的角色
+// 角色越高，可执行的命令越多
+type Role int
+
+const (
+	// roleInherit 未指定角色，命令所需的角色继承自父命令
+	roleInherit Role = iota
+	RoleBanned
+	RoleMember
+	RoleAdmin
+	RoleOwner
+	// RoleSuperAdmin admin_id_list 中的超级管理员，在所有群内有效
+	// 用于跨群生效的命令（如 module），不能通过按群授权获得
+	RoleSuperAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleBanned:     "banned",
+	RoleMember:     "member",
+	RoleAdmin:      "admin",
+	RoleOwner:      "owner",
+	RoleSuperAdmin: "superadmin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole 将角色名解析为 Role
+func ParseRole(s string) (Role, error) {
+	for r, name := range roleNames {
+		if name == s {
+			return r, nil
+		}
+	}
+	return RoleMember, fmt.Errorf("invalid role %s", s)
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	parsed, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// grantable 角色是否可按群授予
+func (r Role) grantable() bool {
+	return r >= RoleBanned && r <= RoleOwner
+}
+
+// permStore 持久化的按群授予的角色
+// 授予的角色优先于 QQ 群内的身份
+type permStore struct {
+	path   string
+	grants map[int64]map[int64]Role // group ID -> user ID -> Role, rwMu protected
+	rwMu   sync.RWMutex
+}
+
+func newPermStore(path string) *permStore {
+	return &permStore{
+		path:   path,
+		grants: make(map[int64]map[int64]Role),
+	}
+}
+
+// load 从文件读取授权记录，文件不存在时视为空
+func (s *permStore) load() error {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	grants := make(map[int64]map[int64]Role)
+	if err = json.Unmarshal(b, &grants); err != nil {
+		return err
+	}
+	for gid, users := range grants {
+		for uid, r := range users {
+			if !r.grantable() {
+				return fmt.Errorf("role %s of user %d in group %d can not be granted", r, uid, gid)
+			}
+		}
+	}
+	s.rwMu.Lock()
+	s.grants = grants
+	s.rwMu.Unlock()
+	return nil
+}
+
+// save 将授权记录写入文件
+// 调用方需持有 rwMu
+func (s *permStore) save() error {
+	b, err := json.MarshalIndent(s.grants, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path, b)
+}
+
+func (s *permStore) get(groupId, userId int64) (Role, bool) {
+	s.rwMu.RLock()
+	defer s.rwMu.RUnlock()
+	r, ok := s.grants[groupId][userId]
+	return r, ok
+}
+
+func (s *permStore) grant(groupId, userId int64, role Role) error {
+	if !role.grantable() {
+		return fmt.Errorf("role %s can not be granted", role)
+	}
+	s.rwMu.Lock()
+	defer s.rwMu.Unlock()
+	if _, ok := s.grants[groupId]; !ok {
+		s.grants[groupId] = make(map[int64]Role)
+	}
+	s.grants[groupId][userId] = role
+	return s.save()
+}
+
+// revoke 撤销授予的角色，返回此前是否存在授权
+func (s *permStore) revoke(groupId, userId int64) (bool, error) {
+	s.rwMu.Lock()
+	defer s.rwMu.Unlock()
+	if _, ok := s.grants[groupId][userId]; !ok {
+		return false, nil
+	}
+	delete(s.grants[groupId], userId)
+	if len(s.grants[groupId]) == 0 {
+		delete(s.grants, groupId)
+	}
+	return true, s.save()
+}
+
+type roleGrant struct {
+	UserId int64
+	Role   Role
+}
+
+// list 列出群内所有授予的角色，按角色从高到低排序
+func (s *permStore) list(groupId int64) []roleGrant {
+	s.rwMu.RLock()
+	defer s.rwMu.RUnlock()
+	rst := make([]roleGrant, 0, len(s.grants[groupId]))
+	for uid, r := range s.grants[groupId] {
+		rst = append(rst, roleGrant{UserId: uid, Role: r})
+	}
+	sort.Slice(rst, func(i, j int) bool {
+		if rst[i].Role != rst[j].Role {
+			return rst[i].Role > rst[j].Role
+		}
+		return rst[i].UserId < rst[j].UserId
+	})
+	return rst
+}
+
+// roleOf 获取用户在群内的有效角色
+// 优先级：admin_id_list 中的超级管理员 > 授予的角色 > QQ 群内的身份 > 普通成员
+func (m *shell) roleOf(qqClient bot.Client, groupId, userId int64) Role {
+	if m.adminIdMap[userId] {
+		return RoleSuperAdmin
+	}
+	if r, ok := m.permStore.get(groupId, userId); ok {
+		return r
+	}
+	if g := qqClient.FindGroup(groupId); g != nil {
+		if member := g.FindMember(userId); member != nil {
+			switch member.Permission {
+			case client.Owner:
+				return RoleOwner
+			case client.Administrator:
+				return RoleAdmin
+			}
+		}
+	}
+	return RoleMember
+}
+
+// requiredRoleOf 获取执行命令所需的角色
+// 配置文件中的 command_roles（以命令路径为键，如 "diary init"）优先于注册命令时指定的角色，
+// 均未指定时继承父命令
+func (m *shell) requiredRoleOf(cmd *Command) Role {
+	for c := cmd; c != nil; c = c.parent {
+		if r, ok := m.config.CommandRoles[c.path()]; ok {
+			return r
+		}
+		if c.RequiredRole != roleInherit {
+			return c.RequiredRole
+		}
+	}
+	return RoleMember
+}
+
+// cmdVisibleTo 命令是否对角色为 role 的用户在 source 中可见
+// 没有 Handler 的命令仅在存在可见的子命令时可见
+// 调用方需持有 registry.rwMu
+func (m *shell) cmdVisibleTo(cmd *Command, role Role, source MsgContext) bool {
+	if role < m.requiredRoleOf(cmd) || cmd.contexts()&source == 0 {
+		return false
+	}
+	if cmd.Handler != nil {
+		return true
+	}
+	for _, sub := range cmd.SubCmds {
+		if m.cmdVisibleTo(sub, role, source) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGroupMember 检查用户是否为群成员
+func isGroupMember(qqClient bot.Client, groupId, userId int64) bool {
+	g := qqClient.FindGroup(groupId)
+	return g != nil && g.FindMember(userId) != nil
+}
@@ -0,0 +1,192 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
+)
+
+// cmdRegistry 所有已注册的命令树
+// 其他模块可在运行时注册或注销命令，因此读取命令树时需持有 rwMu
+type cmdRegistry struct {
+	cmds map[string]*Command // rwMu protected
+	rwMu sync.RWMutex
+
+	// running 各模块正在执行的命令数，注销时等待其归零
+	running   map[bot.ModuleID]int // runningMu protected
+	runningMu sync.Mutex
+	idle      *sync.Cond // signaled when a count in running drops to zero
+}
+
+var registry = newCmdRegistry()
+
+func newCmdRegistry() *cmdRegistry {
+	r := &cmdRegistry{
+		cmds:    make(map[string]*Command),
+		running: make(map[bot.ModuleID]int),
+	}
+	r.idle = sync.NewCond(&r.runningMu)
+	return r
+}
+
+// register 将 cmd 注册为 parentPath 的子命令，parentPath 为空时注册为顶层命令
+// 同一模块重复注册同名命令时覆盖之前的命令
+func (r *cmdRegistry) register(owner bot.ModuleID, parentPath string, cmd *Command) error {
+	for _, name := range cmd.names() {
+		if !isValidCmdName(name) {
+			return fmt.Errorf("invalid command name %q", name)
+		}
+	}
+
+	r.rwMu.Lock()
+	defer r.rwMu.Unlock()
+
+	cmd.owner = owner
+	if len(parentPath) == 0 {
+		cmd.parent = nil
+		if err := cmd.link(); err != nil {
+			return err
+		}
+		for _, name := range cmd.names() {
+			// the same module may replace its own cmd, but never shadow another one
+			if existing, ok := r.get(name); ok && (existing.owner != owner || existing.Name != cmd.Name) {
+				return fmt.Errorf("command %s already registered by %s", name, existing.owner)
+			}
+		}
+		r.cmds[cmd.Name] = cmd
+		return nil
+	}
+
+	parent := r.find(parentPath)
+	if parent == nil {
+		return fmt.Errorf("parent command %s not found", parentPath)
+	}
+	for _, name := range cmd.names() {
+		if name == helpCmdName {
+			return fmt.Errorf("sub command name %s of %s is reserved", name, parentPath)
+		}
+		if existing := parent.findSubCmd(name); existing != nil && (existing.owner != owner || existing.Name != cmd.Name) {
+			return fmt.Errorf("command %s %s already registered by %s", parentPath, name, existing.owner)
+		}
+	}
+	cmd.parent = parent
+	if err := cmd.link(); err != nil {
+		return err
+	}
+
+	// replace the sub cmd of the same name, or append it
+	subCmds := make([]*Command, 0, len(parent.SubCmds)+1)
+	for _, sub := range parent.SubCmds {
+		if sub.Name != cmd.Name {
+			subCmds = append(subCmds, sub)
+		}
+	}
+	parent.SubCmds = append(subCmds, cmd)
+	return nil
+}
+
+// unregister 注销 owner 注册的所有命令及其子命令，并等待其正在执行的命令返回
+func (r *cmdRegistry) unregister(owner bot.ModuleID) {
+	r.rwMu.Lock()
+	for name, cmd := range r.cmds {
+		if cmd.owner == owner {
+			delete(r.cmds, name)
+		} else {
+			cmd.removeSubCmdsOf(owner)
+		}
+	}
+	r.rwMu.Unlock()
+
+	// Note: no cmd of owner begins from now on, so the module can safely reset its states
+	// once the running ones have returned, e.g. in Init when reloading.
+	r.runningMu.Lock()
+	defer r.runningMu.Unlock()
+	for r.running[owner] > 0 {
+		r.idle.Wait()
+	}
+}
+
+// begin 在 cmd 仍注册时记录其开始执行，返回 false 表示 cmd 已被注销
+// 返回 true 时，调用方需在命令返回后调用 end
+func (r *cmdRegistry) begin(cmd *Command) bool {
+	r.rwMu.RLock()
+	defer r.rwMu.RUnlock()
+	if !r.contains(cmd) {
+		return false
+	}
+
+	r.runningMu.Lock()
+	defer r.runningMu.Unlock()
+	r.running[cmd.owner]++
+	return true
+}
+
+// end 记录 begin 开始的命令已返回
+func (r *cmdRegistry) end(cmd *Command) {
+	r.runningMu.Lock()
+	defer r.runningMu.Unlock()
+	if r.running[cmd.owner]--; r.running[cmd.owner] <= 0 {
+		delete(r.running, cmd.owner)
+		r.idle.Broadcast()
+	}
+}
+
+// contains cmd 及其所有祖先是否仍在命令树中
+// 调用方需持有 rwMu
+func (r *cmdRegistry) contains(cmd *Command) bool {
+	for ; cmd.parent != nil; cmd = cmd.parent {
+		if cmd.parent.findSubCmd(cmd.Name) != cmd {
+			return false
+		}
+	}
+	return r.cmds[cmd.Name] == cmd
+}
+
+// find 按路径查找命令，如 "set chatbot"
+// 调用方需持有 rwMu
+func (r *cmdRegistry) find(path string) *Command {
+	names := strings.Fields(path)
+	if len(names) == 0 {
+		return nil
+	}
+	cmd, ok := r.get(names[0])
+	if !ok {
+		return nil
+	}
+	for _, name := range names[1:] {
+		if cmd = cmd.findSubCmd(name); cmd == nil {
+			return nil
+		}
+	}
+	return cmd
+}
+
+// has 是否存在名称或别名为 name 的顶层命令
+func (r *cmdRegistry) has(name string) bool {
+	r.rwMu.RLock()
+	defer r.rwMu.RUnlock()
+	_, ok := r.get(name)
+	return ok
+}
+
+// get 按名称或别名获取顶层命令
+// 调用方需持有 rwMu
+func (r *cmdRegistry) get(name string) (*Command, bool) {
+	if cmd, ok := r.cmds[name]; ok {
+		return cmd, true
+	}
+	for _, cmd := range r.cmds {
+		if cmd.matches(name) {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// isValidCmdName 命令名及别名不能为空，也不能包含空白字符
+func isValidCmdName(name string) bool {
+	return len(name) > 0 && strings.IndexFunc(name, unicode.IsSpace) < 0
+}
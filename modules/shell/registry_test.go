@@ -0,0 +1,49 @@
+package shell
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnregisterWaitsForRunningCmds(t *testing.T) {
+	const owner = "shell_test"
+	r := newCmdRegistry()
+	parent := &Command{Name: "ls"}
+	if err := r.register(ModuleName, "", parent); err != nil {
+		t.Fatal(err)
+	}
+	cmd := &Command{Name: "test", Handler: func(*CmdContext) {}}
+	if err := r.register(owner, "ls", cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.begin(cmd) {
+		t.Fatal("expected a registered cmd to begin")
+	}
+	done := make(chan struct{})
+	go func() {
+		r.unregister(owner)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected unregister to wait for the running cmd")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// cmds of other modules are not waited for, nor affected
+	if !r.begin(parent) {
+		t.Fatal("expected the parent cmd to begin")
+	}
+
+	r.end(cmd)
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for unregister")
+	}
+	if r.begin(cmd) {
+		t.Fatal("expected an unregistered cmd not to begin")
+	}
+	r.end(parent)
+}
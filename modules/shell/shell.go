@@ -13,4 +13,12 @@ var logger = utils.GetModuleLogger(ModuleName)
 func init() {
 	instance = NewShell()
 	bot.RegisterModule(instance)
+
+	// builtin commands are registered once, so that sub commands registered
+	// by other modules survive reloading of this module
+	for _, cmd := range builtinCmds() {
+		if err := RegisterCommand(ModuleName, cmd); err != nil {
+			logger.WithError(err).Errorf("failed to register builtin command %s", cmd.Name)
+		}
+	}
 }
@@ -0,0 +1,24 @@
+package shell
+
+import "github.com/zhouziqunzzq/MiraiGo-DD/bot"
+
+// These are APIs exposed to other modules.
+// Commands can be registered at any time, typically in PostInit of the owner module,
+// and should be unregistered in Stop so that they disappear with the module.
+
+// RegisterCommand 注册顶层命令，如 "diary"
+// 同一模块重复注册同名命令时将覆盖之前的命令，不同模块的命令不能重名
+func RegisterCommand(owner bot.ModuleID, cmd *Command) error {
+	return registry.register(owner, "", cmd)
+}
+
+// RegisterSubCommand 将 cmd 注册为已有命令 parentPath 的子命令，如 parentPath 为 "ls" 时注册 "ls bili"
+func RegisterSubCommand(owner bot.ModuleID, parentPath string, cmd *Command) error {
+	return registry.register(owner, parentPath, cmd)
+}
+
+// UnregisterCommands 注销 owner 注册的所有命令，并等待其正在执行的命令返回
+// 不能在 owner 自身的命令中调用
+func UnregisterCommands(owner bot.ModuleID) {
+	registry.unregister(owner)
+}
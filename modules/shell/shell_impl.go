@@ -1,30 +1,38 @@
 package shell
 
 import (
+	"fmt"
 	"github.com/Mrs4s/MiraiGo/client"
 	"github.com/Mrs4s/MiraiGo/message"
 	"github.com/zhouziqunzzq/MiraiGo-DD/bot"
 	"github.com/zhouziqunzzq/MiraiGo-DD/config"
-	"github.com/zhouziqunzzq/MiraiGo-DD/utils"
-	"gopkg.in/yaml.v2"
+	"github.com/zhouziqunzzq/MiraiGo-DD/modules/common"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"time"
 )
 
+const unauthorizedRsp = "您的权限不足 QAQ"
+
 type shell struct {
-	isEnabled        bool
-	config           Config
-	adminIdMap       map[int64]bool
-	cmdHandlerMap    map[string]func(*CmdContext)
-	cmdCheckAdminMap map[string]bool
+	isEnabled    bool
+	config       Config
+	moduleConfig *config.ModuleConfig[Config]
+	adminIdMap   map[int64]bool
+	permStore    *permStore
+	throttler    *throttler
+	auditLog     *auditLog
 }
 
 func NewShell() *shell {
 	return &shell{
-		isEnabled:        false,
-		config:           Config{},
-		adminIdMap:       make(map[int64]bool),
-		cmdHandlerMap:    make(map[string]func(ctx *CmdContext)),
-		cmdCheckAdminMap: make(map[string]bool),
+		isEnabled:  false,
+		config:     Config{},
+		adminIdMap: make(map[int64]bool),
+		permStore:  newPermStore(""),
+		throttler:  newThrottler(1, 0),
+		auditLog:   newAuditLog(""),
 	}
 }
 
@@ -35,7 +43,16 @@ func (m *shell) MiraiGoModule() bot.ModuleInfo {
 	}
 }
 
+// IsEnabled 本模块是否已成功初始化并启用
+func (m *shell) IsEnabled() bool {
+	return m.isEnabled
+}
+
 func (m *shell) Init() {
+	// reset states in case of reloading
+	m.config = Config{}
+	m.adminIdMap = make(map[int64]bool)
+
 	// check is_enabled
 	m.isEnabled = config.GlobalConfig.GetBool("modules." + ModuleName + ".is_enabled")
 	if !m.isEnabled {
@@ -44,33 +61,45 @@ func (m *shell) Init() {
 	}
 
 	// load module config
-	configPath := config.GlobalConfig.GetString("modules." + ModuleName + ".config_path")
-	if configPath == "" {
-		configPath = "./shell.yaml"
-	}
-	logger.Debugf("reading config from %s", configPath)
-	cb := utils.ReadFile(configPath)
-	err := yaml.Unmarshal(cb, &m.config)
+	m.moduleConfig = config.NewModuleConfig[Config](ModuleName, "./shell.yaml")
+	cfg, err := m.moduleConfig.Load()
 	if err != nil {
-		logger.WithError(err).Errorf("unable to read config file in %s", configPath)
+		logger.WithError(err).Error("unable to load module config")
 		m.isEnabled = false
 		return
 	}
+	m.config = *cfg
+	if err = m.moduleConfig.Watch(m.OnConfigChange); err != nil {
+		logger.WithError(err).Warn("unable to watch module config, hot reload disabled")
+	}
 
 	// load admin id list
-	// TODO: grant admin role as per Group, not just to User ID
-	for _, groupCode := range m.config.AdminIdList {
-		m.adminIdMap[groupCode] = true
-		logger.Infof("admin enabled for ID %d", groupCode)
+	for _, uid := range m.config.AdminIdList {
+		m.adminIdMap[uid] = true
+		logger.Infof("super admin enabled for ID %d", uid)
 	}
 
-	// register cmd handlers
-	m.registerCmd("ping", handlePing, false)
-	m.registerCmd("persecute", handlePersecute, true)
-	m.registerCmd("dd", handleDd, false)
-	m.registerCmd("ls", handleLs, false)
-	m.registerCmd("set", handleSet, false)
-	m.registerCmd("diary", handleDiary, false)
+	// load roles granted per group
+	m.permStore = newPermStore(m.config.PermStorePath)
+	if err = m.permStore.load(); err != nil {
+		logger.WithError(err).Errorf("unable to load granted roles from %s", m.config.PermStorePath)
+		m.isEnabled = false
+		return
+	}
+
+	// open audit log
+	m.auditLog = newAuditLog(m.config.AuditLogPath)
+	if err = m.auditLog.open(); err != nil {
+		logger.WithError(err).Errorf("unable to open audit log %s", m.config.AuditLogPath)
+		m.isEnabled = false
+		return
+	}
+
+	// other modules tell cmds apart by prefixes as well
+	common.SetCmdPrefixes(m.config.CmdPrefixes)
+
+	// cooldowns and the concurrency cap start afresh after reloading
+	m.throttler = newThrottler(m.config.MaxConcurrentHandlers, m.config.ThrottleNoticeInterval)
 }
 
 func (m *shell) PostInit() {
@@ -98,32 +127,22 @@ func (m *shell) Start(b *bot.Bot) {
 func (m *shell) Stop(b *bot.Bot, wg *sync.WaitGroup) {
 	// 别忘了解锁
 	defer wg.Done()
+
+	// stop watching module config
+	if m.moduleConfig != nil {
+		m.moduleConfig.Close()
+	}
+	common.SetCmdPrefixes(nil)
+	m.auditLog.close()
 	// 结束部分
 	// 一般调用此函数时，程序接收到 os.Interrupt 信号
 	// 即将退出
 	// 在此处应该释放相应的资源或者对状态进行保存
 }
 
-func (m *shell) checkAdminPermission(cmdName string, userId int64) bool {
-	if v, ok := m.cmdCheckAdminMap[cmdName]; !ok || !v {
-		return true
-	}
-	if _, ok := m.adminIdMap[userId]; ok {
-		return true
-	}
-	return false
-}
-
-func (m *shell) registerCmd(name string, handler func(*CmdContext), needAdminCheck bool) {
-	if _, ok := m.cmdHandlerMap[name]; ok {
-		logger.Warnf("command %s already exist", name)
-		return
-	}
-
-	m.cmdHandlerMap[name] = handler
-	if needAdminCheck {
-		m.cmdCheckAdminMap[name] = true
-	}
+// OnConfigChange 模块配置文件变更后重载本模块以应用新配置
+func (m *shell) OnConfigChange(*Config) {
+	bot.ReloadModuleAsync(ModuleName)
 }
 
 func (m *shell) getParseErrResp() *message.SendingMessage {
@@ -140,48 +159,286 @@ func (m *shell) getCmdNotFoundErrResp() *message.SendingMessage {
 
 func (m *shell) getUnauthorizedErrResp() *message.SendingMessage {
 	msg := message.NewSendingMessage()
-	msg.Append(message.NewText("您的权限不足 QAQ"))
+	msg.Append(message.NewText(unauthorizedRsp))
 	return msg
 }
 
-func (m *shell) handleGroupMessage(qqClient *client.QQClient, groupMessage *message.GroupMessage) {
-	rawStr := groupMessage.ToString()
-	// parse cmd
-	parsedCmd, err := parseCmd(rawStr)
+func (m *shell) handleGroupMessage(qqClient bot.Client, groupMessage *message.GroupMessage) {
+	rawStr, mentioned := groupMessage.ToString(), false
+	if m.config.MentionTrigger {
+		if s, ok := trimMention(qqClient.BotUin(), groupMessage.Elements); ok {
+			rawStr, mentioned = s, true
+		}
+	}
+	m.handleMessage(
+		qqClient, groupMessage, GroupContext,
+		groupMessage.GroupCode, groupMessage.Sender.Uin, rawStr, mentioned,
+	)
+}
+
+// trimMention 若消息以 @Bot 开头（可先引用一条消息），返回 @ 之后的内容
+func trimMention(botUin int64, elems []message.IMessageElement) (string, bool) {
+	for i, elem := range elems {
+		switch e := elem.(type) {
+		case *message.ReplyElement:
+			continue
+		case *message.TextElement:
+			if len(strings.TrimSpace(e.Content)) == 0 {
+				continue
+			}
+		case *message.AtElement:
+			if e.Target == botUin {
+				return (&message.GroupMessage{Elements: elems[i+1:]}).ToString(), true
+			}
+		}
+		return "", false
+	}
+	return "", false
+}
+
+func (m *shell) handlePrivateMessage(qqClient bot.Client, privateMessage *message.PrivateMessage) {
+	// skip messages sent by the bot itself from other devices
+	if privateMessage.Sender.Uin == privateMessage.Self {
+		return
+	}
+	m.handleMessage(
+		qqClient, privateMessage, PrivateContext,
+		0, privateMessage.Sender.Uin, privateMessage.ToString(), false,
+	)
+}
+
+func (m *shell) handleTempMessage(qqClient bot.Client, tempMessageEvent *client.TempMessageEvent) {
+	tempMessage := tempMessageEvent.Message
+	m.handleMessage(
+		qqClient, tempMessage, TempContext,
+		tempMessage.GroupCode, tempMessage.Sender.Uin, tempMessage.ToString(), false,
+	)
+}
+
+func (m *shell) handleMessage(
+	qqClient bot.Client,
+	originMsg interface{},
+	source MsgContext,
+	groupId, userId int64,
+	rawStr string,
+	mentioned bool,
+) {
+	start := time.Now()
+	// parse cmd, the prefix is optional after @-mentioning the bot
+	parsedCmd, err := parseCmd(rawStr, mentioned)
 	if parsedCmd == nil {
-		logger.Debugf("not a cmd, skipping group message %s", rawStr)
+		logger.Debugf("not a cmd, skipping %s message %s", source, rawStr)
+		return
+	}
+	if path, ok := m.aliasOf(parsedCmd.Name); ok {
+		if err == nil {
+			err = parsedCmd.expand(path)
+		} else {
+			parsedCmd.Name = path[0]
+		}
+	}
+	ctx := NewCmdContext(parsedCmd, qqClient, originMsg)
+	ctx.Source, ctx.GroupId, ctx.UserId = source, groupId, userId
+
+	// try to handle cmd
+	if !registry.has(parsedCmd.Name) {
+		logger.WithError(err).Debugf("cmd %s not found", rawStr)
+		// XXX: there could be multiple bots in the same group, so don't flood
+		// the chat with 'not found' messages...
+		if source != GroupContext {
+			sendRsp(m.getCmdNotFoundErrResp(), ctx)
+		}
 		return
 	}
+	// every invocation of a known cmd is audited
+	auditLog := m.auditLog
+	rec := &auditRecord{
+		Time:    start,
+		UserId:  userId,
+		GroupId: groupId,
+		Source:  sourceName(source),
+		Raw:     rawStr,
+		Cmd:     parsedCmd.Name,
+	}
+	audit := func(outcome auditOutcome, err error) {
+		rec.Outcome = outcome
+		rec.LatencyMs = time.Since(start).Milliseconds()
+		if err != nil {
+			rec.Error = err.Error()
+		}
+		auditLog.append(rec)
+	}
+
 	if err != nil {
 		logger.WithError(err).Errorf("failed to parse cmd %s", rawStr)
-		qqClient.SendGroupMessage(groupMessage.GroupCode, m.getParseErrResp())
+		sendRsp(m.getParseErrResp(), ctx)
+		audit(outcomeParseError, err)
 		return
 	}
+	cmd, policy, err := m.resolveCmd(parsedCmd)
+	if cmd == nil {
+		// unregistered in the meantime
+		return
+	}
+	rec.Cmd = cmd.path()
+	if err != nil {
+		logger.WithError(err).Debugf("invalid args for cmd %s", rawStr)
+		sendTextRsp(fmt.Sprintf("参数错误，%v", err), ctx)
+		audit(outcomeInvalidArgs, err)
+		return
+	}
+	ctx.Cmd = cmd
 
-	// try to handle cmd
-	if handler, ok := m.cmdHandlerMap[parsedCmd.Name]; ok {
-		// check admin
-		if m.checkAdminPermission(parsedCmd.Name, groupMessage.Sender.Uin) {
-			// build context
-			ctx := NewCmdContext(parsedCmd, qqClient, groupMessage)
-			// handle cmd async
-			go handler(ctx)
+	// a group can be targeted explicitly from private chat or temp session,
+	// but never from a group chat, where the cmd always acts on the source group
+	if gid, ok := parsedCmd.IntFlag("group"); ok {
+		if source == GroupContext {
+			sendTextRsp("群聊中不支持 --group，命令仅作用于本群", ctx)
+			audit(outcomeWrongContext, nil)
+			return
+		}
+		rec.GroupId = gid
+		if !m.adminIdMap[userId] && !isGroupMember(qqClient, gid, userId) {
+			sendTextRsp(fmt.Sprintf("您不是群 %d 的成员", gid), ctx)
+			audit(outcomeNotMember, nil)
+			return
+		}
+		ctx.GroupId = gid
+	}
+
+	// check context
+	if policy.contexts&source == 0 {
+		sendTextRsp(fmt.Sprintf("命令 %s 不支持在%s中使用", cmd.path(), source), ctx)
+		audit(outcomeWrongContext, nil)
+		return
+	}
+
+	// check permission
+	role := m.roleOf(qqClient, ctx.GroupId, userId)
+	if role < policy.requiredRole {
+		logger.Debugf("unauthorized user %d try to access cmd %s in group %d", userId, rawStr, ctx.GroupId)
+		if ctx.GroupId == 0 {
+			// roles are granted per group, so hint the user to target one
+			sendTextRsp(unauthorizedRsp+"\n如需使用群内权限，请通过 --group <群号> 指定群", ctx)
 		} else {
-			logger.WithError(err).Debugf(
-				"unauthorized user %d try to access cmd %s",
-				groupMessage.Sender.Uin,
-				rawStr,
-			)
-			qqClient.SendGroupMessage(groupMessage.GroupCode, m.getUnauthorizedErrResp())
+			sendRsp(m.getUnauthorizedErrResp(), ctx)
+		}
+		audit(outcomeUnauthorized, nil)
+		return
+	}
+	if policy.requiredRole >= RoleAdmin {
+		// admin replies go before broadcasts and chats
+		ctx.Priority = bot.PriorityHigh
+	}
+
+	// check cooldown, admins are exempted
+	if role < RoleAdmin {
+		if remaining := m.throttler.acquire(policy.cooldownPath, policy.cooldown, ctx.GroupId, userId, start); remaining > 0 {
+			logger.Debugf("cmd %s of user %d in group %d is cooling down", rawStr, userId, ctx.GroupId)
+			m.sendThrottleNotice(ctx, fmt.Sprintf("命令 %s 冷却中，请 %s后再试～", policy.cooldownPath, formatRemaining(remaining)), start)
+			audit(outcomeCooldown, nil)
+			return
 		}
+	}
+
+	// handle cmd async, the owner module waits for it before stopping
+	if !registry.begin(cmd) {
+		// unregistered in the meantime
+		return
+	}
+	handle := func() {
+		defer registry.end(cmd)
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Errorf("cmd %s panicked: %v\n%s", rawStr, r, debug.Stack())
+				audit(outcomePanic, fmt.Errorf("%v", r))
+			}
+		}()
+		cmd.Handler(ctx)
+		audit(outcomeOk, nil)
+	}
+	if !m.throttler.tryGo(handle) {
+		registry.end(cmd)
+		logger.Warnf("too many cmds running, rejecting %s from user %d", rawStr, userId)
+		m.sendThrottleNotice(ctx, "Bot 正忙，请稍后再试～", start)
+		audit(outcomeBusy, nil)
+	}
+}
+
+// sendThrottleNotice 回复冷却或繁忙提示
+// 提示本身也受频率限制，群聊中按群计算，其他消息按用户计算，避免刷屏
+func (m *shell) sendThrottleNotice(ctx *CmdContext, notice string, now time.Time) {
+	var groupId, userId int64
+	if ctx.Source == GroupContext {
+		groupId = ctx.GroupId
 	} else {
-		// XXX: there could be multiple bots in the same group, so don't flood
-		// the chat with 'not found' messages...
-		logger.WithError(err).Debugf("cmd %s not found", rawStr)
-		//qqClient.SendGroupMessage(groupMessage.GroupCode, m.getCmdNotFoundErrResp())
+		userId = ctx.UserId
+	}
+	if m.throttler.allowNotice(groupId, userId, now) {
+		sendTextRsp(notice, ctx)
+	}
+}
+
+// aliasOf 查找配置文件中的别名，返回其对应的命令路径
+func (m *shell) aliasOf(name string) ([]string, bool) {
+	target, ok := m.config.Aliases[name]
+	if !ok {
+		return nil, false
+	}
+	return strings.Fields(target), true
+}
+
+// cmdPolicy 执行命令前需要检查的限制
+type cmdPolicy struct {
+	requiredRole Role
+	contexts     MsgContext
+	// cooldownPath 计算冷却的命令路径，可能是命令本身或其祖先
+	cooldownPath string
+	cooldown     Cooldown
+}
+
+// resolveCmd 查找处理 parsedCmd 的（子）命令，并依照其声明解析参数
+// 返回该命令及其执行限制，命令不存在时返回 nil
+func (m *shell) resolveCmd(parsedCmd *ParsedCmd) (*Command, cmdPolicy, error) {
+	registry.rwMu.RLock()
+	defer registry.rwMu.RUnlock()
+
+	root, ok := registry.get(parsedCmd.Name)
+	if !ok {
+		return nil, cmdPolicy{}, nil
+	}
+
+	// find the sub cmd to handle, e.g. "/diary init 100" is handled by "diary init"
+	cmd, depth := root.resolve(parsedCmd.Args)
+	var err error
+	switch {
+	case cmd.Handler == nil && depth < len(parsedCmd.Args) && parsedCmd.Arg(depth) != helpCmdName:
+		err = fmt.Errorf("未知的子命令 %s", parsedCmd.Arg(depth))
+	case cmd.Handler == nil || (len(cmd.SubCmds) > 0 && parsedCmd.Arg(depth) == helpCmdName):
+		// "/diary help" and "/diary" are the same as "/help diary"
+		helpPath := strings.Fields(cmd.path())
+		if parsedCmd.Arg(depth) == helpCmdName {
+			depth++
+		}
+		if cmd, ok = registry.get(helpCmdName); !ok {
+			return nil, cmdPolicy{}, nil
+		}
+		if err = cmd.spec().bind(parsedCmd, depth); err == nil {
+			parsedCmd.Args = append(helpPath, parsedCmd.Args...)
+		}
+	default:
+		err = cmd.spec().bind(parsedCmd, depth)
+	}
+	if err != nil {
+		return cmd, cmdPolicy{}, fmt.Errorf("%v\n%s", err, cmd.spec().Usage(cmd.path()))
 	}
+	policy := cmdPolicy{requiredRole: m.requiredRoleOf(cmd), contexts: cmd.contexts()}
+	policy.cooldownPath, policy.cooldown = m.cooldownOf(cmd)
+	return cmd, policy, nil
 }
 
 func (m *shell) registerCallbacks(b *bot.Bot) {
-	b.GroupMessageEvent.Subscribe(m.handleGroupMessage)
+	b.GroupMessageEvent.Subscribe(ModuleName, m.handleGroupMessage)
+	b.PrivateMessageEvent.Subscribe(ModuleName, m.handlePrivateMessage)
+	b.TempMessageEvent.Subscribe(ModuleName, m.handleTempMessage)
 }
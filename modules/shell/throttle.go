@@ -0,0 +1,155 @@
+package shell
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cooldown 命令的冷却时间，零值表示不限制
+type Cooldown struct {
+	// User 同一用户两次调用的最小间隔
+	User time.Duration `yaml:"user"`
+	// Group 同一群内两次调用的最小间隔，私聊中未指定群时不限制
+	Group time.Duration `yaml:"group"`
+}
+
+func (c Cooldown) isZero() bool {
+	return c.User <= 0 && c.Group <= 0
+}
+
+// cooldownOf 获取命令的冷却时间及计算冷却的命令路径
+// 依次查找配置文件中的 cooldowns 与命令声明的 Cooldown，未指定时继承父命令
+// 继承时父命令与其所有子命令共享冷却
+// 调用方需持有 registry.rwMu
+func (m *shell) cooldownOf(cmd *Command) (string, Cooldown) {
+	for c := cmd; c != nil; c = c.parent {
+		path := c.path()
+		if cd, ok := m.config.Cooldowns[path]; ok {
+			return path, cd
+		}
+		if !c.Cooldown.isZero() {
+			return path, c.Cooldown
+		}
+	}
+	return "", Cooldown{}
+}
+
+// throttleKey 冷却与提示的计数对象，userId 为 0 时表示整个群
+type throttleKey struct {
+	path    string
+	groupId int64
+	userId  int64
+}
+
+// sweepThreshold 冷却记录超过该数量时清理已过期的记录
+const sweepThreshold = 1024
+
+// throttler 命令的冷却与并发限制
+type throttler struct {
+	// sem 正在执行的命令处理函数，容量即并发上限
+	sem            chan struct{}
+	noticeInterval time.Duration
+
+	mu          sync.Mutex
+	expiry      map[throttleKey]time.Time // mu protected, when the cooldown ends
+	noticeAfter map[throttleKey]time.Time // mu protected, when the next notice is allowed
+}
+
+func newThrottler(maxConcurrent int, noticeInterval time.Duration) *throttler {
+	return &throttler{
+		sem:            make(chan struct{}, maxConcurrent),
+		noticeInterval: noticeInterval,
+		expiry:         make(map[throttleKey]time.Time),
+		noticeAfter:    make(map[throttleKey]time.Time),
+	}
+}
+
+// acquire 检查命令 path 是否仍在冷却，未冷却时记录本次调用
+// 返回剩余的冷却时间，为 0 时表示可以执行
+func (t *throttler) acquire(path string, cd Cooldown, groupId, userId int64, now time.Time) time.Duration {
+	if cd.isZero() {
+		return 0
+	}
+	userKey := throttleKey{path: path, groupId: groupId, userId: userId}
+	groupKey := throttleKey{path: path, groupId: groupId}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var remaining time.Duration
+	if cd.User > 0 {
+		remaining = maxDuration(remaining, t.expiry[userKey].Sub(now))
+	}
+	if cd.Group > 0 && groupId != 0 {
+		remaining = maxDuration(remaining, t.expiry[groupKey].Sub(now))
+	}
+	if remaining > 0 {
+		return remaining
+	}
+
+	if cd.User > 0 {
+		t.expiry[userKey] = now.Add(cd.User)
+	}
+	if cd.Group > 0 && groupId != 0 {
+		t.expiry[groupKey] = now.Add(cd.Group)
+	}
+	if len(t.expiry) > sweepThreshold {
+		sweep(t.expiry, now)
+	}
+	return 0
+}
+
+// allowNotice 限制提示消息的频率，每个群（或私聊用户）每 noticeInterval 至多提示一次
+func (t *throttler) allowNotice(groupId, userId int64, now time.Time) bool {
+	key := throttleKey{groupId: groupId, userId: userId}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Before(t.noticeAfter[key]) {
+		return false
+	}
+	t.noticeAfter[key] = now.Add(t.noticeInterval)
+	if len(t.noticeAfter) > sweepThreshold {
+		sweep(t.noticeAfter, now)
+	}
+	return true
+}
+
+// tryGo 在未达到并发上限时异步执行 fn，否则返回 false
+func (t *throttler) tryGo(fn func()) bool {
+	// capture sem, so that handlers started before a reload release the right one
+	sem := t.sem
+	select {
+	case sem <- struct{}{}:
+	default:
+		return false
+	}
+	go func() {
+		defer func() { <-sem }()
+		fn()
+	}()
+	return true
+}
+
+// sweep 清理已过期的记录
+func sweep(m map[throttleKey]time.Time, now time.Time) {
+	for k, t := range m {
+		if !now.Before(t) {
+			delete(m, k)
+		}
+	}
+}
+
+// formatRemaining 将剩余冷却时间格式化为向上取整的秒数
+func formatRemaining(d time.Duration) string {
+	return fmt.Sprintf("%d 秒", (d+time.Second-1)/time.Second)
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
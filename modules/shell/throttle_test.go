@@ -0,0 +1,147 @@
+package shell
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottlerCooldown(t *testing.T) {
+	const (
+		gid  = 100
+		uid1 = 1
+		uid2 = 2
+	)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type call struct {
+		path    string
+		groupId int64
+		userId  int64
+		at      time.Duration // since t0
+		want    time.Duration // remaining cooldown
+	}
+	tests := []struct {
+		name  string
+		cd    Cooldown
+		calls []call
+	}{
+		{"no cooldown", Cooldown{}, []call{
+			{"dd", gid, uid1, 0, 0},
+			{"dd", gid, uid1, 0, 0},
+		}},
+		{"user bucket", Cooldown{User: 10 * time.Second}, []call{
+			{"dd", gid, uid1, 0, 0},
+			{"dd", gid, uid1, 3 * time.Second, 7 * time.Second},
+			// other users and other cmds are not affected
+			{"dd", gid, uid2, 3 * time.Second, 0},
+			{"ping", gid, uid1, 3 * time.Second, 0},
+			// the same user in another group or in private chat is another bucket
+			{"dd", gid + 1, uid1, 3 * time.Second, 0},
+			{"dd", 0, uid1, 3 * time.Second, 0},
+			{"dd", gid, uid1, 10 * time.Second, 0},
+		}},
+		{"group bucket", Cooldown{Group: 10 * time.Second}, []call{
+			{"dd", gid, uid1, 0, 0},
+			{"dd", gid, uid2, time.Second, 9 * time.Second},
+			{"dd", gid + 1, uid2, time.Second, 0},
+			// not limited in private chat
+			{"dd", 0, uid1, time.Second, 0},
+			{"dd", 0, uid1, time.Second, 0},
+			{"dd", gid, uid2, 10 * time.Second, 0},
+		}},
+		{"both buckets", Cooldown{User: 30 * time.Second, Group: 10 * time.Second}, []call{
+			{"dd", gid, uid1, 0, 0},
+			{"dd", gid, uid2, 5 * time.Second, 5 * time.Second},
+			// the user bucket outlasts the group one
+			{"dd", gid, uid1, 10 * time.Second, 20 * time.Second},
+			{"dd", gid, uid2, 10 * time.Second, 0},
+			// a denied call doesn't restart the cooldown
+			{"dd", gid, uid1, 30 * time.Second, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newThrottler(1, time.Minute)
+			for i, c := range tt.calls {
+				got := th.acquire(c.path, tt.cd, c.groupId, c.userId, t0.Add(c.at))
+				if got != c.want {
+					t.Fatalf("call %d: expected %v remaining, got %v", i, c.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestThrottlerSweepsExpired(t *testing.T) {
+	th := newThrottler(1, time.Minute)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cd := Cooldown{User: time.Second}
+	for uid := int64(1); uid <= sweepThreshold; uid++ {
+		th.acquire("dd", cd, 0, uid, t0)
+	}
+	// all the above have expired by now
+	th.acquire("dd", cd, 0, sweepThreshold+1, t0.Add(time.Second))
+	th.acquire("dd", cd, 0, sweepThreshold+2, t0.Add(time.Second))
+	if n := len(th.expiry); n != 2 {
+		t.Fatalf("expected expired records to be swept, %d left", n)
+	}
+}
+
+func TestThrottlerAllowNotice(t *testing.T) {
+	th := newThrottler(1, 30*time.Second)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		groupId int64
+		userId  int64
+		at      time.Duration
+		want    bool
+	}{
+		{100, 0, 0, true},
+		{100, 0, 29 * time.Second, false},
+		{101, 0, 29 * time.Second, true},
+		{0, 1, 29 * time.Second, true},
+		{0, 1, 30 * time.Second, false},
+		{100, 0, 30 * time.Second, true},
+	}
+	for i, tt := range tests {
+		if got := th.allowNotice(tt.groupId, tt.userId, t0.Add(tt.at)); got != tt.want {
+			t.Fatalf("notice %d: expected %v, got %v", i, tt.want, got)
+		}
+	}
+}
+
+func TestThrottlerCapsConcurrentHandlers(t *testing.T) {
+	const maxConcurrent = 2
+	th := newThrottler(maxConcurrent, time.Minute)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, maxConcurrent)
+	for i := 0; i < maxConcurrent; i++ {
+		if !th.tryGo(func() {
+			started <- struct{}{}
+			<-release
+		}) {
+			t.Fatalf("handler %d: expected to start", i)
+		}
+	}
+	for i := 0; i < maxConcurrent; i++ {
+		<-started
+	}
+	if th.tryGo(func() {}) {
+		t.Fatal("expected the handler over the cap to be rejected")
+	}
+
+	// a slot is freed once a handler returns
+	close(release)
+	done := make(chan struct{})
+	deadline := time.After(3 * time.Second)
+	for !th.tryGo(func() { close(done) }) {
+		select {
+		case <-deadline:
+			t.Fatal("timeout waiting for a free slot")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	<-done
+}